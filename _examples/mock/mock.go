@@ -101,12 +101,9 @@ func Init(triad infra.MetaTriad) *aiot.MQTTClient {
 			log.Println("mqtt client connection lost, ", err)
 		})
 
-	mqc := mqtt.NewClient(opts)
-	mqc.Connect().Wait()
-
-	client := aiot.NewWithMQTT(
+	client := aiot.NewWithMQTTOptions(
 		triad,
-		mqc,
+		opts,
 		aiot.WithEnableNTP(),
 		aiot.WithEnableDesired(),
 		aiot.WithEnableDiag(),
@@ -116,6 +113,7 @@ func Init(triad infra.MetaTriad) *aiot.MQTTClient {
 		aiot.WithLogger(logger.New(log.New(os.Stdout, "mqtt --> ", log.LstdFlags), logger.WithEnable(true))),
 	)
 
+	client.Underlying().Connect().Wait()
 	if err = client.Connect(); err != nil {
 		panic(err)
 	}
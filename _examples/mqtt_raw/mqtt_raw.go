@@ -60,9 +60,9 @@ func main() {
 				log.Println("mqtt client connection lost, ", err)
 			})
 
-	dmClient := aiot.NewWithMQTT(
+	dmClient := aiot.NewWithMQTTOptions(
 		mock.MetaTriad,
-		mqtt.NewClient(opts),
+		opts,
 		aiot.WithEnableModelRaw(),
 		aiot.WithCallback(RawProc{}),
 		aiot.WithLogger(logger.New(log.New(os.Stdout, "mqtt --> ", log.LstdFlags))),
@@ -6,11 +6,13 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 	"io"
+	"sync"
 	"time"
 
-	"github.com/patrickmn/go-cache"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/things-go/aliyun-iot/infra"
 	"github.com/things-go/aliyun-iot/logger"
@@ -38,6 +40,9 @@ const (
 // ProcDownStream 处理下行数据
 type ProcDownStream func(c *Client, rawURI string, payload []byte) error
 
+// ProcDownStreamContext 处理下行数据, 使能链路追踪时ctx包含下行数据处理的span
+type ProcDownStreamContext func(ctx context.Context, c *Client, rawURI string, payload []byte) error
+
 // Conn conn接口
 type Conn interface {
 	// Publish will publish a Message with the specified QoS and content
@@ -53,6 +58,13 @@ type Request struct {
 	Version string      `json:"version"`
 	Params  interface{} `json:"params"`
 	Method  string      `json:"method"`
+	Sys     *RequestSys `json:"sys,omitempty"`
+}
+
+// RequestSys 请求的sys扩展功能参数域
+type RequestSys struct {
+	// Ack 是否需要云端回复, 1: 需要(默认), 0: 不需要
+	Ack int `json:"ack"`
 }
 
 // Response 应答
@@ -90,12 +102,37 @@ type Client struct {
 	hasExtRRPC  bool
 	hasOTA      bool
 
+	propertySetRepost bool
+	rawCodecs         map[string]RawCodec
+
+	retryPolicyDefault *RetryPolicy
+	methodRetryPolicy  map[string]*RetryPolicy
+
+	offline           OfflineStore
+	offlineMu         sync.Mutex
+	offlineReplaying  bool // 正在重发离线消息, 由offlineMu保护
+	hasOfflineHistory bool
+	historyLimit      HistoryLimit
+
+	decoders    map[string]Decoder
+	router      *router
+	thingModels thingModels
+	desired     *desiredSync
+
+	middlewares middlewares
+	dispatcher  *Dispatcher
+	metrics     Metrics
+	tracer      trace.Tracer
+	session     session
+
 	*DevMgr
-	msgCache *cache.Cache
+	pending     *pendingTable
+	orphanReply OrphanReply
 	Conn
 	cb   Callback
 	gwCb GwCallback
-	Log  logger.Logger
+	Log  logger.Logger // 日志, 需使用 SetLogger 修改
+	slog logger.StructuredLogger
 }
 
 // New 创建一个物管理客户端
@@ -110,27 +147,92 @@ func New(triad infra.MetaTriad, conn Conn, opts ...Option) *Client {
 		cacheExpiration:      DefaultCacheExpiration,
 		cacheCleanupInterval: DefaultCacheCleanupInterval,
 
+		methodRetryPolicy: make(map[string]*RetryPolicy),
+		decoders:          make(map[string]Decoder),
+		router:            newRouter(),
+		desired:           newDesiredSync(),
+		historyLimit:      DefaultHistoryLimit,
+		metrics:           NopMetrics{},
+
 		DevMgr: NewDevMgr(triad),
 		Conn:   conn,
 		cb:     NopCb{},
 		gwCb:   NopGwCb{},
-		Log:    logger.NewDiscard(),
 	}
+	c.SetLogger(logger.NewDiscard())
 	for _, opt := range opts {
 		opt(c)
 	}
 	if c.mode != ModeHTTP {
-		c.msgCache = cache.New(c.cacheExpiration, c.cacheCleanupInterval)
+		c.pending = newPendingTable(c.cacheExpiration, c.cacheCleanupInterval, c.metrics)
 	}
+	c.DevMgr.onlineChange = c.metrics.SetOnlineSubDevices
 	return c
 }
 
-// Connect 将订阅所有相关主题,主题有config配置
+// session 连接会话状态, 保证每次连接只重发离线消息及同步期望属性一次
+type session struct {
+	mu       sync.Mutex
+	hooked   bool // 连接成功由连接回调通知, 见 MQTTClient.OnConnectHandler
+	started  bool // 已调用 Connect
+	deferred bool // 调用 Connect 前连接回调已触发
+}
+
+// Connect 将订阅所有相关主题,主题有config配置,并重发离线队列中的消息,
+// 使能期望属性时同步已注册的期望属性,见 HandleDesired.
+// 对于 MQTTClient, 重发及同步在连接回调中进行, 每次连接只进行一次
 func (sf *Client) Connect() error {
 	if sf.mode != ModeMQTT {
 		return nil
 	}
-	return sf.SubscribeAllTopic(sf.tetrad.ProductKey, sf.tetrad.DeviceName, false)
+	if err := sf.SubscribeAllTopic(sf.tetrad.ProductKey, sf.tetrad.DeviceName, false); err != nil {
+		return err
+	}
+	sf.session.mu.Lock()
+	sf.session.started = true
+	resume := !sf.session.hooked || sf.session.deferred
+	sf.session.deferred = false
+	sf.session.mu.Unlock()
+	if resume {
+		sf.resume()
+	}
+	return nil
+}
+
+// connected 连接回调通知连接成功, 调用 Connect 前的连接延迟到 Connect 处理
+func (sf *Client) connected() {
+	sf.session.mu.Lock()
+	resume := sf.session.started
+	if !resume {
+		sf.session.deferred = true
+	}
+	sf.session.mu.Unlock()
+	if resume {
+		sf.resume()
+	}
+}
+
+// resume 连接成功后重发离线消息并同步期望属性
+func (sf *Client) resume() {
+	sf.replayOffline()
+	sf.triggerDesiredAll()
+}
+
+// SetLogger 设置日志, 未实现 logger.StructuredLogger 的日志使用 logger.Wrap 适配为结构化日志.
+// 非协程安全, 需在使用前设置
+func (sf *Client) SetLogger(l logger.Logger) {
+	sf.Log = l
+	sf.slog = logger.Wrap(l)
+}
+
+// StructuredLog 获取结构化日志, 见 SetLogger
+func (sf *Client) StructuredLog() logger.StructuredLogger {
+	return sf.slog
+}
+
+// DeviceLog 获取设备的子日志,日志自动携带productKey及deviceName字段
+func (sf *Client) DeviceLog(pk, dn string) logger.StructuredLogger {
+	return sf.StructuredLog().With("productKey", pk, "deviceName", dn)
 }
 
 // AddSubDevice 增加一个一个子设备
@@ -175,5 +277,73 @@ func (sf *Client) SubDeviceConnect(pk, dn string, cleanSession bool, timeout tim
 		return err
 	}
 	sf.SetDeviceStatus(pk, dn, DevStatusOnline) // nolint: errcheck
+	sf.replayOffline()
+	sf.triggerDesired(pk, dn)
 	return nil
 }
+
+// SubDeviceConnectContext 子设备连接注册并添加到网关拓扑关系,流程同 SubDeviceConnect
+// ctx控制整个上线流程的超时及取消
+func (sf *Client) SubDeviceConnectContext(ctx context.Context, pk, dn string, cleanSession bool) error {
+	node, err := sf.SearchAvail(pk, dn)
+	if err != nil {
+		return err
+	}
+	if node.Status() < DevStatusRegistered || node.DeviceSecret() == "" { // 需要注册
+		// 子设备注册
+		if _, err := sf.LinkThingSubRegisterContext(ctx, pk, dn); err != nil {
+			return err
+		}
+	}
+	// 子设备添加到拓扑
+	err = sf.LinkThingTopoAddContext(ctx, pk, dn)
+	if err != nil {
+		return err
+	}
+	// 上线
+	err = sf.LinkExtCombineLoginContext(ctx, CombinePair{pk, dn, cleanSession})
+	if err != nil {
+		return err
+	}
+	// 订阅
+	err = sf.SubscribeAllTopic(pk, dn, true)
+	if err != nil {
+		return err
+	}
+	sf.SetDeviceStatus(pk, dn, DevStatusOnline) // nolint: errcheck
+	sf.replayOffline()
+	sf.triggerDesired(pk, dn)
+	return nil
+}
+
+// ReloginSubDevices 重连后重新上线断线前处于 DevStatusOnline 的子设备
+// 按每批 CombineBatchMaxSize 个子设备批量上线,上线失败的子设备状态回退到 DevStatusAttached,
+// 需调用 SubDeviceConnect 重新上线. 子设备的订阅由 MQTTClient 重连时恢复
+func (sf *Client) ReloginSubDevices(timeout time.Duration) error {
+	if !sf.isGateway {
+		return ErrNotSupportFeature
+	}
+	var lastErr error
+
+	devices := sf.SubDevices(DevStatusOnline)
+	for start := 0; start < len(devices); start += CombineBatchMaxSize {
+		end := start + CombineBatchMaxSize
+		if end > len(devices) {
+			end = len(devices)
+		}
+		pairs := make([]CombinePair, 0, end-start)
+		for _, v := range devices[start:end] {
+			pairs = append(pairs, CombinePair{v.ProductKey, v.DeviceName, false})
+		}
+
+		status := DevStatusOnline
+		if err := sf.LinkExtCombineBatchLogin(pairs, timeout); err != nil {
+			sf.StructuredLog().Warn("relogin sub devices failed", "error", err)
+			status, lastErr = DevStatusAttached, err
+		}
+		for _, cp := range pairs {
+			sf.SetDeviceStatus(cp.ProductKey, cp.DeviceName, status) // nolint: errcheck
+		}
+	}
+	return lastErr
+}
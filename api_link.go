@@ -5,7 +5,9 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/things-go/aliyun-iot/infra"
@@ -15,57 +17,132 @@ import (
 
 // LinkThingConfigGet 获取配置参数,同步
 func (sf *Client) LinkThingConfigGet(pk, dn string, timeout time.Duration) (ConfigParamsData, error) {
-	token, err := sf.ThingConfigGet(pk, dn)
-	if err != nil {
-		return ConfigParamsData{}, err
-	}
-	msg, err := token.Wait(timeout)
-	if err != nil {
-		return ConfigParamsData{}, err
-	}
-	return msg.Data.(ConfigParamsData), nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingConfigGetContext(ctx, pk, dn)
+}
+
+// LinkThingConfigGetContext 获取配置参数,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingConfigGetContext(ctx context.Context, pk, dn string) (ConfigParamsData, error) {
+	var data ConfigParamsData
+	err := sf.doRetry(ctx, infra.MethodConfigGet, func(ctx context.Context) error {
+		token, err := sf.thingConfigGet(ctx, pk, dn)
+		if err != nil {
+			return err
+		}
+		msg, err := token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		data = msg.Data.(ConfigParamsData)
+		return nil
+	})
+	return data, err
 }
 
 /**************************************** event *****************************/
 
 // LinkThingEventPropertyPost 设备上报属性数据,同步
 func (sf *Client) LinkThingEventPropertyPost(pk, dn string, params interface{}, timeout time.Duration) error {
-	token, err := sf.ThingEventPropertyPost(pk, dn, params)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingEventPropertyPostContext(ctx, pk, dn, params)
+}
+
+// LinkThingEventPropertyPostContext 设备上报属性数据,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingEventPropertyPostContext(ctx context.Context, pk, dn string, params interface{}) error {
+	return sf.doRetry(ctx, infra.MethodEventPropertyPost, func(ctx context.Context) error {
+		token, err := sf.thingEventPropertyPost(ctx, pk, dn, params)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
 		return err
-	}
-	_, err = token.Wait(timeout)
-	return err
+	})
 }
 
 // LinkThingEventPost 设备事件上报,同步
 func (sf *Client) LinkThingEventPost(pk, dn, eventID string, params interface{}, timeout time.Duration) error {
-	token, err := sf.ThingEventPost(pk, dn, eventID, params)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingEventPostContext(ctx, pk, dn, eventID, params)
+}
+
+// LinkThingEventPostContext 设备事件上报,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingEventPostContext(ctx context.Context, pk, dn, eventID string, params interface{}) error {
+	return sf.doRetry(ctx, fmt.Sprintf(infra.MethodEventFormatPost, eventID), func(ctx context.Context) error {
+		token, err := sf.thingEventPost(ctx, pk, dn, eventID, params)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
 		return err
-	}
-	_, err = token.Wait(timeout)
-	return err
+	})
 }
 
 // LinkThingEventPropertyPackPost 网关批量上报数据,同步
 func (sf *Client) LinkThingEventPropertyPackPost(params interface{}, timeout time.Duration) error {
-	token, err := sf.ThingEventPropertyPackPost(params)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingEventPropertyPackPostContext(ctx, params)
+}
+
+// LinkThingEventPropertyPackPostContext 网关批量上报数据,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingEventPropertyPackPostContext(ctx context.Context, params interface{}) error {
+	return sf.doRetry(ctx, infra.MethodEventPropertyPackPost, func(ctx context.Context) error {
+		token, err := sf.thingEventPropertyPackPost(ctx, params)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
 		return err
-	}
-	_, err = token.Wait(timeout)
-	return err
+	})
 }
 
 // LinkThingEventPropertyHistoryPost 物模型历史数据上报,同步
 func (sf *Client) LinkThingEventPropertyHistoryPost(params interface{}, timeout time.Duration) error {
-	token, err := sf.ThingEventPropertyHistoryPost(params)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingEventPropertyHistoryPostContext(ctx, params)
+}
+
+// LinkThingEventPropertyHistoryPostContext 物模型历史数据上报,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingEventPropertyHistoryPostContext(ctx context.Context, params interface{}) error {
+	return sf.doRetry(ctx, infra.MethodEventPropertyHistoryPost, func(ctx context.Context) error {
+		token, err := sf.thingEventPropertyHistoryPost(ctx, params)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
+		return err
+	})
+}
+
+// LinkThingEventPropertyHistoryPostBatch 物模型历史数据上报,按单次上报的限制拆分为多次上报,同步,
+// 某次上报失败时返回 *HistoryBatchError
+func (sf *Client) LinkThingEventPropertyHistoryPostBatch(h *PropertyHistory, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingEventPropertyHistoryPostBatchContext(ctx, h)
+}
+
+// LinkThingEventPropertyHistoryPostBatchContext 物模型历史数据上报,按单次上报的限制拆分为多次上报,
+// 同步,依次上报并等待应答,ctx控制等待超时及取消.
+// 某次上报失败时停止上报, 返回 *HistoryBatchError, 包含已应答的上报次数
+func (sf *Client) LinkThingEventPropertyHistoryPostBatchContext(ctx context.Context, h *PropertyHistory) error {
+	if err := sf.validateHistory(h); err != nil {
+		return err
+	}
+	batches, err := h.Build(sf.historyLimit)
 	if err != nil {
 		return err
 	}
-	_, err = token.Wait(timeout)
-	return err
+	for i, params := range batches {
+		if err = sf.LinkThingEventPropertyHistoryPostContext(ctx, params); err != nil {
+			return &HistoryBatchError{i, len(batches), err}
+		}
+	}
+	return nil
 }
 
 /**************************************** desired *****************************/
@@ -73,239 +150,412 @@ func (sf *Client) LinkThingEventPropertyHistoryPost(params interface{}, timeout
 // LinkThingDesiredPropertyGet 获取期望属性值,同步
 func (sf *Client) LinkThingDesiredPropertyGet(pk, dn string,
 	params []string, timeout time.Duration) (json.RawMessage, error) {
-	token, err := sf.ThingDesiredPropertyGet(pk, dn, params)
-	if err != nil {
-		return nil, err
-	}
-	msg, err := token.Wait(timeout)
-	if err != nil {
-		return nil, err
-	}
-	return msg.Data.(json.RawMessage), nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingDesiredPropertyGetContext(ctx, pk, dn, params)
+}
+
+// LinkThingDesiredPropertyGetContext 获取期望属性值,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingDesiredPropertyGetContext(ctx context.Context, pk, dn string,
+	params []string) (json.RawMessage, error) {
+	var data json.RawMessage
+	err := sf.doRetry(ctx, infra.MethodDesiredPropertyGet, func(ctx context.Context) error {
+		token, err := sf.thingDesiredPropertyGet(ctx, pk, dn, params)
+		if err != nil {
+			return err
+		}
+		msg, err := token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		data = msg.Data.(json.RawMessage)
+		return nil
+	})
+	return data, err
 }
 
 // LinkThingDesiredPropertyDelete 清空期望属性值,同步
 func (sf *Client) LinkThingDesiredPropertyDelete(pk, dn string, params interface{}, timeout time.Duration) error {
-	token, err := sf.ThingDesiredPropertyDelete(pk, dn, params)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingDesiredPropertyDeleteContext(ctx, pk, dn, params)
+}
+
+// LinkThingDesiredPropertyDeleteContext 清空期望属性值,同步,ctx控制等待超时及取消
+// 成功后从设备影子中删除对应的期望值
+func (sf *Client) LinkThingDesiredPropertyDeleteContext(ctx context.Context, pk, dn string, params interface{}) error {
+	return sf.doRetry(ctx, infra.MethodDesiredPropertyDelete, func(ctx context.Context) error {
+		token, err := sf.thingDesiredPropertyDelete(ctx, pk, dn, params)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
 		return err
-	}
-	_, err = token.Wait(timeout)
-	return err
+	})
 }
 
 /**************************************** label *****************************/
 
 // LinkThingDeviceInfoUpdate 设备信息上传(如厂商,设备型号等,可以保存为设备标签),同步
 func (sf *Client) LinkThingDeviceInfoUpdate(pk, dn string, params []DeviceInfoLabel, timeout time.Duration) error {
-	token, err := sf.ThingDeviceInfoUpdate(pk, dn, params)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingDeviceInfoUpdateContext(ctx, pk, dn, params)
+}
+
+// LinkThingDeviceInfoUpdateContext 设备信息上传,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingDeviceInfoUpdateContext(ctx context.Context, pk, dn string, params []DeviceInfoLabel) error {
+	return sf.doRetry(ctx, infra.MethodDeviceInfoUpdate, func(ctx context.Context) error {
+		token, err := sf.thingDeviceInfoUpdate(ctx, pk, dn, params)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
 		return err
-	}
-	_, err = token.Wait(timeout)
-	return err
+	})
 }
 
 // LinkThingDeviceInfoDelete 删除标签信息.同步
 func (sf *Client) LinkThingDeviceInfoDelete(pk, dn string, params []DeviceLabelKey, timeout time.Duration) error {
-	token, err := sf.ThingDeviceInfoDelete(pk, dn, params)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingDeviceInfoDeleteContext(ctx, pk, dn, params)
+}
+
+// LinkThingDeviceInfoDeleteContext 删除标签信息.同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingDeviceInfoDeleteContext(ctx context.Context, pk, dn string, params []DeviceLabelKey) error {
+	return sf.doRetry(ctx, infra.MethodDeviceInfoDelete, func(ctx context.Context) error {
+		token, err := sf.thingDeviceInfoDelete(ctx, pk, dn, params)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
 		return err
-	}
-	_, err = token.Wait(timeout)
-	return err
+	})
 }
 
 /**************************************** template *****************************/
 
 // LinkThingDsltemplateGet 设备可以通过上行请求获取设备的TSL模板(包含属性、服务和事件的定义),同步
 func (sf *Client) LinkThingDsltemplateGet(pk, dn string, timeout time.Duration) (json.RawMessage, error) {
-	token, err := sf.ThingDsltemplateGet(pk, dn)
-	if err != nil {
-		return nil, err
-	}
-	msg, err := token.Wait(timeout)
-	if err != nil {
-		return nil, err
-	}
-	return msg.Data.(json.RawMessage), nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingDsltemplateGetContext(ctx, pk, dn)
+}
+
+// LinkThingDsltemplateGetContext 获取设备的TSL模板,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingDsltemplateGetContext(ctx context.Context, pk, dn string) (json.RawMessage, error) {
+	var data json.RawMessage
+	err := sf.doRetry(ctx, infra.MethodDslTemplateGet, func(ctx context.Context) error {
+		token, err := sf.thingDsltemplateGet(ctx, pk, dn)
+		if err != nil {
+			return err
+		}
+		msg, err := token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		data = msg.Data.(json.RawMessage)
+		return nil
+	})
+	return data, err
 }
 
 // LinkThingDynamictslGet 获取动态tsl,同步
 func (sf *Client) LinkThingDynamictslGet(pk, dn string, timeout time.Duration) (json.RawMessage, error) {
-	token, err := sf.ThingDynamictslGet(pk, dn)
-	if err != nil {
-		return nil, err
-	}
-	msg, err := token.Wait(timeout)
-	if err != nil {
-		return nil, err
-	}
-	return msg.Data.(json.RawMessage), nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingDynamictslGetContext(ctx, pk, dn)
+}
+
+// LinkThingDynamictslGetContext 获取动态tsl,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingDynamictslGetContext(ctx context.Context, pk, dn string) (json.RawMessage, error) {
+	var data json.RawMessage
+	err := sf.doRetry(ctx, infra.MethodDynamicTslGet, func(ctx context.Context) error {
+		token, err := sf.thingDynamictslGet(ctx, pk, dn)
+		if err != nil {
+			return err
+		}
+		msg, err := token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		data = msg.Data.(json.RawMessage)
+		return nil
+	})
+	return data, err
 }
 
 // LinkThingConfigLogGet 获取日志配置,同步
 func (sf *Client) LinkThingConfigLogGet(pk, dn string,
 	clp ConfigLogParam, timeout time.Duration) (ConfigLogParamData, error) {
-	token, err := sf.ThingConfigLogGet(pk, dn, clp)
-	if err != nil {
-		return ConfigLogParamData{}, err
-	}
-	msg, err := token.Wait(timeout)
-	if err != nil {
-		return ConfigLogParamData{}, err
-	}
-	return msg.Data.(ConfigLogParamData), nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingConfigLogGetContext(ctx, pk, dn, clp)
+}
+
+// LinkThingConfigLogGetContext 获取日志配置,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingConfigLogGetContext(ctx context.Context, pk, dn string,
+	clp ConfigLogParam) (ConfigLogParamData, error) {
+	var data ConfigLogParamData
+	err := sf.doRetry(ctx, infra.MethodConfigLogGet, func(ctx context.Context) error {
+		token, err := sf.thingConfigLogGet(ctx, pk, dn, clp)
+		if err != nil {
+			return err
+		}
+		msg, err := token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		data = msg.Data.(ConfigLogParamData)
+		return nil
+	})
+	return data, err
 }
 
 // LinkThingLogPost 设备上报日志内容,同步
 func (sf *Client) LinkThingLogPost(pk, dn string, lp []LogParam, timeout time.Duration) error {
-	token, err := sf.ThingLogPost(pk, dn, lp)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingLogPostContext(ctx, pk, dn, lp)
+}
+
+// LinkThingLogPostContext 设备上报日志内容,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingLogPostContext(ctx context.Context, pk, dn string, lp []LogParam) error {
+	return sf.doRetry(ctx, infra.MethodLogPost, func(ctx context.Context) error {
+		token, err := sf.thingLogPost(ctx, pk, dn, lp)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
 		return err
-	}
-	_, err = token.Wait(timeout)
-	return err
+	})
 }
 
 /**************************************** reqister *****************************/
 
 // LinkThingSubRegister 同步子设备注册,
 func (sf *Client) LinkThingSubRegister(pk, dn string, timeout time.Duration) ([]SubRegisterData, error) {
-	token, err := sf.thingSubRegister(pk, dn)
-	if err != nil {
-		return nil, err
-	}
-	msg, err := token.Wait(timeout)
-	if err != nil {
-		return nil, err
-	}
-	data := msg.Data.([]SubRegisterData)
-	for _, v := range msg.Data.([]SubRegisterData) {
-		sf.SetDeviceSecret(v.ProductKey, v.DeviceName, v.DeviceSecret)      // nolint: errcheck
-		sf.SetDeviceStatus(v.ProductKey, v.DeviceName, DevStatusRegistered) // nolint: errcheck
-	}
-	return data, nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingSubRegisterContext(ctx, pk, dn)
+}
+
+// LinkThingSubRegisterContext 同步子设备注册,ctx控制等待超时及取消
+func (sf *Client) LinkThingSubRegisterContext(ctx context.Context, pk, dn string) ([]SubRegisterData, error) {
+	var data []SubRegisterData
+	err := sf.doRetry(ctx, infra.MethodSubDevRegister, func(ctx context.Context) error {
+		token, err := sf.thingSubRegister(ctx, pk, dn)
+		if err != nil {
+			return err
+		}
+		msg, err := token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		for _, v := range msg.Data.([]SubRegisterData) {
+			sf.SetDeviceSecret(v.ProductKey, v.DeviceName, v.DeviceSecret)      // nolint: errcheck
+			sf.SetDeviceStatus(v.ProductKey, v.DeviceName, DevStatusRegistered) // nolint: errcheck
+		}
+		data = msg.Data.([]SubRegisterData)
+		return nil
+	})
+	return data, err
 }
 
 /**************************************** network *****************************/
 
 // LinkThingTopoAdd 添加设备拓扑关系,同步
 func (sf *Client) LinkThingTopoAdd(pk, dn string, timeout time.Duration) error {
-	token, err := sf.thingTopoAdd(pk, dn)
-	if err != nil {
-		return err
-	}
-	msg, err := token.Wait(timeout)
-	if err != nil {
-		return err
-	}
-	for _, pair := range msg.Data.([]infra.MetaPair) {
-		sf.SetDeviceStatus(pair.ProductKey, pair.DeviceName, DevStatusAttached) // nolint: errcheck
-	}
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingTopoAddContext(ctx, pk, dn)
+}
+
+// LinkThingTopoAddContext 添加设备拓扑关系,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingTopoAddContext(ctx context.Context, pk, dn string) error {
+	return sf.doRetry(ctx, infra.MethodTopoAdd, func(ctx context.Context) error {
+		token, err := sf.thingTopoAdd(ctx, pk, dn)
+		if err != nil {
+			return err
+		}
+		msg, err := token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		for _, pair := range msg.Data.([]infra.MetaPair) {
+			sf.SetDeviceStatus(pair.ProductKey, pair.DeviceName, DevStatusAttached) // nolint: errcheck
+		}
+		return nil
+	})
 }
 
 // LinkThingTopoDelete 删除网关与子设备的拓扑关系
 func (sf *Client) LinkThingTopoDelete(pk, dn string, timeout time.Duration) error {
-	token, err := sf.thingTopoDelete(pk, dn)
-	if err != nil {
-		return err
-	}
-	msg, err := token.Wait(timeout)
-	if err != nil {
-		return err
-	}
-	for _, pair := range msg.Data.([]infra.MetaPair) {
-		sf.SetDeviceStatus(pair.ProductKey, pair.DeviceName, DevStatusRegistered) // nolint: errcheck
-	}
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingTopoDeleteContext(ctx, pk, dn)
+}
+
+// LinkThingTopoDeleteContext 删除网关与子设备的拓扑关系,ctx控制等待超时及取消
+func (sf *Client) LinkThingTopoDeleteContext(ctx context.Context, pk, dn string) error {
+	return sf.doRetry(ctx, infra.MethodTopoDelete, func(ctx context.Context) error {
+		token, err := sf.thingTopoDelete(ctx, pk, dn)
+		if err != nil {
+			return err
+		}
+		msg, err := token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		for _, pair := range msg.Data.([]infra.MetaPair) {
+			sf.SetDeviceStatus(pair.ProductKey, pair.DeviceName, DevStatusRegistered) // nolint: errcheck
+		}
+		return nil
+	})
 }
 
 // LinkThingTopoGet 获取该网关和子设备的拓扑关系,同步
 func (sf *Client) LinkThingTopoGet(timeout time.Duration) ([]infra.MetaPair, error) {
-	token, err := sf.ThingTopoGet()
-	if err != nil {
-		return nil, err
-	}
-	msg, err := token.Wait(timeout)
-	if err != nil {
-		return nil, err
-	}
-	return msg.Data.([]infra.MetaPair), err
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingTopoGetContext(ctx)
+}
+
+// LinkThingTopoGetContext 获取该网关和子设备的拓扑关系,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingTopoGetContext(ctx context.Context) ([]infra.MetaPair, error) {
+	var data []infra.MetaPair
+	err := sf.doRetry(ctx, infra.MethodTopoGet, func(ctx context.Context) error {
+		token, err := sf.thingTopoGet(ctx)
+		if err != nil {
+			return err
+		}
+		msg, err := token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		data = msg.Data.([]infra.MetaPair)
+		return nil
+	})
+	return data, err
 }
 
 // LinkThingListFound 发现设备列表上报,同步
 func (sf *Client) LinkThingListFound(pairs []infra.MetaPair, timeout time.Duration) error {
-	token, err := sf.ThingListFound(pairs)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingListFoundContext(ctx, pairs)
+}
+
+// LinkThingListFoundContext 发现设备列表上报,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingListFoundContext(ctx context.Context, pairs []infra.MetaPair) error {
+	return sf.doRetry(ctx, infra.MethodListFound, func(ctx context.Context) error {
+		token, err := sf.thingListFound(ctx, pairs)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
 		return err
-	}
-	_, err = token.Wait(timeout)
-	return err
+	})
 }
 
 /**************************************** session *****************************/
 
 // LinkExtCombineLogin 子设备上线,同步
 func (sf *Client) LinkExtCombineLogin(cp CombinePair, timeout time.Duration) error {
-	token, err := sf.extCombineLogin(cp)
-	if err != nil {
-		return err
-	}
-	_, err = token.Wait(timeout)
-	if err != nil {
-		return err
-	}
-	sf.SetDeviceStatus(cp.ProductKey, cp.DeviceName, DevStatusLogined) // nolint: errcheck
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkExtCombineLoginContext(ctx, cp)
+}
+
+// LinkExtCombineLoginContext 子设备上线,同步,ctx控制等待超时及取消
+func (sf *Client) LinkExtCombineLoginContext(ctx context.Context, cp CombinePair) error {
+	return sf.doRetry(ctx, infra.MethodCombineLogin, func(ctx context.Context) error {
+		token, err := sf.extCombineLogin(ctx, cp)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		sf.SetDeviceStatus(cp.ProductKey, cp.DeviceName, DevStatusLogined) // nolint: errcheck
+		return nil
+	})
 }
 
 // LinkExtCombineBatchLogin 子设备批量上线,同步
 func (sf *Client) LinkExtCombineBatchLogin(pairs []CombinePair, timeout time.Duration) error {
-	token, err := sf.extCombineBatchLogin(pairs)
-	if err != nil {
-		return err
-	}
-	_, err = token.Wait(timeout)
-	if err != nil {
-		return err
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkExtCombineBatchLoginContext(ctx, pairs)
+}
 
-	for _, cp := range pairs {
-		sf.SetDeviceStatus(cp.ProductKey, cp.DeviceName, DevStatusLogined) // nolint: errcheck
-	}
-	return nil
+// LinkExtCombineBatchLoginContext 子设备批量上线,同步,ctx控制等待超时及取消
+func (sf *Client) LinkExtCombineBatchLoginContext(ctx context.Context, pairs []CombinePair) error {
+	return sf.doRetry(ctx, infra.MethodCombineBatchLogin, func(ctx context.Context) error {
+		token, err := sf.extCombineBatchLogin(ctx, pairs)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, cp := range pairs {
+			sf.SetDeviceStatus(cp.ProductKey, cp.DeviceName, DevStatusLogined) // nolint: errcheck
+		}
+		return nil
+	})
 }
 
 // LinkExtCombineLogout 子设备下线,同步
 func (sf *Client) LinkExtCombineLogout(pk, dn string, timeout time.Duration) error {
-	token, err := sf.extCombineLogout(pk, dn)
-	if err != nil {
-		return err
-	}
-	_, err = token.Wait(timeout)
-	if err != nil {
-		return err
-	}
-	sf.SetDeviceStatus(pk, dn, DevStatusAttached) // nolint: errcheck
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkExtCombineLogoutContext(ctx, pk, dn)
+}
+
+// LinkExtCombineLogoutContext 子设备下线,同步,ctx控制等待超时及取消
+func (sf *Client) LinkExtCombineLogoutContext(ctx context.Context, pk, dn string) error {
+	return sf.doRetry(ctx, infra.MethodCombineLogout, func(ctx context.Context) error {
+		token, err := sf.extCombineLogout(ctx, pk, dn)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		sf.SetDeviceStatus(pk, dn, DevStatusAttached) // nolint: errcheck
+		return nil
+	})
 }
 
 // LinkExtCombineBatchLogout 子设备批量下线,同步
 func (sf *Client) LinkExtCombineBatchLogout(pairs []infra.MetaPair, timeout time.Duration) error {
-	token, err := sf.extCombineBatchLogout(pairs)
-	if err != nil {
-		return err
-	}
-	_, err = token.Wait(timeout)
-	if err != nil {
-		return err
-	}
-	for _, cp := range pairs {
-		sf.SetDeviceStatus(cp.ProductKey, cp.DeviceName, DevStatusAttached) // nolint: errcheck
-	}
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkExtCombineBatchLogoutContext(ctx, pairs)
+}
+
+// LinkExtCombineBatchLogoutContext 子设备批量下线,同步,ctx控制等待超时及取消
+func (sf *Client) LinkExtCombineBatchLogoutContext(ctx context.Context, pairs []infra.MetaPair) error {
+	return sf.doRetry(ctx, infra.MethodCombineBatchLogout, func(ctx context.Context) error {
+		token, err := sf.extCombineBatchLogout(ctx, pairs)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		for _, cp := range pairs {
+			sf.SetDeviceStatus(cp.ProductKey, cp.DeviceName, DevStatusAttached) // nolint: errcheck
+		}
+		return nil
+	})
 }
 
 /**************************************** ota *****************************/
@@ -313,35 +563,66 @@ func (sf *Client) LinkExtCombineBatchLogout(pairs []infra.MetaPair, timeout time
 // LinkThingOtaFirmwareGet 请求固件信息,同步
 func (sf *Client) LinkThingOtaFirmwareGet(pk, dn string,
 	param OtaFirmwareParam, timeout time.Duration) (OtaFirmwareData, error) {
-	token, err := sf.ThingOtaFirmwareGet(pk, dn, param)
-	if err != nil {
-		return OtaFirmwareData{}, err
-	}
-	msg, err := token.Wait(timeout)
-	if err != nil {
-		return OtaFirmwareData{}, err
-	}
-	return msg.Data.(OtaFirmwareData), nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingOtaFirmwareGetContext(ctx, pk, dn, param)
+}
+
+// LinkThingOtaFirmwareGetContext 请求固件信息,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingOtaFirmwareGetContext(ctx context.Context, pk, dn string,
+	param OtaFirmwareParam) (OtaFirmwareData, error) {
+	var data OtaFirmwareData
+	err := sf.doRetry(ctx, infra.MethodOtaFirmwareGet, func(ctx context.Context) error {
+		token, err := sf.thingOtaFirmwareGet(ctx, pk, dn, param)
+		if err != nil {
+			return err
+		}
+		msg, err := token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		data = msg.Data.(OtaFirmwareData)
+		return nil
+	})
+	return data, err
 }
 
 /**************************************** diag *****************************/
 
 // LinkThingDiagPost 设备主动上报当前网络状态,同步
 func (sf *Client) LinkThingDiagPost(pk, dn string, p P, timeout time.Duration) error {
-	token, err := sf.ThingDiagPost(pk, dn, p)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingDiagPostContext(ctx, pk, dn, p)
+}
+
+// LinkThingDiagPostContext 设备主动上报当前网络状态,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingDiagPostContext(ctx context.Context, pk, dn string, p P) error {
+	return sf.doRetry(ctx, infra.MethodDiagPost, func(ctx context.Context) error {
+		token, err := sf.thingDiagPost(ctx, pk, dn, p, true)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
 		return err
-	}
-	_, err = token.Wait(timeout)
-	return err
+	})
 }
 
 // LinkThingDiagHistoryPost 设备主动上报历史网络状态,同步
 func (sf *Client) LinkThingDiagHistoryPost(pk, dn string, p []P, timeout time.Duration) error {
-	token, err := sf.ThingDiagHistoryPost(pk, dn, p)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.LinkThingDiagHistoryPostContext(ctx, pk, dn, p)
+}
+
+// LinkThingDiagHistoryPostContext 设备主动上报历史网络状态,同步,ctx控制等待超时及取消
+func (sf *Client) LinkThingDiagHistoryPostContext(ctx context.Context, pk, dn string, p []P) error {
+	return sf.doRetry(ctx, infra.MethodDiagPost, func(ctx context.Context) error {
+		token, err := sf.thingDiagHistoryPost(ctx, pk, dn, p)
+		if err != nil {
+			return err
+		}
+		_, err = token.WaitContext(ctx)
 		return err
-	}
-	_, err = token.Wait(timeout)
-	return err
+	})
 }
@@ -7,13 +7,18 @@ package aiot
 import (
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/things-go/aliyun-iot/logger"
+	"github.com/things-go/aliyun-iot/tsl"
 )
 
 // Option 配置选项
 type Option func(*Client)
 
 // WithCache 设备消息缓存超时时间
+// expiration: 无等待者的请求的过期时间,有等待者时由等待者的超时决定
+// cleanupInterval: 过期请求的清理间隔
 func WithCache(expiration, cleanupInterval time.Duration) Option {
 	return func(c *Client) {
 		c.cacheExpiration = expiration
@@ -49,13 +54,39 @@ func WithEnableModelRaw() Option {
 	}
 }
 
-// WithEnableDesired 使能期望属性
+// WithRawCodec 设置透传模式下产品的二进制帧编解码, pk为空时为所有产品的默认编解码,
+// 需同时使能 WithEnableModelRaw, 见 RawCodec
+func WithRawCodec(pk string, codec RawCodec) Option {
+	return func(c *Client) {
+		if c.rawCodecs == nil {
+			c.rawCodecs = make(map[string]RawCodec)
+		}
+		c.rawCodecs[pk] = codec
+	}
+}
+
+// WithEnableDesired 使能期望属性及期望属性同步, 见 HandleDesired
 func WithEnableDesired() Option {
 	return func(c *Client) {
 		c.hasDesired = true
 	}
 }
 
+// WithDesiredRetryPolicy 设置期望属性同步失败(含应用函数返回错误)后的重试策略
+// AttemptTimeout 为每次同步的超时时间, 默认最多尝试 DefaultDesiredRetryMaxAttempts 次
+func WithDesiredRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.desired.policy = p
+	}
+}
+
+// WithPropertySetRepost 属性设置成功后,通过属性上报重新上报设置成功的属性值, 见 HandlePropertySet
+func WithPropertySetRepost() Option {
+	return func(c *Client) {
+		c.propertySetRepost = true
+	}
+}
+
 // WithEnableExtRRPC 使能扩展RRPC功能
 func WithEnableExtRRPC() Option {
 	return func(c *Client) {
@@ -84,7 +115,60 @@ func WithEnableDiag() Option {
 	}
 }
 
-// WithCallback 设置事件处理接口
+// WithOrphanReply 设置未找到等待者的回复的处理函数,如迟到的回复或未知ID的回复
+func WithOrphanReply(f OrphanReply) Option {
+	return func(c *Client) {
+		c.orphanReply = f
+	}
+}
+
+// WithRetryPolicy 设置Link*同步调用的全局重试策略,默认不重试
+// Link*的timeout或ctx为整体超时,每次尝试的超时由 RetryPolicy.AttemptTimeout 决定
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicyDefault = &p
+	}
+}
+
+// WithMethodRetryPolicy 设置指定方法的重试策略,优先于全局重试策略
+// method: 如 infra.MethodEventPropertyPost, 事件上报为 thing.event.{tsl.event.identifier}.post
+func WithMethodRetryPolicy(method string, p RetryPolicy) Option {
+	return func(c *Client) {
+		c.methodRetryPolicy[method] = &p
+	}
+}
+
+// WithOfflineStore 设置离线队列,设备不在线或发送失败时,属性上报,事件上报,日志上报将存入离线队列,
+// 连接及设备上线后按顺序重发
+func WithOfflineStore(s OfflineStore) Option {
+	return func(c *Client) {
+		c.offline = s
+	}
+}
+
+// WithOfflineHistory 重发离线队列时,将属性上报改写为物模型历史数据上报
+func WithOfflineHistory() Option {
+	return func(c *Client) {
+		c.hasOfflineHistory = true
+	}
+}
+
+// WithHistoryLimit 设置物模型历史数据单次上报的限制, 默认 DefaultHistoryLimit,
+// 见 ThingEventPropertyHistoryPostBatch
+func WithHistoryLimit(l HistoryLimit) Option {
+	return func(c *Client) {
+		c.historyLimit = l
+	}
+}
+
+// WithDecoder 注册方法回复data域的解码器, 用于 Call
+func WithDecoder(method string, d Decoder) Option {
+	return func(c *Client) {
+		c.decoders[method] = d
+	}
+}
+
+// WithCallback 设置事件处理接口, 通过 Client.Handle 等注册了处理函数的消息不再调用该接口
 func WithCallback(cb Callback) Option {
 	return func(c *Client) {
 		c.cb = cb
@@ -98,9 +182,54 @@ func WithGwCallback(cb GwCallback) Option {
 	}
 }
 
-// WithLogger 设置日志
+// WithMiddleware 添加下行数据处理中间件, 见 Client.Use
+func WithMiddleware(mws ...Middleware) Option {
+	return func(c *Client) {
+		c.Use(mws...)
+	}
+}
+
+// WithDispatcher 设置下行数据调度器,MQTTClient 收到的下行数据将交由调度器处理,
+// 默认在mqtt的消息回调中直接处理. 调度器需由调用者关闭
+func WithDispatcher(d *Dispatcher) Option {
+	return func(c *Client) {
+		c.dispatcher = d
+	}
+}
+
+// WithMetrics 设置指标接口, 默认为 NopMetrics
+func WithMetrics(m Metrics) Option {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+// WithTracerProvider 使能OpenTelemetry链路追踪
+// 每个 SendRequest 创建一个span, 收到回复,等待超时或取消时结束;
+// 每次下行数据的处理创建一个span
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Client) {
+		c.tracer = tp.Tracer(TracerName)
+	}
+}
+
+// WithLogger 设置日志, 未实现 logger.StructuredLogger 的日志将使用 logger.Wrap 适配
 func WithLogger(l logger.Logger) Option {
 	return func(c *Client) {
-		c.Log = l
+		c.SetLogger(l)
+	}
+}
+
+// WithThingModel 设置物模型,按物模型的 Profile.ProductKey 区分产品,
+// ProductKey为空时作为本设备产品的物模型. 见 Client.SetThingModel
+func WithThingModel(things ...*tsl.Thing) Option {
+	return func(c *Client) {
+		for _, thing := range things {
+			pk := thing.Profile.ProductKey
+			if pk == "" {
+				pk = c.tetrad.ProductKey
+			}
+			c.SetThingModel(pk, thing)
+		}
 	}
 }
@@ -0,0 +1,164 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package aprom 实现aiot.Metrics的prometheus指标
+package aprom
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	aiot "github.com/things-go/aliyun-iot"
+)
+
+// DefaultNamespace 默认指标命名空间
+const DefaultNamespace = "aiot"
+
+// DefaultBuckets 默认回复耗时的直方图分桶,单位秒
+var DefaultBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Option 选项
+type Option func(*config)
+
+type config struct {
+	namespace   string
+	subsystem   string
+	constLabels prometheus.Labels
+	buckets     []float64
+}
+
+// WithNamespace 设置指标命名空间, 默认 DefaultNamespace
+func WithNamespace(namespace string) Option {
+	return func(c *config) {
+		c.namespace = namespace
+	}
+}
+
+// WithSubsystem 设置指标子系统
+func WithSubsystem(subsystem string) Option {
+	return func(c *config) {
+		c.subsystem = subsystem
+	}
+}
+
+// WithConstLabels 设置指标的固定标签,如多个客户端时区分网关
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(c *config) {
+		c.constLabels = labels
+	}
+}
+
+// WithBuckets 设置回复耗时的直方图分桶,单位秒, 默认 DefaultBuckets
+func WithBuckets(buckets []float64) Option {
+	return func(c *config) {
+		c.buckets = buckets
+	}
+}
+
+// Metrics 实现 aiot.Metrics 及 prometheus.Collector 接口
+type Metrics struct {
+	requests        *prometheus.CounterVec
+	replies         *prometheus.CounterVec
+	latency         *prometheus.HistogramVec
+	timeouts        *prometheus.CounterVec
+	publishFailures *prometheus.CounterVec
+	onlineSubDevs   prometheus.Gauge
+}
+
+// 确保 Metrics 实现 aiot.Metrics 及 prometheus.Collector 接口
+var _ aiot.Metrics = (*Metrics)(nil)
+var _ prometheus.Collector = (*Metrics)(nil)
+
+// New 新建prometheus指标,需注册到 prometheus.Registerer
+func New(opts ...Option) *Metrics {
+	c := config{
+		namespace: DefaultNamespace,
+		buckets:   DefaultBuckets,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   c.namespace,
+			Subsystem:   c.subsystem,
+			Name:        name,
+			Help:        help,
+			ConstLabels: c.constLabels,
+		}, labels)
+	}
+	return &Metrics{
+		requests: counter("requests_total", "Number of requests sent, by alink method.", "method"),
+		replies:  counter("replies_total", "Number of replies received, by alink method and code.", "method", "code"),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   c.namespace,
+			Subsystem:   c.subsystem,
+			Name:        "reply_latency_seconds",
+			Help:        "Latency from request sent to reply received, by alink method.",
+			ConstLabels: c.constLabels,
+			Buckets:     c.buckets,
+		}, []string{"method"}),
+		timeouts:        counter("wait_timeouts_total", "Number of reply wait timeouts, by alink method.", "method"),
+		publishFailures: counter("publish_failures_total", "Number of failed publishes, by alink method.", "method"),
+		onlineSubDevs: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   c.namespace,
+			Subsystem:   c.subsystem,
+			Name:        "online_sub_devices",
+			Help:        "Number of online sub devices.",
+			ConstLabels: c.constLabels,
+		}),
+	}
+}
+
+// IncRequest see interface aiot.Metrics
+func (sf *Metrics) IncRequest(method string) {
+	sf.requests.WithLabelValues(method).Inc()
+}
+
+// IncReply see interface aiot.Metrics
+func (sf *Metrics) IncReply(method string, code int) {
+	sf.replies.WithLabelValues(method, strconv.Itoa(code)).Inc()
+}
+
+// ObserveLatency see interface aiot.Metrics
+func (sf *Metrics) ObserveLatency(method string, d time.Duration) {
+	sf.latency.WithLabelValues(method).Observe(d.Seconds())
+}
+
+// IncTimeout see interface aiot.Metrics
+func (sf *Metrics) IncTimeout(method string) {
+	sf.timeouts.WithLabelValues(method).Inc()
+}
+
+// IncPublishFailure see interface aiot.Metrics
+func (sf *Metrics) IncPublishFailure(method string) {
+	sf.publishFailures.WithLabelValues(method).Inc()
+}
+
+// SetOnlineSubDevices see interface aiot.Metrics
+func (sf *Metrics) SetOnlineSubDevices(n int) {
+	sf.onlineSubDevs.Set(float64(n))
+}
+
+// Describe see interface prometheus.Collector
+func (sf *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	sf.requests.Describe(ch)
+	sf.replies.Describe(ch)
+	sf.latency.Describe(ch)
+	sf.timeouts.Describe(ch)
+	sf.publishFailures.Describe(ch)
+	sf.onlineSubDevs.Describe(ch)
+}
+
+// Collect see interface prometheus.Collector
+func (sf *Metrics) Collect(ch chan<- prometheus.Metric) {
+	sf.requests.Collect(ch)
+	sf.replies.Collect(ch)
+	sf.latency.Collect(ch)
+	sf.timeouts.Collect(ch)
+	sf.publishFailures.Collect(ch)
+	sf.onlineSubDevs.Collect(ch)
+}
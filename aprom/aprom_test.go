@@ -0,0 +1,49 @@
+package aprom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New(WithConstLabels(prometheus.Labels{"gateway": "gw"}))
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(m))
+
+	m.IncRequest("thing.event.property.post")
+	m.IncRequest("thing.event.property.post")
+	m.IncReply("thing.event.property.post", 200)
+	m.IncReply("thing.event.property.post", 460)
+	m.ObserveLatency("thing.event.property.post", 30*time.Millisecond)
+	m.IncTimeout("thing.config.get")
+	m.IncPublishFailure("thing.config.get")
+	m.SetOnlineSubDevices(3)
+
+	expected := `
+# HELP aiot_requests_total Number of requests sent, by alink method.
+# TYPE aiot_requests_total counter
+aiot_requests_total{gateway="gw",method="thing.event.property.post"} 2
+# HELP aiot_replies_total Number of replies received, by alink method and code.
+# TYPE aiot_replies_total counter
+aiot_replies_total{code="200",gateway="gw",method="thing.event.property.post"} 1
+aiot_replies_total{code="460",gateway="gw",method="thing.event.property.post"} 1
+# HELP aiot_wait_timeouts_total Number of reply wait timeouts, by alink method.
+# TYPE aiot_wait_timeouts_total counter
+aiot_wait_timeouts_total{gateway="gw",method="thing.config.get"} 1
+# HELP aiot_publish_failures_total Number of failed publishes, by alink method.
+# TYPE aiot_publish_failures_total counter
+aiot_publish_failures_total{gateway="gw",method="thing.config.get"} 1
+# HELP aiot_online_sub_devices Number of online sub devices.
+# TYPE aiot_online_sub_devices gauge
+aiot_online_sub_devices{gateway="gw"} 3
+`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"aiot_requests_total", "aiot_replies_total", "aiot_wait_timeouts_total",
+		"aiot_publish_failures_total", "aiot_online_sub_devices"))
+	require.Equal(t, 1, testutil.CollectAndCount(m.latency))
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+// Decoder 解码回复的data域, 用于库未内置的方法或特殊格式的data域
+type Decoder func(data json.RawMessage) (interface{}, error)
+
+// Call 发送请求并等待回复,将回复的data域解码为Resp
+// _uri: 请求的topic
+// method: 请求方法
+// params: 请求的params域
+// 对于库未内置的方法,需先调用 Client.SubscribeReply 订阅其回复topic
+// 解码优先级: 回复的data已是Resp类型 > WithDecoder 注册的解码器 > json解码
+func Call[Req, Resp any](ctx context.Context, c *Client, _uri, method string, params Req) (Resp, error) {
+	var resp Resp
+
+	err := c.doRetry(ctx, method, func(ctx context.Context) error {
+		token, err := c.SendRequestContext(ctx, _uri, method, params)
+		if err != nil {
+			return err
+		}
+		msg, err := token.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		resp, err = decodeData[Resp](c, method, msg.Data)
+		return err
+	})
+	return resp, err
+}
+
+// decodeData 将回复的data域解码为T
+func decodeData[T any](c *Client, method string, data interface{}) (T, error) {
+	var v T
+
+	if data == nil {
+		return v, nil
+	}
+	if d, ok := data.(T); ok {
+		return d, nil
+	}
+	raw, ok := data.(json.RawMessage)
+	if !ok {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return v, err
+		}
+		raw = b
+	}
+	if dec, ok := c.decoders[method]; ok {
+		d, err := dec(raw)
+		if err != nil {
+			return v, err
+		}
+		if v, ok = d.(T); !ok {
+			return v, fmt.Errorf("decoder of %s returned %T, want %T", method, d, v)
+		}
+		return v, nil
+	}
+	if len(raw) == 0 {
+		return v, nil
+	}
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+// SubscribeReply 订阅自定义方法的回复topic, 回复将交由 Call 或 Token 处理
+func (sf *Client) SubscribeReply(replyURI string) error {
+	return sf.subscribe(replyURI, ProcReplyRawData)
+}
+
+// ProcReplyRawData 处理通用回复,data域以json.RawMessage的形式传递给等待者
+// response:  由调用者决定,通常为请求topic加 _reply 后缀
+// subscribe: 同response
+func ProcReplyRawData(c *Client, rawURI string, payload []byte) error {
+	uris := uri.Spilt(rawURI)
+	if len(uris) < 2 {
+		return ErrInvalidURI
+	}
+	rsp := &ResponseRawData{}
+	err := json.Unmarshal(payload, rsp)
+	if err != nil {
+		return err
+	}
+	if rsp.Code != infra.CodeSuccess {
+		err = infra.NewCodeError(rsp.Code, rsp.Message)
+	}
+	c.signalPending(Message{rsp.ID, dupJSONRawMessage(rsp.Data), err})
+	c.StructuredLog().Debug("reply", "requestID", rsp.ID, "topic", rawURI)
+	return nil
+}
@@ -0,0 +1,74 @@
+package aiot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+type customParams struct {
+	Name string `json:"name"`
+}
+
+type customData struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestCall(t *testing.T) {
+	const method = "thing.custom.hello"
+	const topic = "/sys/pk/dn/thing/custom/hello"
+
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn)
+	conn.onPublish = func(topic string, payload []byte) {
+		req := struct {
+			ID     uint         `json:"id,string"`
+			Params customParams `json:"params"`
+		}{}
+		if json.Unmarshal(payload, &req) != nil {
+			return
+		}
+		rsp := fmt.Sprintf(`{"id":"%d","code":200,"data":{"greeting":"hello %s"}}`, req.ID, req.Params.Name)
+		if req.Params.Name == "bad" {
+			rsp = fmt.Sprintf(`{"id":"%d","code":460,"message":"bad params"}`, req.ID)
+		}
+		ProcReplyRawData(c, topic+"_reply", []byte(rsp)) // nolint: errcheck
+	}
+
+	require.NoError(t, c.SubscribeReply(topic+"_reply"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	data, err := Call[customParams, customData](ctx, c, topic, method, customParams{"world"})
+	require.NoError(t, err)
+	require.Equal(t, "hello world", data.Greeting)
+
+	_, err = Call[customParams, customData](ctx, c, topic, method, customParams{"bad"})
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "460"))
+}
+
+func TestCallDecoder(t *testing.T) {
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, newMockConn(),
+		WithDecoder("thing.custom.text", func(data json.RawMessage) (interface{}, error) {
+			var s string
+			if err := json.Unmarshal(data, &s); err != nil {
+				return nil, err
+			}
+			return customData{Greeting: s}, nil
+		}))
+
+	v, err := decodeData[customData](c, "thing.custom.text", json.RawMessage(`"hi"`))
+	require.NoError(t, err)
+	require.Equal(t, customData{"hi"}, v)
+
+	_, err = decodeData[string](c, "thing.custom.text", json.RawMessage(`"hi"`))
+	require.Error(t, err)
+}
@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 	"sync/atomic"
 
@@ -21,32 +22,92 @@ func (sf *Client) nextRequestID() uint {
 // requestID: 请求ID
 // method: 方法
 // params: 消息体Request的params
-func (sf *Client) Request(_uri string, requestID uint, method string, params interface{}) error {
-	out, err := json.Marshal(&Request{requestID, sf.version, params, method})
+// opts: 单次请求选项,见 WithQoS, WithAck
+func (sf *Client) Request(_uri string, requestID uint, method string, params interface{}, opts ...RequestOption) error {
+	return sf.request(_uri, requestID, method, params, newRequestOptions(opts...))
+}
+
+func (sf *Client) request(_uri string, requestID uint, method string, params interface{}, o requestOptions) error {
+	req := &Request{requestID, sf.version, params, method, o.sys()}
+	if ok, err := sf.requestRaw(_uri, req, o.qos); ok {
+		return err
+	}
+	out, err := json.Marshal(req)
 	if err != nil {
 		return err
 	}
-	return sf.Publish(_uri, 1, out)
+	return sf.Publish(_uri, o.qos, out)
 }
 
 // SendRequest 发送请求,API内部已实现json序列化,requestID内部生成
 // _uri 唯一定位服务器或(topic)
 // method: 方法
 // params: 消息体Request的params
-func (sf *Client) SendRequest(_uri, method string, params interface{}) (*Token, error) {
+// opts: 单次请求选项,见 WithQoS, WithAck. 不需要回复时返回的Token在发布成功后即完成
+func (sf *Client) SendRequest(_uri, method string, params interface{}, opts ...RequestOption) (*Token, error) {
+	return sf.sendRequest(context.Background(), _uri, method, params, opts...)
+}
+
+// SendRequestContext 同 SendRequest,ctx已完成时不发送请求,直接返回ctx的错误.
+// 返回的Token应使用 Token.WaitContext 等待,ctx取消时将移除缓存中的请求
+// _uri 唯一定位服务器或(topic)
+// method: 方法
+// params: 消息体Request的params
+func (sf *Client) SendRequestContext(ctx context.Context, _uri, method string, params interface{}, opts ...RequestOption) (*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return sf.sendRequest(ctx, _uri, method, params, opts...)
+}
+
+// sendRequest 发送请求, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) sendRequest(ctx context.Context, _uri, method string, params interface{}, opts ...RequestOption) (*Token, error) {
+	o := newRequestOptions(opts...)
+	return sf.send(ctx, _uri, method, o, func(id uint) error {
+		return sf.request(_uri, id, method, params, o)
+	})
+}
+
+// send 生成requestID并以publish发布请求, 需要回复时缓存请求等待回复
+func (sf *Client) send(ctx context.Context, _uri, method string, o requestOptions, publish func(id uint) error) (*Token, error) {
 	id := sf.nextRequestID()
-	sf.Log.Debugf("%s @%d", method, id)
-	if err := sf.Request(_uri, id, method, params); err != nil {
+	sf.StructuredLog().Debug(method, "requestID", id, "topic", _uri)
+	span := sf.startRequestSpan(ctx, _uri, method, id)
+	if err := publish(id); err != nil {
+		sf.metrics.IncPublishFailure(method)
+		if span != nil {
+			endSpan(span, err)
+		}
 		return nil, err
 	}
-	return sf.putPending(id), nil
+	if !o.ack {
+		// 云端不会回复,发布成功即完成
+		sf.metrics.IncRequest(method)
+		if span != nil {
+			endSpan(span, nil)
+		}
+		return completedToken(id, method), nil
+	}
+	end := o.end
+	if span != nil {
+		end = func(err error) {
+			endSpan(span, err)
+			if o.end != nil {
+				o.end(err)
+			}
+		}
+	}
+	return sf.putPendingWithEnd(id, method, end), nil
 }
 
 // Response 发送回复
 // _uri 唯一定位服务器或(topic)
 // Response: 回复
-// API内部已实现json序列化
+// API内部已实现json序列化, 设置了 RawCodec 的服务调用回复将编码后通过 down_raw_reply 发送
 func (sf *Client) Response(_uri string, rsp Response) error {
+	if ok, err := sf.responseRaw(_uri, &rsp); ok {
+		return err
+	}
 	out, err := json.Marshal(rsp)
 	if err != nil {
 		return err
@@ -64,127 +125,131 @@ func (sf *Client) SubscribeAllTopic(productKey, deviceName string, isSub bool) e
 	}
 	// model raw
 	_uri = uri.URI(uri.SysPrefix, uri.ThingModelUpRawReply, productKey, deviceName)
-	if err = sf.Subscribe(_uri, ProcThingModelUpRawReply); err != nil {
-		sf.Log.Warnf(err.Error())
+	if err = sf.subscribe(_uri, ProcThingModelUpRawReply); err != nil {
+		sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 	}
 	_uri = uri.URI(uri.SysPrefix, uri.ThingModelDownRaw, productKey, deviceName)
-	if err = sf.Subscribe(_uri, ProcThingModelDownRaw); err != nil {
-		sf.Log.Warnf(err.Error())
+	if err = sf.subscribeContext(_uri, ProcThingModelDownRawContext); err != nil {
+		sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 	}
 
 	// 网络探针
-	if err = sf.Subscribe(uri.ExtNetworkProbe, ProcExtNetworkProbeRequest); err != nil {
-		sf.Log.Warnf(err.Error())
+	if err = sf.subscribe(uri.ExtNetworkProbe, ProcExtNetworkProbeRequest); err != nil {
+		sf.StructuredLog().Warn("subscribe failed", "topic", uri.ExtNetworkProbe, "error", err)
+	}
+	// 自定义topic
+	if err = sf.SubscribeUserTopic(productKey, deviceName); err != nil {
+		sf.StructuredLog().Warn("subscribe user topic failed", "error", err)
 	}
 	// 只使能model raw
 	if !sf.hasRawModel {
 		// desired 期望属性订阅
 		if sf.hasDesired {
 			_uri = uri.URI(uri.SysPrefix, uri.ThingDesiredPropertyGetReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingDesiredPropertyGetReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingDesiredPropertyGetReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 			_uri = uri.URI(uri.SysPrefix, uri.ThingDesiredPropertyDeleteReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingDesiredPropertyDeleteReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingDesiredPropertyDeleteReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 		}
 
 		// ntp订阅, 只有网关和独立设备支持ntp
 		if sf.hasNTP && !isSub {
 			_uri = uri.URI(uri.ExtNtpPrefix, uri.NtpResponse, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcExtNtpResponse); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcExtNtpResponse); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 		}
 
 		// diag
 		if sf.hasDiag && !isSub {
 			_uri = uri.URI(uri.SysPrefix, uri.ThingDiagPostReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingDialPostReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingDialPostReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 		}
 
 		if sf.hasExtRRPC {
-			if err = sf.Subscribe(uri.ExtRRPCWildcardSome, ProcExtRRPCRequest); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(uri.ExtRRPCWildcardSome, ProcExtRRPCRequest); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", uri.ExtRRPCWildcardSome, "error", err)
 			}
 		}
 
 		// event 主题订阅
 		_uri = uri.URI(uri.SysPrefix, uri.ThingEventPostReplyWildcardOne, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingEventPostReply); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcThingEventPostReply); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 
 		// event 主题订阅
 		_uri = uri.URI(uri.SysPrefix, uri.ThingEventPropertyHistoryPostReply, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingEventPropertyHistoryPostReply); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcThingEventPropertyHistoryPostReply); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 
 		// deviceInfo 主题订阅
 		_uri = uri.URI(uri.SysPrefix, uri.ThingDeviceInfoUpdateReply, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingDeviceInfoUpdateReply); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcThingDeviceInfoUpdateReply); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 		_uri = uri.URI(uri.SysPrefix, uri.ThingDeviceInfoDeleteReply, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingDeviceInfoDeleteReply); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcThingDeviceInfoDeleteReply); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 
 		// service
 		_uri = uri.URI(uri.SysPrefix, uri.ThingServiceRequestWildcardSome, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingServiceRequest); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribeContext(_uri, ProcThingServiceRequestContext); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 
 		// dsltemplate 订阅
 		_uri = uri.URI(uri.SysPrefix, uri.ThingDslTemplateGetReply, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingDsltemplateGetReply); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcThingDsltemplateGetReply); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 		// dynamictsl
 		_uri = uri.URI(uri.SysPrefix, uri.ThingDynamicTslGetReply, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingDynamictslGetReply); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcThingDynamictslGetReply); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 
 		// Log
 		_uri = uri.URI(uri.SysPrefix, uri.ThingConfigLogGetReply, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingConfigLogGetReply); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcThingConfigLogGetReply); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 		_uri = uri.URI(uri.SysPrefix, uri.ThingLogPostReply, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingLogPostReply); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcThingLogPostReply); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 		_uri = uri.URI(uri.SysPrefix, uri.ThingConfigLogPush, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingConfigLogPush); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcThingConfigLogPush); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 
 		// RRPC
 		_uri = uri.URI(uri.SysPrefix, uri.RRPCRequestWildcardOne, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcRRPCRequest); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribeContext(_uri, ProcRRPCRequestContext); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 
 		// config 主题订阅
 		_uri = uri.URI(uri.SysPrefix, uri.ThingConfigGetReply, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingConfigGetReply); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcThingConfigGetReply); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 		_uri = uri.URI(uri.SysPrefix, uri.ThingConfigPush, productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcThingConfigPush); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcThingConfigPush); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 
 		// error 订阅
 		_uri = uri.URI(uri.ExtErrorPrefix, "", productKey, deviceName)
-		if err = sf.Subscribe(_uri, ProcExtErrorResponse); err != nil {
-			sf.Log.Warnf(err.Error())
+		if err = sf.subscribe(_uri, ProcExtErrorResponse); err != nil {
+			sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 		}
 	}
 
@@ -192,96 +257,96 @@ func (sf *Client) SubscribeAllTopic(productKey, deviceName string, isSub bool) e
 		if isSub {
 			// 子设备禁用,启用,删除
 			_uri = uri.URI(uri.SysPrefix, uri.ThingDisable, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingDisable); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingDisable); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 			_uri = uri.URI(uri.SysPrefix, uri.ThingEnable, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingEnable); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingEnable); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 			_uri = uri.URI(uri.SysPrefix, uri.ThingDelete, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingDelete); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingDelete); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 		} else {
 			// 子设备动态注册,topic需要用网关的productKey,deviceName
 			_uri = uri.URI(uri.SysPrefix, uri.ThingSubRegisterReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingSubRegisterReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingSubRegisterReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 			// 子设备上线,下线,topic需要用网关的productKey,deviceName,
 			// 使用的是网关的通道,所以子设备不注册相关主题
 			_uri = uri.URI(uri.ExtSessionPrefix, uri.CombineLoginReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcExtCombineLoginReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcExtCombineLoginReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 			_uri = uri.URI(uri.ExtSessionPrefix, uri.CombineLogoutReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcExtCombineLogoutReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcExtCombineLogoutReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 			_uri = uri.URI(uri.ExtSessionPrefix, uri.CombineBatchLoginReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcExtCombineBatchLoginReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcExtCombineBatchLoginReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 			_uri = uri.URI(uri.ExtSessionPrefix, uri.CombineBatchLogoutReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcExtCombineBatchLogoutReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcExtCombineBatchLogoutReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 
 			// 网关批量上报数据,topic需要用网关的productKey,deviceName
 			_uri = uri.URI(uri.SysPrefix, uri.ThingEventPropertyPackPostReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingEventPropertyPackPostReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingEventPropertyPackPostReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 
 			// 添加该网关和子设备的拓扑关系,topic需要用网关的productKey,deviceName
 			_uri = uri.URI(uri.SysPrefix, uri.ThingTopoAddReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingTopoAddReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingTopoAddReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 
 			// 删除该网关和子设备的拓扑关系,topic需要用网关的productKey,deviceName
 			_uri = uri.URI(uri.SysPrefix, uri.ThingTopoDeleteReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingTopoDeleteReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingTopoDeleteReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 
 			// 获取该网关和子设备的拓扑关系,topic需要用网关的productKey,deviceName
 			_uri = uri.URI(uri.SysPrefix, uri.ThingTopoGetReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingTopoGetReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingTopoGetReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 
 			// 发现设备列表上报,topic需要用网关的productKey,deviceName
 			_uri = uri.URI(uri.SysPrefix, uri.ThingListFoundReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingListFoundReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingListFoundReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 
 			// 添加设备拓扑关系通知,topic需要用网关的productKey,deviceName
 			_uri = uri.URI(uri.SysPrefix, uri.ThingTopoAddNotify, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingTopoAddNotify); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingTopoAddNotify); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 
 			// 网关网络拓扑关系变化通知,topic需要用网关的productKey,deviceName
 			_uri = uri.URI(uri.SysPrefix, uri.ThingTopoChange, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingTopoChange); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingTopoChange); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 		}
 		// OTA
 		if sf.hasOTA {
 			// OTA升级通知
 			_uri = uri.URI(uri.OtaDeviceUpgradePrefix, "", productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcOtaUpgrade); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcOtaUpgrade); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 
 			// OTA 固件版本查询应答
 			_uri = uri.URI(uri.SysPrefix, uri.ThingOtaFirmwareGetReply, productKey, deviceName)
-			if err = sf.Subscribe(_uri, ProcThingOtaFirmwareGetReply); err != nil {
-				sf.Log.Warnf(err.Error())
+			if err = sf.subscribe(_uri, ProcThingOtaFirmwareGetReply); err != nil {
+				sf.StructuredLog().Warn("subscribe failed", "topic", _uri, "error", err)
 			}
 		}
 	}
@@ -395,5 +460,9 @@ func (sf *Client) UnSubscribeAllTopic(productKey, deviceName string, isSub bool)
 		// 网络探针
 		uri.ExtNetworkProbe,
 	)
+	// 自定义topic
+	for _, t := range sf.userTopicList() {
+		topicList = append(topicList, t.subscribeTopic(productKey, deviceName))
+	}
 	return sf.UnSubscribe(topicList...)
 }
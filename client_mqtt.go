@@ -5,55 +5,110 @@
 package aiot
 
 import (
-	"log"
+	"sync"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 
 	"github.com/things-go/aliyun-iot/infra"
 )
 
+// 重连恢复会话的默认超时时间
+const (
+	DefaultReloginTimeout     = time.Second * 5 // 子设备批量上线
+	DefaultResubscribeTimeout = time.Second * 5 // 单个主题重新订阅
+)
+
 // MQTTClient MQTT客户端
+// 记录所有订阅,重连后恢复订阅,网关重新上线断线前在线的子设备并重发离线消息
 type MQTTClient struct {
 	c mqtt.Client
 	*Client
+	mu   sync.Mutex
+	subs map[string]ProcDownStream
 }
 
 // 确保 NopCb 实现 dm.Conn 接口
 var _ Conn = (*MQTTClient)(nil)
 
-// NewWithMQTT 新建MQTTClient
+// NewWithMQTT 新建MQTTClient, 推荐使用 NewWithMQTTOptions.
+// 调用者必须将 OnConnectHandler 设置为c的连接回调, 否则重连后无法恢复会话, 且不会重发离线消息及同步期望属性
 func NewWithMQTT(meta infra.MetaTriad, c mqtt.Client, opts ...Option) *MQTTClient {
 	m := New(meta, nil, opts...)
 	cli := &MQTTClient{
-		c,
-		m,
+		c:      c,
+		Client: m,
+		subs:   make(map[string]ProcDownStream),
 	}
 	m.Conn = cli
+	m.session.hooked = true
+	return cli
+}
+
+// NewWithMQTTOptions 使用mqtt配置新建MQTTClient,自动设置连接回调以在重连后恢复会话,
+// 原有的连接回调仍会被调用. 需调用 Underlying().Connect() 连接到服务器
+func NewWithMQTTOptions(meta infra.MetaTriad, mopts *mqtt.ClientOptions, opts ...Option) *MQTTClient {
+	var cli *MQTTClient
+
+	onConnect := mopts.OnConnect
+	mopts.SetOnConnectHandler(func(c mqtt.Client) {
+		cli.OnConnectHandler(c)
+		if onConnect != nil {
+			onConnect(c)
+		}
+	})
+	cli = NewWithMQTT(meta, mqtt.NewClient(mopts), opts...)
 	return cli
 }
 
 // Underlying 获得底层的Client
 func (sf *MQTTClient) Underlying() mqtt.Client { return sf.c }
 
+// OnConnectHandler mqtt连接(含自动重连)成功回调,
+// 恢复所有订阅,网关重新上线断线前在线的子设备,重发离线消息,最后同步期望属性.
+// 调用 Connect 前的连接, 由 Connect 重发离线消息及同步期望属性
+func (sf *MQTTClient) OnConnectHandler(_ mqtt.Client) {
+	sf.mu.Lock()
+	subs := make(map[string]ProcDownStream, len(sf.subs))
+	for topic, streamFunc := range sf.subs {
+		subs[topic] = streamFunc
+	}
+	sf.mu.Unlock()
+
+	for topic, streamFunc := range subs {
+		token := sf.c.Subscribe(topic, 1, sf.messageHandler(streamFunc))
+		if !token.WaitTimeout(DefaultResubscribeTimeout) {
+			sf.StructuredLog().Warn("resubscribe failed", "topic", topic, "error", ErrWaitTimeout)
+		} else if err := token.Error(); err != nil {
+			sf.StructuredLog().Warn("resubscribe failed", "topic", topic, "error", err)
+		}
+	}
+	if sf.isGateway {
+		sf.ReloginSubDevices(DefaultReloginTimeout) // nolint: errcheck
+	}
+	sf.connected()
+}
+
 // Publish 实现dm.Conn接口
 func (sf *MQTTClient) Publish(topic string, qos byte, payload interface{}) error {
 	return sf.c.Publish(topic, qos, false, payload).Error()
 }
 
-// Subscribe 实现dm.Conn接口
+// Subscribe 实现dm.Conn接口, 订阅失败也将被记录,在重连后重新订阅
 func (sf *MQTTClient) Subscribe(topic string, streamFunc ProcDownStream) error {
-	return sf.c.Subscribe(topic, 1, func(client mqtt.Client, message mqtt.Message) {
-		if message.Duplicate() {
-			return
-		}
-		if err := streamFunc(sf.Client, message.Topic(), message.Payload()); err != nil {
-			log.Printf("topic: %s, error: %+v\r\n", message.Topic(), err)
-		}
-	}).Error()
+	sf.mu.Lock()
+	sf.subs[topic] = streamFunc
+	sf.mu.Unlock()
+	return sf.c.Subscribe(topic, 1, sf.messageHandler(streamFunc)).Error()
 }
 
 // UnSubscribe 实现dm.Conn接口
 func (sf *MQTTClient) UnSubscribe(topic ...string) error {
+	sf.mu.Lock()
+	for _, v := range topic {
+		delete(sf.subs, v)
+	}
+	sf.mu.Unlock()
 	return sf.c.Unsubscribe(topic...).Error()
 }
 
@@ -62,3 +117,18 @@ func (sf *MQTTClient) Close() error {
 	sf.c.Disconnect(500)
 	return nil
 }
+
+func (sf *MQTTClient) messageHandler(streamFunc ProcDownStream) mqtt.MessageHandler {
+	return func(client mqtt.Client, message mqtt.Message) {
+		if message.Duplicate() {
+			return
+		}
+		if sf.dispatcher != nil {
+			sf.dispatcher.dispatch(sf.Client, message.Topic(), message.Payload(), streamFunc)
+			return
+		}
+		if err := streamFunc(sf.Client, message.Topic(), message.Payload()); err != nil {
+			sf.StructuredLog().Warn("process failed", "topic", message.Topic(), "error", err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package aiot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/logger"
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+type mockToken struct {
+	mqtt.Token
+	err error
+}
+
+func (mockToken) WaitTimeout(time.Duration) bool { return true }
+func (sf mockToken) Error() error                { return sf.err }
+
+// mockMQTT 记录订阅及发布的mqtt客户端,用于测试
+type mockMQTT struct {
+	mqtt.Client
+	mu        sync.Mutex
+	topics    []string
+	published int
+	failed    map[string]error // 订阅失败的主题
+}
+
+func (sf *mockMQTT) Publish(string, byte, bool, interface{}) mqtt.Token {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.published++
+	return mockToken{}
+}
+
+func (sf *mockMQTT) Disconnect(uint) {}
+
+func (sf *mockMQTT) publishCount() int {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.published
+}
+
+func (sf *mockMQTT) Subscribe(topic string, _ byte, _ mqtt.MessageHandler) mqtt.Token {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.topics = append(sf.topics, topic)
+	return mockToken{err: sf.failed[topic]}
+}
+
+func (sf *mockMQTT) Unsubscribe(...string) mqtt.Token { return mockToken{} }
+
+func (sf *mockMQTT) reset() []string {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	topics := sf.topics
+	sf.topics = nil
+	return topics
+}
+
+// warnLogger 记录Warn日志
+type warnLogger struct {
+	logger.Discard
+	lines []string
+}
+
+func (sf *warnLogger) Warn(msg string, keysAndValues ...interface{}) {
+	sf.lines = append(sf.lines, msg+logger.FormatFields(keysAndValues...))
+}
+
+func TestMQTTClientResubscribe(t *testing.T) {
+	mc := &mockMQTT{}
+	log := &warnLogger{}
+	c := NewWithMQTT(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, mc, WithLogger(log))
+
+	require.NoError(t, c.Subscribe("/a", ProcReplyRawData))
+	require.NoError(t, c.Subscribe("/b", ProcReplyRawData))
+	require.NoError(t, c.Subscribe("/c", ProcReplyRawData))
+	require.NoError(t, c.UnSubscribe("/b"))
+	mc.reset()
+
+	// 重新订阅失败记录日志并继续
+	mc.failed = map[string]error{"/a": errors.New("not authorized")}
+	c.OnConnectHandler(mc)
+	require.ElementsMatch(t, []string{"/a", "/c"}, mc.reset())
+	require.Equal(t, []string{"resubscribe failed topic=/a error=not authorized"}, log.lines)
+	require.NoError(t, c.Close())
+}
+
+func TestMQTTClientResumeOnce(t *testing.T) {
+	offlineMsg := func() *OfflineMessage {
+		return &OfflineMessage{"pk", "dn", uri.URI(uri.SysPrefix, uri.ThingEventPropertyPost, "pk", "dn"),
+			infra.MethodEventPropertyPost, json.RawMessage(`{}`), 0, nil, true}
+	}
+
+	// 先调用 Connect 再连接成功
+	mc := &mockMQTT{}
+	store := &sliceStore{msgs: []*OfflineMessage{offlineMsg()}}
+	c := NewWithMQTT(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, mc, WithOfflineStore(store))
+	require.NoError(t, c.Connect())
+	require.Zero(t, mc.publishCount())
+	c.OnConnectHandler(mc)
+	require.Equal(t, 1, mc.publishCount())
+
+	// 重连
+	store.msgs = append(store.msgs, offlineMsg())
+	c.OnConnectHandler(mc)
+	require.Equal(t, 2, mc.publishCount())
+
+	// 先连接成功再调用 Connect
+	mc = &mockMQTT{}
+	store = &sliceStore{msgs: []*OfflineMessage{offlineMsg()}}
+	c = NewWithMQTT(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, mc, WithOfflineStore(store))
+	c.OnConnectHandler(mc)
+	require.Zero(t, mc.publishCount())
+	require.NoError(t, c.Connect())
+	require.Equal(t, 1, mc.publishCount())
+}
+
+func TestReloginSubDevices(t *testing.T) {
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "gw", DeviceName: "gw"}, conn, WithEnableGateway())
+	conn.onPublish = func(topic string, payload []byte) {
+		req := struct {
+			ID uint `json:"id,string"`
+		}{}
+		if json.Unmarshal(payload, &req) != nil {
+			return
+		}
+		rsp := fmt.Sprintf(`{"id":"%d","code":200}`, req.ID)
+		ProcExtCombineBatchLoginReply(c, topic+"_reply", []byte(rsp)) // nolint: errcheck
+	}
+
+	for i := 0; i < 8; i++ {
+		dn := "dn" + strconv.Itoa(i)
+		require.NoError(t, c.AddSubDevice(infra.MetaTriad{ProductKey: "pk", DeviceName: dn, DeviceSecret: "ds"}))
+		status := DevStatusOnline
+		if i == 7 {
+			status = DevStatusAttached
+		}
+		require.NoError(t, c.SetDeviceStatus("pk", dn, status))
+	}
+
+	require.NoError(t, c.ReloginSubDevices(time.Second))
+
+	msgs := conn.messages()
+	require.Len(t, msgs, 2)
+	counts := []int{}
+	for _, msg := range msgs {
+		require.Equal(t, uri.URI(uri.ExtSessionPrefix, uri.CombineBatchLogin, "gw", "gw"), msg.topic)
+		req := struct {
+			Params CombineBatchLoginParams `json:"params"`
+		}{}
+		require.NoError(t, json.Unmarshal(msg.payload, &req))
+		counts = append(counts, len(req.Params.DeviceList))
+	}
+	require.Equal(t, []int{5, 2}, counts)
+	require.Len(t, c.SubDevices(DevStatusOnline), 7)
+	require.False(t, c.IsActive("pk", "dn7"))
+}
@@ -0,0 +1,301 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/things-go/aliyun-iot/tsl"
+)
+
+// 标准属性事件及服务,由 aiot.Client 的属性上报,设置及获取实现
+const (
+	eventPropertyPost  = "post"
+	servicePropertySet = "set"
+	servicePropertyGet = "get"
+)
+
+// product 待生成的物模型
+type product struct {
+	name  string // 生成类型的名称前缀
+	thing *tsl.Thing
+}
+
+// prefix 类型前缀, 自定义模块追加模块标识符
+func (sf product) prefix() string {
+	if sf.thing.FunctionBlockID == "" {
+		return sf.name
+	}
+	return sf.name + camelCase(sf.thing.FunctionBlockID)
+}
+
+// generator 代码生成器
+type generator struct {
+	buf     bytes.Buffer
+	imports map[string]string // path -> name
+}
+
+func (sf *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&sf.buf, format, args...)
+}
+
+func (sf *generator) use(name, path string) {
+	sf.imports[path] = name
+}
+
+// generate 生成包名为pkg,包含所有物模型的Go源码
+func generate(pkg string, products []product) ([]byte, error) {
+	g := &generator{imports: make(map[string]string)}
+	seen := make(map[string]bool)
+	for _, p := range products {
+		prefix := p.prefix()
+		if prefix == "" {
+			return nil, fmt.Errorf("empty name for product %q", p.thing.Profile.ProductKey)
+		}
+		if seen[prefix] {
+			return nil, fmt.Errorf("duplicate name %q, products in the same package must have different names", prefix)
+		}
+		seen[prefix] = true
+		g.product(prefix, p.thing)
+	}
+
+	out := bytes.Buffer{}
+	fmt.Fprintf(&out, "// Code generated by aiot-tslgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	if len(g.imports) > 0 {
+		paths := make([]string, 0, len(g.imports))
+		for path := range g.imports {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		fmt.Fprintf(&out, "import (\n")
+		for i, path := range paths {
+			// 标准库与第三方库分组
+			if i > 0 && !strings.Contains(paths[i-1], ".") && strings.Contains(path, ".") {
+				fmt.Fprintf(&out, "\n")
+			}
+			if name := g.imports[path]; name != "" {
+				fmt.Fprintf(&out, "%s %q\n", name, path)
+			} else {
+				fmt.Fprintf(&out, "%q\n", path)
+			}
+		}
+		fmt.Fprintf(&out, ")\n\n")
+	}
+	out.Write(g.buf.Bytes())
+	return format.Source(out.Bytes())
+}
+
+func (sf *generator) product(prefix string, thing *tsl.Thing) {
+	title := prefix
+	if thing.FunctionBlockName != "" {
+		title += " " + thing.FunctionBlockName
+	}
+	if pk := thing.Profile.ProductKey; pk != "" {
+		sf.printf("// %sProductKey %s 产品的productKey\n", prefix, title)
+		sf.printf("const %sProductKey = %q\n\n", prefix, pk)
+	}
+	sf.properties(prefix, thing)
+	for _, e := range thing.Events {
+		if e.Identifier != eventPropertyPost {
+			sf.event(prefix, thing, e)
+		}
+	}
+	for _, s := range thing.Services {
+		if s.Identifier != servicePropertySet && s.Identifier != servicePropertyGet {
+			sf.service(prefix, thing, s)
+		}
+	}
+}
+
+// properties 属性结构体, 字段均为可选, 支持部分上报
+func (sf *generator) properties(prefix string, thing *tsl.Thing) {
+	if len(thing.Properties) == 0 {
+		return
+	}
+	typeName := prefix + "Properties"
+	var nested []func()
+
+	sf.printf("// %s 属性, 字段为nil的属性不上报\n", typeName)
+	sf.printf("type %s struct {\n", typeName)
+	for _, p := range thing.Properties {
+		field := camelCase(p.Identifier)
+		goType, fn := sf.goType(typeName+field, p.DataType)
+		if fn != nil {
+			nested = append(nested, fn)
+		}
+		if p.DataType.Type != tsl.TypeArray {
+			goType = "*" + goType
+		}
+		sf.printf("%s %s `json:\"%s,omitempty\"` // %s\n",
+			field, goType, thing.Identifier(p.Identifier), comment(p.Name, p.DataType, p.AccessMode))
+	}
+	sf.printf("}\n\n")
+
+	sf.use("aiot", "github.com/things-go/aliyun-iot")
+	sf.printf("// Post 上报属性\n")
+	sf.printf("func (sf *%s) Post(c *aiot.Client, pk, dn string, opts ...aiot.RequestOption) (*aiot.Token, error) {\n", typeName)
+	sf.printf("return c.ThingEventPropertyPost(pk, dn, sf, opts...)\n")
+	sf.printf("}\n\n")
+	for _, fn := range nested {
+		fn()
+	}
+}
+
+func (sf *generator) event(prefix string, thing *tsl.Thing, e tsl.Event) {
+	typeName := prefix + camelCase(e.Identifier) + "Event"
+	sf.params(typeName, fmt.Sprintf("%s 事件 %s", typeName, e.Name), e.OutputData)
+
+	sf.use("aiot", "github.com/things-go/aliyun-iot")
+	sf.printf("// Post 上报事件\n")
+	sf.printf("func (sf *%s) Post(c *aiot.Client, pk, dn string, opts ...aiot.RequestOption) (*aiot.Token, error) {\n", typeName)
+	sf.printf("return c.ThingEventPost(pk, dn, %q, sf, opts...)\n", thing.Identifier(e.Identifier))
+	sf.printf("}\n\n")
+}
+
+func (sf *generator) service(prefix string, thing *tsl.Thing, s tsl.Service) {
+	base := prefix + camelCase(s.Identifier)
+	id := thing.Identifier(s.Identifier)
+
+	sf.use("aiot", "github.com/things-go/aliyun-iot")
+	sf.use("", "encoding/json")
+	input := base + "Input"
+	sf.params(input, fmt.Sprintf("%s 服务 %s 的输入参数", input, s.Name), s.InputData)
+	sf.printf("// Decode 解析服务调用请求, 返回请求ID\n")
+	sf.printf("func (sf *%s) Decode(payload []byte) (uint, error) {\n", input)
+	sf.printf("req := &aiot.Request{Params: sf}\n")
+	sf.printf("err := json.Unmarshal(payload, req)\n")
+	sf.printf("return req.ID, err\n")
+	sf.printf("}\n\n")
+
+	sf.use("", "github.com/things-go/aliyun-iot/infra")
+	output := base + "Output"
+	sf.params(output, fmt.Sprintf("%s 服务 %s 的输出参数", output, s.Name), s.OutputData)
+	if s.CallType == tsl.CallTypeSync {
+		sf.printf("// Reply 回复同步服务调用(RRPC)\n")
+		sf.printf("func (sf *%s) Reply(c *aiot.Client, pk, dn, messageID string, id uint) error {\n", output)
+		sf.printf("return c.RRPCResponse(pk, dn, messageID, aiot.Response{ID: id, Code: infra.CodeSuccess, Data: sf})\n")
+	} else {
+		sf.printf("// Reply 回复异步服务调用\n")
+		sf.printf("func (sf *%s) Reply(c *aiot.Client, pk, dn string, id uint) error {\n", output)
+		sf.printf("return c.ThingServiceResponse(pk, dn, %q, aiot.Response{ID: id, Code: infra.CodeSuccess, Data: sf})\n", id)
+	}
+	sf.printf("}\n\n")
+}
+
+// params 参数结构体, 用于事件输出参数,服务输入输出参数及结构体类型
+func (sf *generator) params(typeName, doc string, params []tsl.Param) {
+	var nested []func()
+
+	sf.printf("// %s\n", doc)
+	sf.printf("type %s struct {\n", typeName)
+	for _, p := range params {
+		field := camelCase(p.Identifier)
+		goType, fn := sf.goType(typeName+field, p.DataType)
+		if fn != nil {
+			nested = append(nested, fn)
+		}
+		sf.printf("%s %s `json:\"%s\"`", field, goType, p.Identifier)
+		if c := comment(p.Name, p.DataType, ""); c != "" {
+			sf.printf(" // %s", c)
+		}
+		sf.printf("\n")
+	}
+	sf.printf("}\n\n")
+	for _, fn := range nested {
+		fn()
+	}
+}
+
+// goType 数据类型对应的Go类型, 结构体类型返回生成其定义的函数
+func (sf *generator) goType(name string, dt tsl.DataType) (string, func()) {
+	switch dt.Type {
+	case tsl.TypeInt, tsl.TypeBool, tsl.TypeEnum:
+		return "int", nil
+	case tsl.TypeFloat:
+		return "float32", nil
+	case tsl.TypeDouble:
+		return "float64", nil
+	case tsl.TypeStruct:
+		return name, func() { sf.params(name, name+" 结构体", dt.Members) }
+	case tsl.TypeArray:
+		if dt.Item == nil {
+			return "[]interface{}", nil
+		}
+		item, fn := sf.goType(name+"Item", *dt.Item)
+		return "[]" + item, fn
+	case tsl.TypeText, tsl.TypeDate:
+		return "string", nil
+	}
+	sf.use("", "encoding/json")
+	return "json.RawMessage", nil
+}
+
+// comment 字段注释: 名称,取值范围,单位,取值描述,读写类型
+func comment(name string, dt tsl.DataType, accessMode string) string {
+	var parts []string
+	if name != "" {
+		parts = append(parts, name)
+	}
+	switch dt.Type {
+	case tsl.TypeInt, tsl.TypeFloat, tsl.TypeDouble:
+		if dt.Min != nil && dt.Max != nil {
+			parts = append(parts, fmt.Sprintf("[%v, %v]", *dt.Min, *dt.Max))
+		}
+		if dt.Unit != "" {
+			parts = append(parts, dt.Unit)
+		}
+	case tsl.TypeBool, tsl.TypeEnum:
+		keys := make([]int, 0, len(dt.Values))
+		for k := range dt.Values {
+			keys = append(keys, k)
+		}
+		sort.Ints(keys)
+		values := make([]string, 0, len(keys))
+		for _, k := range keys {
+			values = append(values, strconv.Itoa(k)+": "+dt.Values[k])
+		}
+		if len(values) > 0 {
+			parts = append(parts, strings.Join(values, ", "))
+		}
+	case tsl.TypeText:
+		if dt.Length > 0 {
+			parts = append(parts, fmt.Sprintf("max length %d", dt.Length))
+		}
+	case tsl.TypeDate:
+		parts = append(parts, "UTC timestamp in ms")
+	}
+	if accessMode == tsl.AccessRead {
+		parts = append(parts, "read only")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// camelCase 标识符转换为导出的Go名称, 如 current_temp -> CurrentTemp
+func camelCase(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteByte('X')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	light, err := loadProduct("light=../../tsl/testdata/thing.json")
+	require.NoError(t, err)
+	battery, err := loadProduct("Light=testdata/module.json")
+	require.NoError(t, err)
+	require.Equal(t, "Light", light.name)
+
+	src, err := generate("model", []product{light, battery})
+	require.NoError(t, err)
+
+	// 生成的代码可通过类型检查
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "model_gen.go", src, parser.ParseComments)
+	require.NoError(t, err)
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("model", fset, []*ast.File{f}, nil)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"LightProductKey",
+		"LightProperties",
+		"LightPropertiesLocation",
+		"LightOverheatEvent",
+		"LightRebootInput",
+		"LightRebootOutput",
+		"LightBatteryProperties",
+		"LightBatteryPropertiesCellsItem",
+		"LightBatteryLowPowerEvent",
+		"LightBatteryCalibrateOutput",
+	} {
+		require.NotNil(t, pkg.Scope().Lookup(name), name)
+	}
+	// 标准属性事件及服务不生成
+	require.Nil(t, pkg.Scope().Lookup("LightPostEvent"))
+	require.Nil(t, pkg.Scope().Lookup("LightSetInput"))
+
+	// 自定义模块的标识符
+	require.Contains(t, string(src), "`json:\"battery:level,omitempty\"`")
+	require.Contains(t, string(src), `c.ThingEventPost(pk, dn, "battery:low_power", sf, opts...)`)
+	require.Contains(t, string(src), `c.ThingServiceResponse(pk, dn, "battery:calibrate"`)
+	// 同步服务使用RRPC回复
+	require.Contains(t, string(src), "func (sf *LightRebootOutput) Reply(c *aiot.Client, pk, dn, messageID string, id uint) error")
+
+	_, err = generate("model", []product{light, light})
+	require.Error(t, err)
+}
+
+func TestCamelCase(t *testing.T) {
+	require.Equal(t, "CurrentTemp", camelCase("current_temp"))
+	require.Equal(t, "CurrentTemp", camelCase("currentTemp"))
+	require.Equal(t, "X1st", camelCase("1st"))
+	require.Equal(t, "LowPower", camelCase("low-power"))
+}
+
+// e2eTest 使用生成的结构体上报及回复, 设置了默认模块及自定义模块的物模型
+const e2eTest = `package model
+
+import (
+	"errors"
+	"testing"
+
+	aiot "github.com/things-go/aliyun-iot"
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/tsl"
+)
+
+type conn struct{ topics []string }
+
+func (sf *conn) Publish(topic string, _ byte, _ interface{}) error {
+	sf.topics = append(sf.topics, topic)
+	return nil
+}
+func (sf *conn) Subscribe(string, aiot.ProcDownStream) error { return nil }
+func (sf *conn) UnSubscribe(...string) error                 { return nil }
+func (sf *conn) Close() error                                { return nil }
+
+func TestPost(t *testing.T) {
+	light, err := tsl.LoadFile(LightFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	battery, err := tsl.LoadFile(BatteryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cn := &conn{}
+	c := aiot.New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, cn)
+	c.SetThingModel("pk", light)
+	c.SetThingModel("pk", battery)
+
+	level, temperature := 50, float32(25.5)
+	if _, err = (&LightBatteryProperties{Level: &level}).Post(c, "pk", "dn"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = (&LightProperties{Temperature: &temperature}).Post(c, "pk", "dn"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = (&LightBatteryLowPowerEvent{Level: 10}).Post(c, "pk", "dn"); err != nil {
+		t.Fatal(err)
+	}
+	if err = (&LightBatteryCalibrateOutput{Ok: 1}).Reply(c, "pk", "dn", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(cn.topics) != 4 {
+		t.Fatalf("published %d messages", len(cn.topics))
+	}
+
+	var verr *tsl.ValidationError
+	level = 101
+	_, err = (&LightBatteryProperties{Level: &level}).Post(c, "pk", "dn")
+	if !errors.As(err, &verr) || verr.Identifier != "battery:level" {
+		t.Fatalf("expect validation error of battery:level, got %v", err)
+	}
+	_, err = (&LightBatteryLowPowerEvent{Level: -1}).Post(c, "pk", "dn")
+	if !errors.As(err, &verr) || verr.Identifier != "battery:low_power.level" {
+		t.Fatalf("expect validation error of battery:low_power.level, got %v", err)
+	}
+	if err = (&LightBatteryCalibrateOutput{Ok: 2}).Reply(c, "pk", "dn", 2); !errors.As(err, &verr) {
+		t.Fatalf("expect validation error, got %v", err)
+	}
+}
+`
+
+func TestGenerateModulePost(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go test of the generated package in short mode")
+	}
+	light, err := loadProduct("light=../../tsl/testdata/thing.json")
+	require.NoError(t, err)
+	battery, err := loadProduct("Light=testdata/module.json")
+	require.NoError(t, err)
+	src, err := generate("model", []product{light, battery})
+	require.NoError(t, err)
+
+	// 生成到模块内的临时目录, 以使用当前的aiot包
+	dir, err := os.MkdirTemp(".", "_e2e")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	lightFile, err := filepath.Abs("../../tsl/testdata/thing.json")
+	require.NoError(t, err)
+	batteryFile, err := filepath.Abs("testdata/module.json")
+	require.NoError(t, err)
+	files := fmt.Sprintf("package model\n\nconst (\n\tLightFile   = %q\n\tBatteryFile = %q\n)\n", lightFile, batteryFile)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "model_gen.go"), src, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "files_test.go"), []byte(files), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "model_test.go"), []byte(e2eTest), 0644))
+
+	out, err := exec.Command("go", "test", "./"+dir).CombinedOutput()
+	require.NoError(t, err, string(out))
+}
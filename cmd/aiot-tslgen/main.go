@@ -0,0 +1,165 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Command aiot-tslgen 根据物模型(TSL)生成类型化的属性,事件,服务结构体及上报,回复方法
+//
+// 用法:
+//
+//	aiot-tslgen [flags] [name=]tsl.json ...
+//
+// 每个物模型文件生成一组类型, 类型名称前缀为name, 未指定时使用文件名.
+// 自定义模块(含functionBlockId)的类型名称前缀追加模块标识符, 多个产品及模块可生成到同一个包.
+// 指定 -cred 时使用设备证书连接平台, 通过 ThingDsltemplateGet 获取物模型.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	aiot "github.com/things-go/aliyun-iot"
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/sign"
+	"github.com/things-go/aliyun-iot/tsl"
+)
+
+// credential 设备证书文件
+type credential struct {
+	ProductKey   string            `json:"productKey"`
+	DeviceName   string            `json:"deviceName"`
+	DeviceSecret string            `json:"deviceSecret"`
+	Region       infra.CloudRegion `json:"region"` // 见 infra.CloudRegion, 默认华东2(上海)
+	CustomDomain string            `json:"customDomain,omitempty"`
+}
+
+func main() {
+	pkg := flag.String("pkg", "model", "package name of the generated code")
+	output := flag.String("o", "", "output file, default stdout")
+	cred := flag.String("cred", "", "device credential json file, fetch tsl from the platform by ThingDsltemplateGet")
+	name := flag.String("name", "", "type name prefix of the fetched tsl, default productKey")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout to fetch tsl")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: aiot-tslgen [flags] [name=]tsl.json ...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*pkg, *output, *cred, *name, *timeout, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "aiot-tslgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(pkg, output, cred, name string, timeout time.Duration, files []string) error {
+	if len(files) == 0 && cred == "" {
+		return errors.New("no tsl file or credential specified")
+	}
+
+	products := make([]product, 0, len(files)+1)
+	for _, file := range files {
+		p, err := loadProduct(file)
+		if err != nil {
+			return err
+		}
+		products = append(products, p)
+	}
+	if cred != "" {
+		p, err := fetchProduct(cred, name, timeout)
+		if err != nil {
+			return err
+		}
+		products = append(products, p)
+	}
+
+	src, err := generate(pkg, products)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(output, src, 0644)
+}
+
+// loadProduct 加载物模型文件, 参数格式为 [name=]path
+func loadProduct(arg string) (product, error) {
+	path := arg
+	name := ""
+	if i := strings.Index(arg, "="); i >= 0 {
+		name, path = arg[:i], arg[i+1:]
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	thing, err := tsl.LoadFile(path)
+	if err != nil {
+		return product{}, fmt.Errorf("load %s, %w", path, err)
+	}
+	return product{camelCase(name), thing}, nil
+}
+
+// fetchProduct 使用设备证书连接平台获取物模型
+func fetchProduct(file, name string, timeout time.Duration) (product, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return product{}, err
+	}
+	cred := credential{}
+	if err = json.Unmarshal(data, &cred); err != nil {
+		return product{}, fmt.Errorf("invalid credential %s, %w", file, err)
+	}
+	triad := infra.MetaTriad{
+		ProductKey:   cred.ProductKey,
+		DeviceName:   cred.DeviceName,
+		DeviceSecret: cred.DeviceSecret,
+	}
+	signs, err := sign.Generate(triad, infra.CloudRegionDomain{
+		Region:       cred.Region,
+		CustomDomain: cred.CustomDomain,
+	}, sign.WithTimestamp())
+	if err != nil {
+		return product{}, err
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(signs.Addr).
+		SetClientID(signs.ClientIDWithExt()).
+		SetUsername(signs.UserName).
+		SetPassword(signs.Password).
+		SetCleanSession(true).
+		SetConnectTimeout(timeout)
+	client := aiot.NewWithMQTTOptions(triad, opts)
+	defer client.Close()
+
+	token := client.Underlying().Connect()
+	if !token.WaitTimeout(timeout) {
+		return product{}, errors.New("connect timeout")
+	}
+	if err = token.Error(); err != nil {
+		return product{}, err
+	}
+	if err = client.Connect(); err != nil {
+		return product{}, err
+	}
+	raw, err := client.LinkThingDsltemplateGet(triad.ProductKey, triad.DeviceName, timeout)
+	if err != nil {
+		return product{}, fmt.Errorf("fetch tsl, %w", err)
+	}
+	thing, err := tsl.Parse(raw)
+	if err != nil {
+		return product{}, err
+	}
+	if name == "" {
+		name = triad.ProductKey
+	}
+	return product{camelCase(name), thing}, nil
+}
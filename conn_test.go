@@ -0,0 +1,80 @@
+package aiot
+
+import (
+	"errors"
+	"sync"
+)
+
+type publishMessage struct {
+	topic   string
+	qos     byte
+	payload []byte
+}
+
+// mockConn 记录发布的消息,用于测试
+type mockConn struct {
+	mu        sync.Mutex
+	published []publishMessage
+	subscribe map[string]ProcDownStream
+	offline   bool
+	onPublish func(topic string, payload []byte)
+}
+
+var _ Conn = (*mockConn)(nil)
+
+func newMockConn() *mockConn {
+	return &mockConn{subscribe: make(map[string]ProcDownStream)}
+}
+
+func (sf *mockConn) Publish(topic string, qos byte, payload interface{}) error {
+	sf.mu.Lock()
+	if sf.offline {
+		sf.mu.Unlock()
+		return errors.New("not connected")
+	}
+	var b []byte
+	switch v := payload.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	}
+	sf.published = append(sf.published, publishMessage{topic, qos, b})
+	onPublish := sf.onPublish
+	sf.mu.Unlock()
+
+	if onPublish != nil {
+		go onPublish(topic, b)
+	}
+	return nil
+}
+
+func (sf *mockConn) Subscribe(topic string, callback ProcDownStream) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.subscribe[topic] = callback
+	return nil
+}
+
+func (sf *mockConn) UnSubscribe(topic ...string) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	for _, t := range topic {
+		delete(sf.subscribe, t)
+	}
+	return nil
+}
+
+func (sf *mockConn) Close() error { return nil }
+
+func (sf *mockConn) setOffline(offline bool) {
+	sf.mu.Lock()
+	sf.offline = offline
+	sf.mu.Unlock()
+}
+
+func (sf *mockConn) messages() []publishMessage {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return append([]publishMessage{}, sf.published...)
+}
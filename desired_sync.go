@@ -0,0 +1,304 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 期望属性同步的默认值
+const (
+	DefaultDesiredRetryMaxAttempts    = 5
+	DefaultDesiredRetryInitialBackoff = time.Second
+	DefaultDesiredRetryMaxBackoff     = time.Minute
+	DefaultDesiredSyncTimeout         = time.Second * 10
+	// desiredSyncMaxRounds 一次同步中获取期望值的最大轮数, 用于处理同步过程中期望值又被修改的版本冲突
+	desiredSyncMaxRounds = 3
+)
+
+// DesiredApplier 期望属性值的应用函数, 将期望值应用到设备
+// 返回应用后需上报的属性值, 为nil时上报期望值本身;
+// 返回错误时期望值保留在平台, 按 WithDesiredRetryPolicy 的策略稍后重试
+type DesiredApplier func(c *Client, pk, dn string, value json.RawMessage) (interface{}, error)
+
+// DesiredApplyError 期望值应用失败的属性
+type DesiredApplyError struct {
+	Errors map[string]error // 属性标识符 -> 应用函数返回的错误
+}
+
+// Error implement error
+func (sf *DesiredApplyError) Error() string {
+	ids := make([]string, 0, len(sf.Errors))
+	for id := range sf.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	s := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s = append(s, fmt.Sprintf("%s: %v", id, sf.Errors[id]))
+	}
+	return "desired apply failed, " + strings.Join(s, "; ")
+}
+
+// desiredSync 期望属性同步引擎
+// 获取期望值 -> 调用应用函数 -> 上报属性 -> 按版本删除期望值
+type desiredSync struct {
+	mu       sync.Mutex
+	appliers map[string]DesiredApplier
+	states   map[string]*desiredState // FormatKey(pk, dn) -> 同步状态
+	policy   RetryPolicy
+}
+
+// desiredState 设备的同步状态, 同一设备同时只有一个同步在运行, 运行中的触发合并为一次
+type desiredState struct {
+	running bool
+	pending bool
+	attempt int // 连续失败次数
+	timer   *time.Timer
+}
+
+func newDesiredSync() *desiredSync {
+	return &desiredSync{
+		appliers: make(map[string]DesiredApplier),
+		states:   make(map[string]*desiredState),
+		policy: RetryPolicy{
+			MaxAttempts:    DefaultDesiredRetryMaxAttempts,
+			InitialBackoff: DefaultDesiredRetryInitialBackoff,
+			MaxBackoff:     DefaultDesiredRetryMaxBackoff,
+			Multiplier:     DefaultRetryMultiplier,
+			Jitter:         DefaultRetryJitter,
+			AttemptTimeout: DefaultDesiredSyncTimeout,
+		},
+	}
+}
+
+// HandleDesired 注册期望属性的应用函数, f为nil时取消注册
+// 需使能 WithEnableDesired, 连接成功,子设备上线及收到属性设置时自动同步已注册的期望属性
+func (sf *Client) HandleDesired(identifier string, f DesiredApplier) {
+	sf.desired.mu.Lock()
+	defer sf.desired.mu.Unlock()
+	if f == nil {
+		delete(sf.desired.appliers, identifier)
+	} else {
+		sf.desired.appliers[identifier] = f
+	}
+}
+
+// desiredIdentifiers 已注册应用函数的属性标识符,有序
+func (sf *Client) desiredIdentifiers() []string {
+	sf.desired.mu.Lock()
+	defer sf.desired.mu.Unlock()
+	ids := make([]string, 0, len(sf.desired.appliers))
+	for id := range sf.desired.appliers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (sf *Client) desiredApplier(identifier string) DesiredApplier {
+	sf.desired.mu.Lock()
+	defer sf.desired.mu.Unlock()
+	return sf.desired.appliers[identifier]
+}
+
+// SyncDesired 同步设备的期望属性, 同步执行一次完整的同步流程:
+//  1. thing.property.desired.get 获取已注册应用函数的属性的期望值
+//  2. 上报值与期望值不一致时调用应用函数
+//  3. thing.event.property.post 上报应用后的属性值
+//  4. thing.property.desired.delete 按获取到的版本删除期望值
+//  5. 重新获取期望值, 期间期望值被修改(版本更新)时重复以上流程
+//
+// 部分属性应用失败时返回 *DesiredApplyError, 其余属性仍正常上报和删除
+func (sf *Client) SyncDesired(ctx context.Context, pk, dn string) error {
+	if !sf.hasDesired {
+		return ErrNotSupportFeature
+	}
+	ids := sf.desiredIdentifiers()
+	if len(ids) == 0 {
+		return nil
+	}
+	twin, err := sf.Twin(pk, dn)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[string]int64) // 本次同步已处理的期望值版本
+	failed := make(map[string]error)
+	for round := 0; round < desiredSyncMaxRounds; round++ {
+		data, err := sf.LinkThingDesiredPropertyGetContext(ctx, pk, dn, ids)
+		if err != nil {
+			return err
+		}
+		values := make(map[string]struct {
+			Value   json.RawMessage `json:"value"`
+			Version int64           `json:"version"`
+		})
+		if err = json.Unmarshal(data, &values); err != nil {
+			return err
+		}
+
+		reports := make(map[string]interface{})
+		deletes := make(map[string]interface{})
+		for _, id := range ids {
+			dv, ok := values[id]
+			value := compactJSON(dv.Value)
+			if !ok || len(value) == 0 || bytes.Equal(value, []byte("null")) {
+				continue
+			}
+			if version, ok := applied[id]; ok && version >= dv.Version {
+				continue // 已处理, 删除未生效时不重复处理
+			}
+			if _, ok := failed[id]; ok {
+				continue // 本次同步已失败, 等待重试
+			}
+			applied[id] = dv.Version
+			if reported, ok := twin.Reported(id); !ok || !bytes.Equal(reported.Value, value) {
+				v, err := sf.applyDesired(pk, dn, id, value)
+				if err != nil {
+					failed[id] = err
+					sf.StructuredLog().Warn("desired apply failed", "productKey", pk, "deviceName", dn,
+						"identifier", id, "version", dv.Version, "error", err)
+					continue
+				}
+				reports[id] = v
+			}
+			deletes[id] = map[string]int64{"version": dv.Version}
+		}
+		if len(deletes) == 0 {
+			break
+		}
+		if len(reports) > 0 {
+			if err = sf.LinkThingEventPropertyPostContext(ctx, pk, dn, reports); err != nil {
+				return err
+			}
+		}
+		if err = sf.LinkThingDesiredPropertyDeleteContext(ctx, pk, dn, deletes); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return &DesiredApplyError{failed}
+	}
+	return nil
+}
+
+// applyDesired 调用应用函数, 返回需上报的属性值
+func (sf *Client) applyDesired(pk, dn, identifier string, value json.RawMessage) (v interface{}, err error) {
+	f := sf.desiredApplier(identifier)
+	if f == nil {
+		return nil, ErrNotFound
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if v, err = f(sf, pk, dn, value); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		v = value
+	}
+	return v, nil
+}
+
+// triggerDesired 异步同步设备的期望属性, 运行中的同步完成后再执行一次
+func (sf *Client) triggerDesired(pk, dn string) {
+	if !sf.hasDesired || sf.hasRawModel || len(sf.desiredIdentifiers()) == 0 {
+		return
+	}
+	key := FormatKey(pk, dn)
+	sf.desired.mu.Lock()
+	st, ok := sf.desired.states[key]
+	if !ok {
+		st = &desiredState{}
+		sf.desired.states[key] = st
+	}
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	st.attempt = 0
+	if st.running {
+		st.pending = true
+		sf.desired.mu.Unlock()
+		return
+	}
+	st.running = true
+	sf.desired.mu.Unlock()
+
+	go sf.runDesired(pk, dn, st)
+}
+
+// triggerDesiredAll 连接成功后同步网关及在线子设备的期望属性
+func (sf *Client) triggerDesiredAll() {
+	sf.triggerDesired(sf.tetrad.ProductKey, sf.tetrad.DeviceName)
+	if sf.isGateway {
+		for _, pair := range sf.SubDevices(DevStatusOnline) {
+			sf.triggerDesired(pair.ProductKey, pair.DeviceName)
+		}
+	}
+}
+
+func (sf *Client) runDesired(pk, dn string, st *desiredState) {
+	policy := &sf.desired.policy
+	for {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if policy.AttemptTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, policy.AttemptTimeout)
+		}
+		err := sf.SyncDesired(ctx, pk, dn)
+		cancel()
+
+		sf.desired.mu.Lock()
+		if st.pending {
+			st.pending = false
+			st.attempt = 0
+			sf.desired.mu.Unlock()
+			continue
+		}
+		st.running = false
+		if err == nil {
+			st.attempt = 0
+			sf.desired.mu.Unlock()
+			return
+		}
+		st.attempt++
+		_, applyFailed := err.(*DesiredApplyError)
+		if st.attempt >= policy.MaxAttempts || !(applyFailed || policy.retryable(err)) {
+			sf.StructuredLog().Warn("desired sync failed", "productKey", pk, "deviceName", dn, "attempt", st.attempt, "error", err)
+			st.attempt = 0
+			sf.desired.mu.Unlock()
+			return
+		}
+		backoff := policy.backoff(st.attempt)
+		sf.StructuredLog().Debug("desired sync retry", "productKey", pk, "deviceName", dn, "attempt", st.attempt, "backoff", backoff, "error", err)
+		st.timer = time.AfterFunc(backoff, func() { sf.retryDesired(pk, dn, st) })
+		sf.desired.mu.Unlock()
+		return
+	}
+}
+
+// retryDesired 重试失败的同步, 期间被重新触发时不再重试
+func (sf *Client) retryDesired(pk, dn string, st *desiredState) {
+	sf.desired.mu.Lock()
+	if st.timer == nil || st.running {
+		sf.desired.mu.Unlock()
+		return
+	}
+	st.timer = nil
+	st.running = true
+	sf.desired.mu.Unlock()
+
+	go sf.runDesired(pk, dn, st)
+}
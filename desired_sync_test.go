@@ -0,0 +1,209 @@
+package aiot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+type desiredEntry struct {
+	Value   json.RawMessage `json:"value"`
+	Version int64           `json:"version"`
+}
+
+// mockDesiredCloud 模拟平台的期望属性获取,删除及属性上报
+type mockDesiredCloud struct {
+	mu      sync.Mutex
+	desired map[string]desiredEntry
+	posted  []map[string]json.RawMessage
+}
+
+func newMockDesiredCloud(c *Client, conn *mockConn) *mockDesiredCloud {
+	cloud := &mockDesiredCloud{desired: make(map[string]desiredEntry)}
+	conn.onPublish = func(topic string, payload []byte) {
+		req := struct {
+			ID     uint            `json:"id,string"`
+			Params json.RawMessage `json:"params"`
+		}{}
+		if json.Unmarshal(payload, &req) != nil {
+			return
+		}
+		cloud.mu.Lock()
+		data := "{}"
+		switch {
+		case strings.HasSuffix(topic, "/desired/get"):
+			var ids []string
+			_ = json.Unmarshal(req.Params, &ids)
+			values := make(map[string]desiredEntry)
+			for _, id := range ids {
+				if v, ok := cloud.desired[id]; ok {
+					values[id] = v
+				}
+			}
+			b, _ := json.Marshal(values)
+			data = string(b)
+		case strings.HasSuffix(topic, "/desired/delete"):
+			var versions map[string]struct {
+				Version int64 `json:"version"`
+			}
+			_ = json.Unmarshal(req.Params, &versions)
+			for id, v := range versions {
+				if cloud.desired[id].Version == v.Version {
+					delete(cloud.desired, id)
+				}
+			}
+		case strings.HasSuffix(topic, "/property/post"):
+			var values map[string]json.RawMessage
+			_ = json.Unmarshal(req.Params, &values)
+			cloud.posted = append(cloud.posted, values)
+		}
+		cloud.mu.Unlock()
+
+		rsp := []byte(fmt.Sprintf(`{"id":"%d","code":200,"data":%s}`, req.ID, data))
+		switch {
+		case strings.HasSuffix(topic, "/desired/get"):
+			ProcThingDesiredPropertyGetReply(c, topic+"_reply", rsp) // nolint: errcheck
+		case strings.HasSuffix(topic, "/desired/delete"):
+			ProcThingDesiredPropertyDeleteReply(c, topic+"_reply", rsp) // nolint: errcheck
+		case strings.HasSuffix(topic, "/property/post"):
+			ProcThingEventPostReply(c, topic+"_reply", rsp) // nolint: errcheck
+		}
+	}
+	return cloud
+}
+
+func (sf *mockDesiredCloud) set(id, value string, version int64) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.desired[id] = desiredEntry{json.RawMessage(value), version}
+}
+
+func (sf *mockDesiredCloud) pending() int {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return len(sf.desired)
+}
+
+func (sf *mockDesiredCloud) posts() []map[string]json.RawMessage {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return append([]map[string]json.RawMessage{}, sf.posted...)
+}
+
+func TestSyncDesired(t *testing.T) {
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn, WithEnableDesired())
+	cloud := newMockDesiredCloud(c, conn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// 未注册应用函数时不同步
+	require.NoError(t, c.SyncDesired(ctx, "pk", "dn"))
+	require.Empty(t, conn.messages())
+
+	var applied []string
+	c.HandleDesired("temp", func(c *Client, pk, dn string, value json.RawMessage) (interface{}, error) {
+		applied = append(applied, string(value))
+		if string(value) == "99" {
+			return nil, errors.New("out of range")
+		}
+		if string(value) == "30" {
+			// 应用过程中期望值被再次修改
+			cloud.set("temp", "31", 3)
+		}
+		return nil, nil
+	})
+	c.HandleDesired("mode", func(c *Client, pk, dn string, value json.RawMessage) (interface{}, error) {
+		applied = append(applied, string(value))
+		return "auto", nil // 设备实际应用的值
+	})
+
+	cloud.set("temp", "26", 1)
+	cloud.set("mode", `"eco"`, 1)
+	require.NoError(t, c.SyncDesired(ctx, "pk", "dn"))
+	require.Equal(t, []string{`"eco"`, "26"}, applied)
+	require.Equal(t, 0, cloud.pending())
+	require.Equal(t, []map[string]json.RawMessage{{"mode": json.RawMessage(`"auto"`), "temp": json.RawMessage("26")}}, cloud.posts())
+	twin, _ := c.Twin("pk", "dn")
+	require.Empty(t, twin.DesiredAll())
+
+	// 上报值已与期望值一致, 仅删除期望值
+	applied = nil
+	cloud.set("temp", "26", 2)
+	require.NoError(t, c.SyncDesired(ctx, "pk", "dn"))
+	require.Empty(t, applied)
+	require.Equal(t, 0, cloud.pending())
+	require.Len(t, cloud.posts(), 1)
+
+	// 版本冲突, 应用新版本的期望值
+	applied = nil
+	cloud.set("temp", "30", 2)
+	require.NoError(t, c.SyncDesired(ctx, "pk", "dn"))
+	require.Equal(t, []string{"30", "31"}, applied)
+	require.Equal(t, 0, cloud.pending())
+	v, _ := twin.Reported("temp")
+	require.Equal(t, json.RawMessage("31"), v.Value)
+
+	// 应用失败, 期望值保留
+	cloud.set("temp", "99", 4)
+	err := c.SyncDesired(ctx, "pk", "dn")
+	applyErr := &DesiredApplyError{}
+	require.True(t, errors.As(err, &applyErr))
+	require.Contains(t, applyErr.Errors, "temp")
+	require.Equal(t, 1, cloud.pending())
+
+	require.Equal(t, ErrNotSupportFeature, New(infra.MetaTriad{}, conn).SyncDesired(ctx, "pk", "dn"))
+}
+
+func TestTriggerDesired(t *testing.T) {
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn,
+		WithEnableDesired(),
+		WithDesiredRetryPolicy(RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Multiplier:     1,
+			AttemptTimeout: time.Second,
+		}),
+	)
+	cloud := newMockDesiredCloud(c, conn)
+
+	var mu sync.Mutex
+	attempts := 0
+	c.HandleDesired("temp", func(c *Client, pk, dn string, value json.RawMessage) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < 2 {
+			return nil, errors.New("busy")
+		}
+		return nil, nil
+	})
+	c.HandleService("property.set", func(c *Client, pk, dn string, payload []byte) error { return nil })
+
+	// 连接时同步, 应用失败后重试
+	cloud.set("temp", "26", 1)
+	require.NoError(t, c.Connect())
+	require.Eventually(t, func() bool { return cloud.pending() == 0 }, time.Second, time.Millisecond*5)
+	mu.Lock()
+	require.Equal(t, 2, attempts)
+	mu.Unlock()
+
+	// 收到属性设置时同步
+	cloud.set("temp", "27", 2)
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/property/set",
+		[]byte(`{"id":"1","version":"1.0","params":{"temp":27},"method":"thing.service.property.set"}`)))
+	require.Eventually(t, func() bool { return cloud.pending() == 0 }, time.Second, time.Millisecond*5)
+	twin, _ := c.Twin("pk", "dn")
+	v, _ := twin.Reported("temp")
+	require.Equal(t, json.RawMessage("27"), v.Value)
+}
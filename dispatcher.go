@@ -0,0 +1,228 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+// OverflowPolicy 调度队列满时的处理策略
+type OverflowPolicy byte
+
+// 调度队列满时的处理策略
+const (
+	// OverflowBlock 阻塞直到队列有空闲,将阻塞mqtt的消息分发
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReply 丢弃消息,如果是平台的下行请求,回复 infra.CodeRequestTooMany
+	OverflowReply
+	// OverflowDrop 直接丢弃消息
+	OverflowDrop
+)
+
+// 调度器默认值
+const (
+	DefaultDispatchWorkers   = 4
+	DefaultDispatchQueueSize = 256
+)
+
+type dispatchTask struct {
+	c          *Client
+	streamFunc ProcDownStream
+	topic      string
+	payload    []byte
+}
+
+// Dispatcher 下行数据调度器,使用有界队列及固定数量的协程处理下行数据,
+// 避免耗时的处理函数阻塞mqtt的消息分发.
+// 应答(*_reply)不进入队列,直接在mqtt的消息分发中处理,
+// 以免处理函数中同步等待应答(如 Link* 及 Token.Wait)时,应答排在其后导致死锁
+type Dispatcher struct {
+	workers   int
+	queueSize int
+	ordered   bool
+	policy    OverflowPolicy
+
+	queues  []chan dispatchTask
+	depth   int64
+	dropped uint64
+	mu      sync.RWMutex
+	closed  bool
+	done    chan struct{}  // 关闭时关闭,唤醒阻塞的提交
+	senders sync.WaitGroup // 正在提交的消息
+	wg      sync.WaitGroup
+}
+
+// DispatcherOption 调度器选项
+type DispatcherOption func(*Dispatcher)
+
+// WithDispatchOrdered 同一设备的下行数据按顺序处理
+func WithDispatchOrdered() DispatcherOption {
+	return func(d *Dispatcher) {
+		d.ordered = true
+	}
+}
+
+// WithDispatchOverflow 设置队列满时的处理策略,默认 OverflowBlock
+func WithDispatchOverflow(p OverflowPolicy) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.policy = p
+	}
+}
+
+// NewDispatcher 新建调度器,需调用 Close 释放
+// workers: 处理协程数, <= 0 使用 DefaultDispatchWorkers
+// queueSize: 队列长度, <= 0 使用 DefaultDispatchQueueSize,
+// 按设备顺序处理时每个协程的队列长度为 queueSize/workers
+func NewDispatcher(workers, queueSize int, opts ...DispatcherOption) *Dispatcher {
+	if workers <= 0 {
+		workers = DefaultDispatchWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultDispatchQueueSize
+	}
+	d := &Dispatcher{
+		workers:   workers,
+		queueSize: queueSize,
+		policy:    OverflowBlock,
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	if d.ordered {
+		size := (queueSize + workers - 1) / workers
+		d.queues = make([]chan dispatchTask, workers)
+		for i := range d.queues {
+			d.queues[i] = make(chan dispatchTask, size)
+		}
+	} else {
+		d.queues = []chan dispatchTask{make(chan dispatchTask, queueSize)}
+	}
+	d.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go d.run(d.queues[i%len(d.queues)])
+	}
+	return d
+}
+
+// Len 队列中等待处理的消息数
+func (sf *Dispatcher) Len() int { return int(atomic.LoadInt64(&sf.depth)) }
+
+// Dropped 队列满被丢弃的消息数
+func (sf *Dispatcher) Dropped() uint64 { return atomic.LoadUint64(&sf.dropped) }
+
+// Close 关闭调度器,等待队列中的消息处理完成,之后提交的消息将被丢弃
+func (sf *Dispatcher) Close() error {
+	sf.mu.Lock()
+	if sf.closed {
+		sf.mu.Unlock()
+		return nil
+	}
+	sf.closed = true
+	sf.mu.Unlock()
+
+	close(sf.done)
+	sf.senders.Wait()
+	for _, q := range sf.queues {
+		close(q)
+	}
+	sf.wg.Wait()
+	return nil
+}
+
+func (sf *Dispatcher) run(queue chan dispatchTask) {
+	defer sf.wg.Done()
+	for task := range queue {
+		atomic.AddInt64(&sf.depth, -1)
+		if err := task.streamFunc(task.c, task.topic, task.payload); err != nil {
+			task.c.StructuredLog().Warn("process failed", "topic", task.topic, "error", err)
+		}
+	}
+}
+
+// dispatch 提交消息, 消息被丢弃时返回false, 应答直接处理
+func (sf *Dispatcher) dispatch(c *Client, topic string, payload []byte, streamFunc ProcDownStream) bool {
+	if strings.HasSuffix(topic, "_"+uri.ReplySuffix) {
+		if err := streamFunc(c, topic, payload); err != nil {
+			c.StructuredLog().Warn("process failed", "topic", topic, "error", err)
+		}
+		return true
+	}
+
+	task := dispatchTask{c, streamFunc, topic, payload}
+	queue := sf.queues[0]
+	if sf.ordered {
+		h := fnv.New32a()
+		h.Write([]byte(deviceKey(topic))) // nolint: errcheck
+		queue = sf.queues[h.Sum32()%uint32(len(sf.queues))]
+	}
+
+	sf.mu.RLock()
+	if sf.closed {
+		sf.mu.RUnlock()
+		atomic.AddUint64(&sf.dropped, 1)
+		return false
+	}
+	sf.senders.Add(1)
+	sf.mu.RUnlock()
+	defer sf.senders.Done()
+
+	atomic.AddInt64(&sf.depth, 1)
+	if sf.policy == OverflowBlock {
+		select {
+		case queue <- task:
+			return true
+		case <-sf.done:
+			atomic.AddInt64(&sf.depth, -1)
+			atomic.AddUint64(&sf.dropped, 1)
+			return false
+		}
+	}
+	select {
+	case queue <- task:
+		return true
+	default:
+	}
+	atomic.AddInt64(&sf.depth, -1)
+	atomic.AddUint64(&sf.dropped, 1)
+	c.StructuredLog().Warn("dispatch queue full, dropped", "topic", topic)
+	if sf.policy == OverflowReply {
+		replyOverflow(c, topic, payload)
+	}
+	return false
+}
+
+// replyOverflow 平台的下行请求被丢弃时回复限流错误
+func replyOverflow(c *Client, topic string, payload []byte) {
+	req := &Request{}
+	if json.Unmarshal(payload, req) != nil || req.ID == 0 || req.Method == "" {
+		return
+	}
+	err := c.Response(uri.ReplyWithRequestURI(topic), Response{
+		ID:      req.ID,
+		Code:    infra.CodeRequestTooMany,
+		Data:    "{}",
+		Message: "request too many",
+	})
+	if err != nil {
+		c.StructuredLog().Warn("dispatch overflow reply failed", "error", err)
+	}
+}
+
+// deviceKey 获取topic所属设备, 无法识别时返回topic
+func deviceKey(topic string) string {
+	if pk, dn := topicDevice(topic); pk != "" {
+		return FormatKey(pk, dn)
+	}
+	return topic
+}
@@ -0,0 +1,114 @@
+package aiot
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+func TestDispatcherOrdered(t *testing.T) {
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, newMockConn())
+	d := NewDispatcher(4, 64, WithDispatchOrdered())
+
+	var mu sync.Mutex
+	got := make(map[string][]int)
+	h := func(c *Client, rawURI string, payload []byte) error {
+		n, _ := strconv.Atoi(string(payload))
+		mu.Lock()
+		got[deviceKey(rawURI)] = append(got[deviceKey(rawURI)], n)
+		mu.Unlock()
+		return nil
+	}
+	for i := 0; i < 50; i++ {
+		for _, dn := range []string{"a", "b", "c"} {
+			d.dispatch(c, "/sys/pk/"+dn+"/thing/service/property/set", []byte(strconv.Itoa(i)), h)
+		}
+	}
+	require.NoError(t, d.Close())
+	require.Equal(t, 0, d.Len())
+	for _, dn := range []string{"a", "b", "c"} {
+		seq := got[FormatKey("pk", dn)]
+		require.Len(t, seq, 50)
+		for i, v := range seq {
+			require.Equal(t, i, v)
+		}
+	}
+}
+
+func TestDispatcherOverflow(t *testing.T) {
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn)
+	d := NewDispatcher(1, 1, WithDispatchOverflow(OverflowReply))
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	h := func(*Client, string, []byte) error {
+		started <- struct{}{}
+		<-block
+		return nil
+	}
+	req := []byte(`{"id":"7","version":"1.0","params":{},"method":"thing.service.reboot"}`)
+	require.True(t, d.dispatch(c, "/sys/pk/dn/thing/service/reboot", req, h))
+	<-started // 协程处理中,队列空
+	require.True(t, d.dispatch(c, "/sys/pk/dn/thing/service/reboot", req, h))
+	require.Equal(t, 1, d.Len())
+	require.False(t, d.dispatch(c, "/sys/pk/dn/thing/service/reboot", req, h))
+	require.Equal(t, uint64(1), d.Dropped())
+	// 应答不进入队列,直接处理
+	var replied bool
+	require.True(t, d.dispatch(c, "/sys/pk/dn/thing/event/property/post_reply", []byte(`{"id":"8"}`),
+		func(*Client, string, []byte) error { replied = true; return nil }))
+	require.True(t, replied)
+
+	msgs := conn.messages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, "/sys/pk/dn/thing/service/reboot_reply", msgs[0].topic)
+	rsp := Response{}
+	require.NoError(t, json.Unmarshal(msgs[0].payload, &rsp))
+	require.Equal(t, uint(7), rsp.ID)
+	require.Equal(t, infra.CodeRequestTooMany, rsp.Code)
+
+	close(block)
+	go func() {
+		for range started {
+		}
+	}()
+	require.NoError(t, d.Close())
+	close(started)
+	require.False(t, d.dispatch(c, "/sys/pk/dn/thing/service/reboot", req, h))
+}
+
+func TestDispatcherReplyInline(t *testing.T) {
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn)
+	d := NewDispatcher(1, 4, WithDispatchOrdered())
+	defer d.Close() // nolint: errcheck
+
+	// 模拟平台应答属性上报, 应答经调度器分发
+	conn.onPublish = func(topic string, payload []byte) {
+		if topic != "/sys/pk/dn/thing/event/property/post" {
+			return
+		}
+		req := Request{}
+		if json.Unmarshal(payload, &req) != nil {
+			return
+		}
+		reply, _ := json.Marshal(Response{ID: req.ID, Code: infra.CodeSuccess, Data: "{}"})
+		d.dispatch(c, topic+"_reply", reply, ProcThingEventPostReply)
+	}
+
+	// 处理函数中同步上报同一设备的属性
+	result := make(chan error, 1)
+	h := func(c *Client, rawURI string, payload []byte) error {
+		result <- c.LinkThingEventPropertyPost("pk", "dn", map[string]int{"switch": 1}, time.Second)
+		return nil
+	}
+	require.True(t, d.dispatch(c, "/sys/pk/dn/thing/service/property/set", []byte(`{}`), h))
+	require.NoError(t, <-result)
+}
@@ -20,4 +20,6 @@ var (
 	ErrNotPermit         = errors.New("not permit")
 	ErrNotActive         = errors.New("device not active")
 	ErrNotAvail          = errors.New("device not avail")
+	ErrOfflineQueued     = errors.New("message queued offline")
+	ErrOfflineBacklog    = errors.New("offline messages pending replay")
 )
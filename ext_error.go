@@ -40,7 +40,7 @@ func ProcExtErrorResponse(c *Client, rawURI string, payload []byte) error {
 	}
 
 	c.signalPending(Message{rsp.ID, nil, err})
-	c.Log.Debugf("ext.error.response @%d", rsp.ID)
+	c.StructuredLog().Debug("ext.error.response", "requestID", rsp.ID, "topic", rawURI)
 
 	pk, dn := rsp.Data.ProductKey, rsp.Data.DeviceName
 	return c.gwCb.ExtErrorResponse(c, err, pk, dn)
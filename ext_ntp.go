@@ -38,7 +38,7 @@ func (sf *Client) ExtNtpRequest() error {
 	if !sf.IsActive(sf.tetrad.ProductKey, sf.tetrad.DeviceName) {
 		return ErrNotActive
 	}
-	sf.Log.Debugf("ext.ntp.request")
+	sf.StructuredLog().Debug("ext.ntp.request")
 	_uri := sf.URIGateway(uri.ExtNtpPrefix, uri.NtpRequest)
 	py, err := json.Marshal(NtpRequest{infra.Millisecond(time.Now())})
 	if err != nil {
@@ -63,7 +63,7 @@ func ProcExtNtpResponse(c *Client, rawURI string, payload []byte) error {
 	}
 	tm := (rsp.ServerRecvTime + rsp.ServerSendTime + infra.Millisecond(time.Now()) - rsp.DeviceSendTime) / 2
 	exact := infra.Time(tm)
-	c.Log.Debugf("ext.ntp.response -- %+v", exact)
+	c.StructuredLog().Debug("ext.ntp.response", "exact", exact, "topic", rawURI)
 	pk, dn := uris[2], uris[3]
 	return c.cb.ExtNtpResponse(c, pk, dn, exact)
 }
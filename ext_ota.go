@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/things-go/aliyun-iot/infra"
@@ -40,7 +41,7 @@ func (sf *Client) OtaInform(pk, dn string, params OtaInformParams) error {
 		return err
 	}
 	_uri := uri.URI(uri.OtaDeviceInformPrefix, "", pk, dn)
-	sf.Log.Debugf("ota.device.inform @%d", id)
+	sf.StructuredLog().Debug("ota.device.inform", "requestID", id)
 	return sf.Publish(_uri, 1, req)
 }
 
@@ -73,7 +74,7 @@ func (sf *Client) OtaProgress(pk, dn string, params OtaProgressParams) error {
 	if err != nil {
 		return err
 	}
-	sf.Log.Debugf("ota.device.process @%d", id)
+	sf.StructuredLog().Debug("ota.device.process", "requestID", id)
 	_uri := uri.URI(uri.OtaDeviceProcessPrefix, "", pk, dn)
 	return sf.Publish(_uri, 1, req)
 }
@@ -108,6 +109,11 @@ type OtaFirmwareResponse struct {
 // request： /sys/{productKey}/{deviceName}/thing/ota/firmware/get
 // response：/sys/{productKey}/{deviceName}/thing/ota/firmware/get_reply
 func (sf *Client) ThingOtaFirmwareGet(pk, dn string, param OtaFirmwareParam) (*Token, error) {
+	return sf.thingOtaFirmwareGet(context.Background(), pk, dn, param)
+}
+
+// thingOtaFirmwareGet 同 ThingOtaFirmwareGet, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingOtaFirmwareGet(ctx context.Context, pk, dn string, param OtaFirmwareParam) (*Token, error) {
 	if !sf.hasOTA {
 		return nil, ErrNotSupportFeature
 	}
@@ -115,7 +121,7 @@ func (sf *Client) ThingOtaFirmwareGet(pk, dn string, param OtaFirmwareParam) (*T
 		return nil, ErrNotActive
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingOtaFirmwareGet, pk, dn)
-	return sf.SendRequest(_uri, infra.MethodOtaFirmwareGet, param)
+	return sf.sendRequest(ctx, _uri, infra.MethodOtaFirmwareGet, param)
 }
 
 // ProcThingOtaFirmwareGetReply 处理请求固件信息应答
@@ -135,9 +141,12 @@ func ProcThingOtaFirmwareGetReply(c *Client, rawURI string, payload []byte) erro
 	if rsp.Code != infra.CodeSuccess {
 		err = infra.NewCodeError(rsp.Code, rsp.Message)
 	}
-	c.Log.Debugf("thing.ota.firmware.get.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.ota.firmware.get.reply", "requestID", rsp.ID, "topic", rawURI)
 	c.signalPending(Message{rsp.ID, rsp.Data, err})
 	pk, dn := uris[1], uris[2]
+	if h := c.replyHandler(infra.MethodOtaFirmwareGet); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingOtaFirmwareGetReply(c, pk, dn, rsp.Data)
 }
 
@@ -154,7 +163,7 @@ func ProcOtaUpgrade(c *Client, rawURI string, payload []byte) error {
 	if err != nil {
 		return err
 	}
-	c.Log.Debugf("thing.device.upgrade")
+	c.StructuredLog().Debug("thing.device.upgrade")
 	pk, dn := uris[3], uris[4]
 	return c.cb.OtaUpgrade(c, pk, dn, rsp)
 }
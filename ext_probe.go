@@ -4,6 +4,6 @@ package aiot
 // request:  /ext/network/probe/${messageId}
 // subscribe: /ext/network/probe/+
 func ProcExtNetworkProbeRequest(c *Client, rawURI string, _ []byte) error {
-	c.Log.Debugf("ext.network.probe --> uri: %s", rawURI)
+	c.StructuredLog().Debug("ext.network.probe", "topic", rawURI)
 	return nil
 }
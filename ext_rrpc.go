@@ -5,6 +5,8 @@
 package aiot
 
 import (
+	"context"
+	"encoding/json"
 	"strings"
 
 	"github.com/things-go/aliyun-iot/uri"
@@ -27,10 +29,16 @@ func (sf *Client) ExtRRPCResponse(messageID, topic string, payload interface{})
 }
 
 // ProcRRPCRequest 处理RRPC请求
+// 同步服务调用且已使用 ServeService 注册处理函数时,由其处理并自动回复
 // request:   /sys/${YourProductKey}/${YourDeviceName}/rrpc/request/${messageId}
 // response:  /sys/${YourProductKey}/${YourDeviceName}/rrpc/response/${messageId}
 // subscribe: /sys/${YourProductKey}/${YourDeviceName}/rrpc/request/+
 func ProcRRPCRequest(c *Client, rawURI string, payload []byte) error {
+	return ProcRRPCRequestContext(context.Background(), c, rawURI, payload)
+}
+
+// ProcRRPCRequestContext 同 ProcRRPCRequest, ctx传递给处理函数, 见 ServiceRequest.Context
+func ProcRRPCRequestContext(ctx context.Context, c *Client, rawURI string, payload []byte) error {
 	uris := uri.Spilt(rawURI)
 	if len(uris) < 6 {
 		return ErrInvalidURI
@@ -38,7 +46,18 @@ func ProcRRPCRequest(c *Client, rawURI string, payload []byte) error {
 
 	pk, dn := uris[1], uris[2]
 	messageID := uris[5]
-	c.Log.Debugf("rrpc.request.%s", messageID)
+	c.StructuredLog().Debug("rrpc.request", "messageID", messageID, "topic", rawURI)
+
+	req := struct {
+		Method string `json:"method"`
+	}{}
+	if json.Unmarshal(payload, &req) == nil {
+		if serviceID, ok := serviceIDFromMethod(req.Method); ok {
+			if f := c.service(serviceID); f != nil {
+				return c.serve(f, ServiceRequest{pk, dn, serviceID, 0, messageID, ctx}, payload)
+			}
+		}
+	}
 	return c.cb.RRPCRequest(c, messageID, pk, dn, payload)
 }
 
@@ -54,6 +73,6 @@ func ProcExtRRPCRequest(c *Client, rawURI string, payload []byte) error {
 		return ErrInvalidParameter
 	}
 	messageID, topic := uris[2], uris[3]
-	c.Log.Debugf("ext.rrpc.%s -- topic: %s", messageID, topic)
+	c.StructuredLog().Debug("ext.rrpc", "messageID", messageID, "topic", topic)
 	return c.cb.ExtRRPCRequest(c, messageID, topic, payload)
 }
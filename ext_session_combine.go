@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
@@ -55,7 +56,7 @@ type CombineLoginResponse struct {
 // 	如果取值是false，则不清理子设备离线时的消息
 // request： /ext/session/${productKey}/${deviceName}/combine/login
 // response：/ext/session/${productKey}/${deviceName}/combine/login_reply
-func (sf *Client) extCombineLogin(cp CombinePair) (*Token, error) {
+func (sf *Client) extCombineLogin(ctx context.Context, cp CombinePair) (*Token, error) {
 	if !sf.isGateway {
 		return nil, ErrNotSupportFeature
 	}
@@ -72,33 +73,21 @@ func (sf *Client) extCombineLogin(cp CombinePair) (*Token, error) {
 			DeviceSecret: ds,
 		},
 		timestamp)
-	id := sf.nextRequestID()
-	req, err := json.Marshal(&Request{
-		id,
-		sf.version,
-		CombineLoginParams{
-			cp.ProductKey,
-			cp.DeviceName,
-			clientID,
-			timestamp,
-			"hmacsha256",
-			signs,
-			cp.CleanSession,
-		},
-		infra.MethodCombineLogin,
-	})
-	if err != nil {
-		return nil, err
-	}
 	_uri := sf.URIGateway(uri.ExtSessionPrefix, uri.CombineLogin)
-	err = sf.Publish(_uri, 0, req)
-	if err != nil {
-		return nil, err
-	}
-	sf.Log.Debugf("ext.session.combine.login @%d", id)
-	return sf.putPending(id), nil
+	return sf.sendRequest(ctx, _uri, infra.MethodCombineLogin, CombineLoginParams{
+		cp.ProductKey,
+		cp.DeviceName,
+		clientID,
+		timestamp,
+		"hmacsha256",
+		signs,
+		cp.CleanSession,
+	}, WithQoS(0))
 }
 
+// CombineBatchMaxSize 单个批次上下线的子设备最大数量
+const CombineBatchMaxSize = 5
+
 // CombineBatchLoginParams 子设备上线请求参数域
 type CombineBatchLoginParams struct {
 	DeviceList []CombineLoginParams `json:"deviceList"`
@@ -116,7 +105,7 @@ type CombineBatchLoginResponse struct {
 // NOTE: topic 应使用网关的productKey和deviceName,且只支持qos = 0
 // request： /ext/session/${productKey}/${deviceName}/combine/batch_login
 // response：/ext/session/${productKey}/${deviceName}/combine/batch_login_reply
-func (sf *Client) extCombineBatchLogin(pairs []CombinePair) (*Token, error) {
+func (sf *Client) extCombineBatchLogin(ctx context.Context, pairs []CombinePair) (*Token, error) {
 	if !sf.isGateway {
 		return nil, ErrNotSupportFeature
 	}
@@ -147,23 +136,8 @@ func (sf *Client) extCombineBatchLogin(pairs []CombinePair) (*Token, error) {
 		})
 	}
 
-	id := sf.nextRequestID()
-	req, err := json.Marshal(&Request{
-		id,
-		sf.version,
-		CombineBatchLoginParams{clps},
-		infra.MethodCombineBatchLogin,
-	})
-	if err != nil {
-		return nil, err
-	}
 	_uri := sf.URIGateway(uri.ExtSessionPrefix, uri.CombineBatchLogin)
-	err = sf.Publish(_uri, 0, req)
-	if err != nil {
-		return nil, err
-	}
-	sf.Log.Debugf("ext.session.combine.batch.login @%d", id)
-	return sf.putPending(id), nil
+	return sf.sendRequest(ctx, _uri, infra.MethodCombineBatchLogin, CombineBatchLoginParams{clps}, WithQoS(0))
 }
 
 // CombineLogoutResponse 子设备上线回复
@@ -178,29 +152,13 @@ type CombineLogoutResponse struct {
 // NOTE: topic 应使用网关的productKey和deviceName,且只支持qos = 0
 // request:   /ext/session/{productKey}/{deviceName}/combine/logout
 // response:  /ext/session/{productKey}/{deviceName}/combine/logout_reply
-func (sf *Client) extCombineLogout(pk, dn string) (*Token, error) {
+func (sf *Client) extCombineLogout(ctx context.Context, pk, dn string) (*Token, error) {
 	if !sf.isGateway {
 		return nil, ErrNotSupportFeature
 	}
 
-	id := sf.nextRequestID()
-	req, err := json.Marshal(&Request{
-		id,
-		sf.version,
-		infra.MetaPair{ProductKey: pk, DeviceName: dn},
-		infra.MethodCombineLogout,
-	})
-	if err != nil {
-		return nil, err
-	}
-
 	_uri := sf.URIGateway(uri.ExtSessionPrefix, uri.CombineLogout)
-	err = sf.Publish(_uri, 0, req)
-	if err != nil {
-		return nil, err
-	}
-	sf.Log.Debugf("ext.session.combine.logout @%d", id)
-	return sf.putPending(id), nil
+	return sf.sendRequest(ctx, _uri, infra.MethodCombineLogout, infra.MetaPair{ProductKey: pk, DeviceName: dn}, WithQoS(0))
 }
 
 // CombineBatchLogoutResponse 子设备批量下线回复
@@ -215,7 +173,7 @@ type CombineBatchLogoutResponse struct {
 // NOTE: topic 应使用网关的productKey和deviceName,且只支持qos = 0
 // request:   /ext/session/{productKey}/{deviceName}/combine/batch_logout
 // response:  /ext/session/{productKey}/{deviceName}/combine/batch_logout_reply
-func (sf *Client) extCombineBatchLogout(pairs []infra.MetaPair) (*Token, error) {
+func (sf *Client) extCombineBatchLogout(ctx context.Context, pairs []infra.MetaPair) (*Token, error) {
 	if !sf.isGateway {
 		return nil, ErrNotSupportFeature
 	}
@@ -223,24 +181,8 @@ func (sf *Client) extCombineBatchLogout(pairs []infra.MetaPair) (*Token, error)
 		return nil, ErrInvalidParameter
 	}
 
-	id := sf.nextRequestID()
-	req, err := json.Marshal(&Request{
-		id,
-		sf.version,
-		pairs,
-		infra.MethodCombineBatchLogout,
-	})
-	if err != nil {
-		return nil, err
-	}
-
 	_uri := sf.URIGateway(uri.ExtSessionPrefix, uri.CombineBatchLogout)
-	err = sf.Publish(_uri, 0, req)
-	if err != nil {
-		return nil, err
-	}
-	sf.Log.Debugf("ext.session.combine.batch.login @%d", id)
-	return sf.putPending(id), nil
+	return sf.sendRequest(ctx, _uri, infra.MethodCombineBatchLogout, pairs, WithQoS(0))
 }
 
 // ProcExtCombineLoginReply 处理子设备上线应答
@@ -253,7 +195,6 @@ func ProcExtCombineLoginReply(c *Client, rawURI string, payload []byte) error {
 		return ErrInvalidURI
 	}
 
-	c.Log.Debugf(string(payload))
 	rsp := &CombineLoginResponse{}
 	err := json.Unmarshal(payload, rsp)
 	if err != nil {
@@ -263,7 +204,7 @@ func ProcExtCombineLoginReply(c *Client, rawURI string, payload []byte) error {
 		err = infra.NewCodeError(rsp.Code, rsp.Message)
 	}
 	c.signalPending(Message{rsp.ID, nil, err})
-	c.Log.Debugf("ext.session.combine.login.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("ext.session.combine.login.reply", "requestID", rsp.ID, "topic", rawURI)
 	return nil
 }
 
@@ -286,7 +227,7 @@ func ProcExtCombineBatchLoginReply(c *Client, rawURI string, payload []byte) err
 		err = infra.NewCodeError(rsp.Code, rsp.Message)
 	}
 	c.signalPending(Message{rsp.ID, nil, err})
-	c.Log.Debugf("ext.session.combine.batch.login.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("ext.session.combine.batch.login.reply", "requestID", rsp.ID, "topic", rawURI)
 	return nil
 }
 
@@ -311,7 +252,7 @@ func ProcExtCombineLogoutReply(c *Client, rawURI string, payload []byte) error {
 		err = infra.NewCodeError(rsp.Code, rsp.Message)
 	}
 	c.signalPending(Message{rsp.ID, nil, err})
-	c.Log.Debugf("ext.session.combine.logout.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("ext.session.combine.logout.reply", "requestID", rsp.ID, "topic", rawURI)
 	return nil
 }
 
@@ -336,6 +277,6 @@ func ProcExtCombineBatchLogoutReply(c *Client, rawURI string, payload []byte) er
 		err = infra.NewCodeError(rsp.Code, rsp.Message)
 	}
 	c.signalPending(Message{rsp.ID, nil, err})
-	c.Log.Debugf("ext.session.combine.batch.logout.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("ext.session.combine.batch.logout.reply", "requestID", rsp.ID, "topic", rawURI)
 	return nil
 }
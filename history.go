@@ -0,0 +1,333 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+// ErrHistoryEntryTooLarge 单个历史数据超过单次上报的大小限制
+var ErrHistoryEntryTooLarge = errors.New("history entry exceeds size limit")
+
+// HistoryBatchError 物模型历史数据拆分上报时某次上报失败, 之前的 Acked 次上报已得到云端应答,
+// 重试时可跳过已应答的批次, 见 Client.LinkThingEventPropertyHistoryPostBatch
+type HistoryBatchError struct {
+	Acked int   // 已应答的上报次数
+	Total int   // 总上报次数
+	Err   error // 第 Acked+1 次上报的错误
+}
+
+// Error implement error
+func (sf *HistoryBatchError) Error() string {
+	return fmt.Sprintf("history batch %d/%d failed, %v", sf.Acked+1, sf.Total, sf.Err)
+}
+
+// Unwrap implement errors.Unwrap
+func (sf *HistoryBatchError) Unwrap() error { return sf.Err }
+
+// TimeValue 带时间戳的属性值或事件参数, 即Alink的 {"value": v, "time": ms} 格式,
+// 可作为 ThingEventPropertyPost 的属性值
+type TimeValue struct {
+	Value interface{} `json:"value"`
+	Time  int64       `json:"time"` // 单位ms
+}
+
+// NewTimeValue 新建带时间戳的值
+func NewTimeValue(v interface{}, t time.Time) TimeValue {
+	return TimeValue{v, infra.Millisecond(t)}
+}
+
+// HistoryLimit 物模型历史数据单次上报的限制, 超出时自动拆分为多次上报, 零值表示不限制
+type HistoryLimit struct {
+	Devices    int // 设备数
+	Properties int // 属性值个数
+	Events     int // 事件个数
+	Size       int // params序列化后的字节数
+}
+
+// DefaultHistoryLimit 默认的单次上报限制, 消息最大256KB, params预留请求头部的空间
+var DefaultHistoryLimit = HistoryLimit{
+	Devices:    20,
+	Properties: 200,
+	Events:     20,
+	Size:       250 * 1024,
+}
+
+// historyEntry 单个属性值或事件
+type historyEntry struct {
+	identifier string
+	value      interface{}
+	time       int64
+	event      bool
+}
+
+// historyDevice 单个设备的历史数据
+type historyDevice struct {
+	identity PropertyHistoryIdentity
+	entries  []historyEntry
+}
+
+// PropertyHistory 物模型历史数据上报构建器, 支持多设备, 每个值独立的时间戳, 属性及事件,
+// 见 Client.ThingEventPropertyHistoryPostBatch. 非协程安全
+type PropertyHistory struct {
+	devices []*historyDevice
+	index   map[PropertyHistoryIdentity]*historyDevice
+}
+
+// NewPropertyHistory 新建物模型历史数据上报构建器
+func NewPropertyHistory() *PropertyHistory {
+	return &PropertyHistory{index: make(map[PropertyHistoryIdentity]*historyDevice)}
+}
+
+func (sf *PropertyHistory) add(pk, dn string, e historyEntry) *PropertyHistory {
+	identity := PropertyHistoryIdentity{pk, dn}
+	dev, ok := sf.index[identity]
+	if !ok {
+		dev = &historyDevice{identity: identity}
+		sf.index[identity] = dev
+		sf.devices = append(sf.devices, dev)
+	}
+	dev.entries = append(dev.entries, e)
+	return sf
+}
+
+// AddProperty 增加设备在t时刻的属性值
+func (sf *PropertyHistory) AddProperty(pk, dn, identifier string, value interface{}, t time.Time) *PropertyHistory {
+	return sf.add(pk, dn, historyEntry{identifier, value, infra.Millisecond(t), false})
+}
+
+// AddProperties 增加设备在t时刻的多个属性值, 按标识符排序增加
+func (sf *PropertyHistory) AddProperties(pk, dn string, values map[string]interface{}, t time.Time) *PropertyHistory {
+	ids := make([]string, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		sf.AddProperty(pk, dn, id, values[id], t)
+	}
+	return sf
+}
+
+// AddEvent 增加设备在t时刻的事件, params为事件的输出参数
+func (sf *PropertyHistory) AddEvent(pk, dn, eventID string, params interface{}, t time.Time) *PropertyHistory {
+	return sf.add(pk, dn, historyEntry{eventID, params, infra.Millisecond(t), true})
+}
+
+// Len 属性值及事件总数
+func (sf *PropertyHistory) Len() int {
+	n := 0
+	for _, dev := range sf.devices {
+		n += len(dev.entries)
+	}
+	return n
+}
+
+// Reset 清空已增加的历史数据
+func (sf *PropertyHistory) Reset() {
+	sf.devices = nil
+	sf.index = make(map[PropertyHistoryIdentity]*historyDevice)
+}
+
+// Build 按限制拆分为多次上报的params, 每个元素为一次 ThingEventPropertyHistoryPost 的params.
+// 同一设备同一时刻的属性值合并在同一属性对象中, 设备及值保持增加的顺序
+func (sf *PropertyHistory) Build(limit HistoryLimit) ([][]PropertyHistoryParams, error) {
+	b := &historyBatcher{limit: limit}
+	for _, dev := range sf.devices {
+		header, err := historyDeviceSize(dev.identity)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range dev.entries {
+			if err = b.add(dev.identity, header, e); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.finish()
+}
+
+// historyBatcher 按限制拆分历史数据
+// 大小按上限估算: 每个值视为独立的对象, 每个设备均包含properties及events, 合并只会使实际大小更小
+type historyBatcher struct {
+	limit   HistoryLimit
+	batches [][]PropertyHistoryParams
+
+	// 当前批次
+	current    []PropertyHistoryParams
+	devices    map[PropertyHistoryIdentity]int                          // 设备在current中的索引
+	properties map[PropertyHistoryIdentity][]map[string]json.RawMessage // 设备的属性对象
+	times      map[PropertyHistoryIdentity]map[int64]int                // 设备该时刻的属性对象索引
+	nProps     int
+	nEvents    int
+	size       int
+}
+
+func (sf *historyBatcher) add(identity PropertyHistoryIdentity, header int, e historyEntry) error {
+	raw, err := json.Marshal(e.value)
+	if err != nil {
+		return err
+	}
+	v := historyTimeValue(raw, e.time)
+	cost := historyEntrySize(e.identifier, v)
+
+	if !e.event {
+		// 同一属性同一时刻的值以后增加的为准
+		if j, ok := sf.times[identity][e.time]; ok {
+			obj := sf.properties[identity][j]
+			if old := obj[e.identifier]; old != nil {
+				size := sf.size + len(v) - len(old)
+				if sf.limit.Size <= 0 || size <= sf.limit.Size {
+					sf.size = size
+					obj[e.identifier] = v
+					return nil
+				}
+				// 替换后超出大小限制, 移除原值, 新值按新增的值加入
+				delete(obj, e.identifier)
+				sf.size -= historyEntrySize(e.identifier, old)
+				sf.nProps--
+			}
+		}
+	}
+
+	_, exist := sf.devices[identity]
+	if sf.current != nil && sf.exceed(exist, header, cost, e.event) {
+		if err = sf.flush(); err != nil {
+			return err
+		}
+		exist = false
+	}
+	if sf.current == nil {
+		sf.reset()
+	}
+	if !exist {
+		if sf.limit.Size > 0 && sf.size+header+cost > sf.limit.Size {
+			return ErrHistoryEntryTooLarge
+		}
+		sf.devices[identity] = len(sf.current)
+		sf.current = append(sf.current, PropertyHistoryParams{Identity: identity})
+		sf.times[identity] = make(map[int64]int)
+		sf.size += header
+	}
+	sf.size += cost
+
+	if e.event {
+		obj, err := json.Marshal(map[string]json.RawMessage{e.identifier: v})
+		if err != nil {
+			return err
+		}
+		i := sf.devices[identity]
+		sf.current[i].Events = append(sf.current[i].Events, obj)
+		sf.nEvents++
+		return nil
+	}
+	// 合并到同一时刻的属性对象
+	j, ok := sf.times[identity][e.time]
+	if !ok {
+		j = len(sf.properties[identity])
+		sf.times[identity][e.time] = j
+		sf.properties[identity] = append(sf.properties[identity], make(map[string]json.RawMessage))
+	}
+	sf.properties[identity][j][e.identifier] = v
+	sf.nProps++
+	return nil
+}
+
+// exceed 当前批次增加该值后是否超出限制
+func (sf *historyBatcher) exceed(exist bool, header, cost int, event bool) bool {
+	size := sf.size + cost
+	if !exist {
+		if sf.limit.Devices > 0 && len(sf.current) >= sf.limit.Devices {
+			return true
+		}
+		size += header
+	}
+	if event {
+		if sf.limit.Events > 0 && sf.nEvents >= sf.limit.Events {
+			return true
+		}
+	} else if sf.limit.Properties > 0 && sf.nProps >= sf.limit.Properties {
+		return true
+	}
+	return sf.limit.Size > 0 && size > sf.limit.Size
+}
+
+func (sf *historyBatcher) reset() {
+	sf.current = []PropertyHistoryParams{}
+	sf.devices = make(map[PropertyHistoryIdentity]int)
+	sf.properties = make(map[PropertyHistoryIdentity][]map[string]json.RawMessage)
+	sf.times = make(map[PropertyHistoryIdentity]map[int64]int)
+	sf.nProps, sf.nEvents = 0, 0
+	sf.size = 2 // []
+}
+
+// flush 序列化当前批次的属性对象并结束当前批次, 忽略值被全部移除的属性对象及设备
+func (sf *historyBatcher) flush() error {
+	for identity, objs := range sf.properties {
+		i := sf.devices[identity]
+		for _, obj := range objs {
+			if len(obj) == 0 {
+				continue
+			}
+			v, err := json.Marshal(obj)
+			if err != nil {
+				return err
+			}
+			sf.current[i].Properties = append(sf.current[i].Properties, v)
+		}
+	}
+	current := sf.current[:0]
+	for _, params := range sf.current {
+		if len(params.Properties) > 0 || len(params.Events) > 0 {
+			current = append(current, params)
+		}
+	}
+	if len(current) > 0 {
+		sf.batches = append(sf.batches, current)
+	}
+	sf.current = nil
+	return nil
+}
+
+func (sf *historyBatcher) finish() ([][]PropertyHistoryParams, error) {
+	if sf.current != nil {
+		if err := sf.flush(); err != nil {
+			return nil, err
+		}
+	}
+	return sf.batches, nil
+}
+
+// historyTimeValue {"value": raw, "time": ms}
+func historyTimeValue(raw json.RawMessage, t int64) json.RawMessage {
+	b := make([]byte, 0, len(raw)+32)
+	b = append(b, `{"value":`...)
+	b = append(b, raw...)
+	b = append(b, `,"time":`...)
+	b = strconv.AppendInt(b, t, 10)
+	return append(b, '}')
+}
+
+// historyEntrySize 值的大小上限: {"identifier":{"value":raw,"time":ms}},
+func historyEntrySize(identifier string, v json.RawMessage) int {
+	id, _ := json.Marshal(identifier)
+	return len(id) + len(v) + 4
+}
+
+// historyDeviceSize 设备的大小上限: {"identity":{...},"properties":[],"events":[]},
+func historyDeviceSize(identity PropertyHistoryIdentity) (int, error) {
+	b, err := json.Marshal(identity)
+	if err != nil {
+		return 0, err
+	}
+	return len(`{"identity":,"properties":[],"events":[]},`) + len(b), nil
+}
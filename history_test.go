@@ -0,0 +1,174 @@
+package aiot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/tsl"
+)
+
+func TestPropertyHistoryBuild(t *testing.T) {
+	t1 := time.UnixMilli(1524448722000)
+	t2 := t1.Add(time.Second)
+
+	h := NewPropertyHistory().
+		AddProperties("pk", "dn1", map[string]interface{}{"temperature": 25.5, "switch": 1}, t1).
+		AddProperty("pk", "dn1", "temperature", 26, t2).
+		AddEvent("pk", "dn1", "overheat", map[string]interface{}{"value": 80}, t2).
+		AddProperty("pk", "dn2", "switch", 0, t1).
+		AddProperty("pk", "dn1", "temperature", 25.6, t1) // 同一时刻的值以后增加的为准
+	require.Equal(t, 6, h.Len())
+
+	batches, err := h.Build(HistoryLimit{})
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	b, err := json.Marshal(batches[0])
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+	{
+		"identity": {"productKey": "pk", "deviceName": "dn1"},
+		"properties": [
+			{"switch": {"value": 1, "time": 1524448722000}, "temperature": {"value": 25.6, "time": 1524448722000}},
+			{"temperature": {"value": 26, "time": 1524448723000}}
+		],
+		"events": [
+			{"overheat": {"value": {"value": 80}, "time": 1524448723000}}
+		]
+	},
+	{
+		"identity": {"productKey": "pk", "deviceName": "dn2"},
+		"properties": [{"switch": {"value": 0, "time": 1524448722000}}]
+	}]`, string(b))
+
+	// 按设备数拆分
+	batches, err = h.Build(HistoryLimit{Devices: 1})
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+
+	// 按属性值个数及事件个数拆分
+	h.Reset()
+	for i := 0; i < 5; i++ {
+		h.AddProperty("pk", "dn", "temperature", i, t1.Add(time.Duration(i)*time.Second))
+		h.AddEvent("pk", "dn", "overheat", map[string]interface{}{"value": i}, t1)
+	}
+	batches, err = h.Build(HistoryLimit{Properties: 2, Events: 3})
+	require.NoError(t, err)
+	require.Len(t, batches, 3)
+	require.Len(t, batches[0][0].Properties, 2)
+	require.Len(t, batches[0][0].Events, 2)
+	require.Len(t, batches[2][0].Properties, 1)
+
+	// 按大小拆分, 每次上报不超过限制
+	h.Reset()
+	for i := 0; i < 100; i++ {
+		h.AddProperty("pk", "dn", "label", strings.Repeat("a", 50), t1.Add(time.Duration(i)*time.Second))
+	}
+	limit := HistoryLimit{Size: 1024}
+	batches, err = h.Build(limit)
+	require.NoError(t, err)
+	require.Greater(t, len(batches), 1)
+	n := 0
+	for _, params := range batches {
+		b, err = json.Marshal(params)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(b), limit.Size)
+		n += len(params[0].Properties)
+	}
+	require.Equal(t, 100, n)
+
+	// 同一时刻替换为更大的值时同样检查大小限制
+	h.Reset()
+	h.AddProperty("pk", "dn", "label", strings.Repeat("a", 400), t1).
+		AddProperty("pk", "dn", "name", strings.Repeat("b", 400), t1).
+		AddProperty("pk", "dn", "label", strings.Repeat("c", 600), t1)
+	batches, err = h.Build(limit)
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+	for _, params := range batches {
+		b, err = json.Marshal(params)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(b), limit.Size)
+	}
+	require.JSONEq(t, `{"name":{"value":"`+strings.Repeat("b", 400)+`","time":1524448722000}}`,
+		string(batches[0][0].Properties[0]))
+	require.JSONEq(t, `{"label":{"value":"`+strings.Repeat("c", 600)+`","time":1524448722000}}`,
+		string(batches[1][0].Properties[0]))
+
+	h.AddProperty("pk", "dn", "label", strings.Repeat("a", 2048), t1)
+	_, err = h.Build(limit)
+	require.Equal(t, ErrHistoryEntryTooLarge, err)
+}
+
+func TestThingEventPropertyHistoryPostBatch(t *testing.T) {
+	thing, err := tsl.LoadFile("tsl/testdata/thing.json")
+	require.NoError(t, err)
+	thing.Profile.ProductKey = "pk"
+
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn,
+		WithHistoryLimit(HistoryLimit{Properties: 2}), WithThingModel(thing))
+
+	now := time.Now()
+	h := NewPropertyHistory()
+	for i := 0; i < 3; i++ {
+		h.AddProperty("pk", "dn", "temperature", 20+i, now.Add(time.Duration(i)*time.Second))
+	}
+	tokens, err := c.ThingEventPropertyHistoryPostBatch(h)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	msgs := conn.messages()
+	require.Len(t, msgs, 2)
+	for _, msg := range msgs {
+		require.Equal(t, "/sys/pk/dn/thing/event/property/history/post", msg.topic)
+	}
+
+	// 不符合物模型
+	h.AddProperty("pk", "dn", "temperature", 200, now)
+	_, err = c.ThingEventPropertyHistoryPostBatch(h)
+	require.Error(t, err)
+	require.Len(t, conn.messages(), 2)
+
+	// 拆分上报失败时返回已应答的上报次数
+	h.Reset()
+	for i := 0; i < 5; i++ {
+		h.AddProperty("pk", "dn", "temperature", 20+i, now.Add(time.Duration(i)*time.Second))
+	}
+	n := 0
+	conn.onPublish = func(topic string, payload []byte) {
+		req := struct {
+			ID uint `json:"id,string"`
+		}{}
+		if json.Unmarshal(payload, &req) != nil {
+			return
+		}
+		code := infra.CodeSuccess
+		if n++; n == 2 {
+			code = infra.CodeRequestError
+		}
+		ProcThingEventPropertyHistoryPostReply(c, topic+"_reply", // nolint: errcheck
+			[]byte(fmt.Sprintf(`{"id":"%d","code":%d}`, req.ID, code)))
+	}
+	err = c.LinkThingEventPropertyHistoryPostBatch(h, time.Second)
+	var batchErr *HistoryBatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Equal(t, 1, batchErr.Acked)
+	require.Equal(t, 3, batchErr.Total)
+	require.Equal(t, 2, n)
+	conn.onPublish = nil
+
+	// 带时间戳的属性上报
+	_, err = c.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temperature": NewTimeValue(21.5, now)})
+	require.NoError(t, err)
+	req := struct {
+		Params map[string]TimeValue `json:"params"`
+	}{}
+	msgs = conn.messages()
+	require.NoError(t, json.Unmarshal(msgs[len(msgs)-1].payload, &req))
+	require.Equal(t, TimeValue{21.5, infra.Millisecond(now)}, req.Params["temperature"])
+}
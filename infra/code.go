@@ -194,3 +194,8 @@ func (sf *CodeError) Error() string {
 func (sf *CodeError) Code() int {
 	return sf.code
 }
+
+// Message 错误信息
+func (sf *CodeError) Message() string {
+	return sf.message
+}
@@ -29,4 +29,16 @@ const (
 	MethodCombineLogout            = "combine.logout"
 	MethodCombineBatchLogin        = "combine.batch.login"
 	MethodCombineBatchLogout       = "combine.batch.logout"
+	MethodDiagPost                 = "_thing.diag.post" // 请求中不带method,仅用于标识
+	MethodModelUpRaw               = "thing.model.up_raw"
+	MethodModelDownRaw             = "thing.model.down_raw"
+	MethodConfigPush               = "thing.config.push"
+	MethodConfigLogPush            = "thing.config.log.push"
+	MethodServicePropertySet       = "thing.service.property.set"
+	MethodServiceFormat            = "thing.service.%s"
+	MethodTopoAddNotify            = "thing.topo.add.notify"
+	MethodTopoChange               = "thing.topo.change"
+	MethodDisable                  = "thing.disable"
+	MethodEnable                   = "thing.enable"
+	MethodDelete                   = "thing.delete"
 )
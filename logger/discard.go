@@ -40,3 +40,23 @@ func (sf Discard) DPanicf(string, ...interface{}) {}
 
 // Fatalf implement Logger interface.
 func (sf Discard) Fatalf(string, ...interface{}) {}
+
+var _ StructuredLogger = (*Discard)(nil)
+
+// Debug implement StructuredLogger interface.
+func (sf Discard) Debug(string, ...interface{}) {}
+
+// Info implement StructuredLogger interface.
+func (sf Discard) Info(string, ...interface{}) {}
+
+// Warn implement StructuredLogger interface.
+func (sf Discard) Warn(string, ...interface{}) {}
+
+// Error implement StructuredLogger interface.
+func (sf Discard) Error(string, ...interface{}) {}
+
+// With implement StructuredLogger interface.
+func (sf Discard) With(...interface{}) StructuredLogger { return sf }
+
+// SetLevel implement StructuredLogger interface.
+func (sf Discard) SetLevel(Level) {}
@@ -1,9 +1,12 @@
 package logger
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestStd(_ *testing.T) {
@@ -26,3 +29,37 @@ func TestDiscard(_ *testing.T) {
 	l.DPanicf("")
 	l.Fatalf("")
 }
+
+type captureStd struct {
+	Discard
+	lines []string
+}
+
+func (sf *captureStd) Debugf(format string, args ...interface{}) {
+	sf.lines = append(sf.lines, fmt.Sprintf(format, args...))
+}
+
+func (sf *captureStd) Warnf(format string, args ...interface{}) {
+	sf.lines = append(sf.lines, fmt.Sprintf(format, args...))
+}
+
+func TestWrap(t *testing.T) {
+	std := &captureStd{}
+	l := Wrap(printfOnly{std})
+	dl := l.With("productKey", "pk", "deviceName", "dn")
+	dl.Debug("thing.event.property.post", "requestID", 1, "odd")
+	l.SetLevel(LevelWarn)
+	dl.Debug("ignored")
+	dl.Debugf("ignored")
+	dl.Warn("warn", "error", "timeout")
+	require.Equal(t, []string{
+		"thing.event.property.post productKey=pk deviceName=dn requestID=1 odd=!MISSING",
+		"warn productKey=pk deviceName=dn error=timeout",
+	}, std.lines)
+
+	d := NewDiscard()
+	require.Equal(t, d, Wrap(d))
+}
+
+// printfOnly 仅实现Logger接口
+type printfOnly struct{ Logger }
@@ -0,0 +1,104 @@
+// Copyright [2020] [thinkgos] thinkgo@aliyun.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package slogx
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/things-go/aliyun-iot/logger"
+)
+
+// Logger log/slog适配
+type Logger struct {
+	l     *slog.Logger
+	level *logger.AtomicLevel
+}
+
+var _ logger.StructuredLogger = (*Logger)(nil)
+
+// New 新建slog适配, 日志级别默认为 logger.LevelDebug, 同时受slog.Handler自身级别的限制
+func New(l *slog.Logger) *Logger {
+	return &Logger{l, logger.NewAtomicLevel(logger.LevelDebug)}
+}
+
+func (sf *Logger) log(l logger.Level, lv slog.Level, msg string, keysAndValues ...interface{}) {
+	if sf.level.Enabled(l) {
+		sf.l.Log(context.Background(), lv, msg, keysAndValues...)
+	}
+}
+
+// Debugf implement logger.Logger interface.
+func (sf *Logger) Debugf(format string, args ...interface{}) {
+	sf.log(logger.LevelDebug, slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+
+// Infof implement logger.Logger interface.
+func (sf *Logger) Infof(format string, args ...interface{}) {
+	sf.log(logger.LevelInfo, slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+
+// Warnf implement logger.Logger interface.
+func (sf *Logger) Warnf(format string, args ...interface{}) {
+	sf.log(logger.LevelWarn, slog.LevelWarn, fmt.Sprintf(format, args...))
+}
+
+// Errorf implement logger.Logger interface.
+func (sf *Logger) Errorf(format string, args ...interface{}) {
+	sf.log(logger.LevelError, slog.LevelError, fmt.Sprintf(format, args...))
+}
+
+// DPanicf implement logger.Logger interface.
+func (sf *Logger) DPanicf(format string, args ...interface{}) {
+	sf.l.Error(fmt.Sprintf(format, args...))
+}
+
+// Fatalf implement logger.Logger interface.
+func (sf *Logger) Fatalf(format string, args ...interface{}) {
+	sf.l.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Debug implement logger.StructuredLogger interface.
+func (sf *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	sf.log(logger.LevelDebug, slog.LevelDebug, msg, keysAndValues...)
+}
+
+// Info implement logger.StructuredLogger interface.
+func (sf *Logger) Info(msg string, keysAndValues ...interface{}) {
+	sf.log(logger.LevelInfo, slog.LevelInfo, msg, keysAndValues...)
+}
+
+// Warn implement logger.StructuredLogger interface.
+func (sf *Logger) Warn(msg string, keysAndValues ...interface{}) {
+	sf.log(logger.LevelWarn, slog.LevelWarn, msg, keysAndValues...)
+}
+
+// Error implement logger.StructuredLogger interface.
+func (sf *Logger) Error(msg string, keysAndValues ...interface{}) {
+	sf.log(logger.LevelError, slog.LevelError, msg, keysAndValues...)
+}
+
+// With implement logger.StructuredLogger interface.
+func (sf *Logger) With(keysAndValues ...interface{}) logger.StructuredLogger {
+	return &Logger{sf.l.With(keysAndValues...), sf.level}
+}
+
+// SetLevel implement logger.StructuredLogger interface.
+func (sf *Logger) SetLevel(l logger.Level) { sf.level.SetLevel(l) }
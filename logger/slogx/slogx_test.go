@@ -0,0 +1,36 @@
+//go:build go1.21
+
+package slogx
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/logger"
+)
+
+func TestLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	dl := l.With("productKey", "pk", "deviceName", "dn")
+	dl.Debug("thing.event.property.post", "requestID", 1)
+	l.SetLevel(logger.LevelWarn)
+	dl.Info("ignored")
+	l.Warnf("hello %s", "world")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	m := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &m))
+	require.Equal(t, "thing.event.property.post", m["msg"])
+	require.Equal(t, "pk", m["productKey"])
+	require.Equal(t, "dn", m["deviceName"])
+	require.Equal(t, float64(1), m["requestID"])
+	require.True(t, strings.Contains(lines[1], `"msg":"hello world"`))
+}
@@ -0,0 +1,174 @@
+// Copyright [2020] [thinkgos] thinkgo@aliyun.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Level 日志级别
+type Level int32
+
+// 日志级别,从低到高
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String 实现fmt.Stringer接口
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("Level(%d)", int32(l))
+}
+
+// AtomicLevel 可在运行时修改的日志级别,协程安全
+type AtomicLevel struct {
+	v int32
+}
+
+// NewAtomicLevel 新建日志级别
+func NewAtomicLevel(l Level) *AtomicLevel {
+	return &AtomicLevel{int32(l)}
+}
+
+// Level 当前日志级别
+func (sf *AtomicLevel) Level() Level { return Level(atomic.LoadInt32(&sf.v)) }
+
+// SetLevel 修改日志级别
+func (sf *AtomicLevel) SetLevel(l Level) { atomic.StoreInt32(&sf.v, int32(l)) }
+
+// Enabled 级别l的日志是否输出
+func (sf *AtomicLevel) Enabled(l Level) bool { return l >= sf.Level() }
+
+// StructuredLogger 结构化日志接口
+// keysAndValues 为交替的键值对, 如 "requestID", 1, "topic", "/sys/pk/dn/thing/event/property/post"
+type StructuredLogger interface {
+	Logger
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+	// With 返回携带固定字段的子日志, 子日志与父日志共享日志级别
+	With(keysAndValues ...interface{}) StructuredLogger
+	// SetLevel 运行时修改日志级别
+	SetLevel(l Level)
+}
+
+// Wrap 将printf风格的Logger适配为StructuredLogger, 字段以 key=value 格式追加在消息后
+// l已实现StructuredLogger时直接返回
+func Wrap(l Logger) StructuredLogger {
+	if sl, ok := l.(StructuredLogger); ok {
+		return sl
+	}
+	return &wrapped{l, NewAtomicLevel(LevelDebug), ""}
+}
+
+type wrapped struct {
+	l      Logger
+	level  *AtomicLevel
+	fields string
+}
+
+var _ StructuredLogger = (*wrapped)(nil)
+
+func (sf *wrapped) Debugf(format string, args ...interface{}) {
+	if sf.level.Enabled(LevelDebug) {
+		sf.l.Debugf(format, args...)
+	}
+}
+
+func (sf *wrapped) Infof(format string, args ...interface{}) {
+	if sf.level.Enabled(LevelInfo) {
+		sf.l.Infof(format, args...)
+	}
+}
+
+func (sf *wrapped) Warnf(format string, args ...interface{}) {
+	if sf.level.Enabled(LevelWarn) {
+		sf.l.Warnf(format, args...)
+	}
+}
+
+func (sf *wrapped) Errorf(format string, args ...interface{}) {
+	if sf.level.Enabled(LevelError) {
+		sf.l.Errorf(format, args...)
+	}
+}
+
+func (sf *wrapped) DPanicf(format string, args ...interface{}) { sf.l.DPanicf(format, args...) }
+func (sf *wrapped) Fatalf(format string, args ...interface{})  { sf.l.Fatalf(format, args...) }
+
+func (sf *wrapped) Debug(msg string, keysAndValues ...interface{}) {
+	if sf.level.Enabled(LevelDebug) {
+		sf.l.Debugf("%s", sf.format(msg, keysAndValues))
+	}
+}
+
+func (sf *wrapped) Info(msg string, keysAndValues ...interface{}) {
+	if sf.level.Enabled(LevelInfo) {
+		sf.l.Infof("%s", sf.format(msg, keysAndValues))
+	}
+}
+
+func (sf *wrapped) Warn(msg string, keysAndValues ...interface{}) {
+	if sf.level.Enabled(LevelWarn) {
+		sf.l.Warnf("%s", sf.format(msg, keysAndValues))
+	}
+}
+
+func (sf *wrapped) Error(msg string, keysAndValues ...interface{}) {
+	if sf.level.Enabled(LevelError) {
+		sf.l.Errorf("%s", sf.format(msg, keysAndValues))
+	}
+}
+
+func (sf *wrapped) With(keysAndValues ...interface{}) StructuredLogger {
+	return &wrapped{sf.l, sf.level, sf.fields + FormatFields(keysAndValues...)}
+}
+
+func (sf *wrapped) SetLevel(l Level) { sf.level.SetLevel(l) }
+
+func (sf *wrapped) format(msg string, keysAndValues []interface{}) string {
+	return msg + sf.fields + FormatFields(keysAndValues...)
+}
+
+// FormatFields 将键值对格式化为 " key=value key=value", 缺少值的键值为 "!MISSING"
+func FormatFields(keysAndValues ...interface{}) string {
+	if len(keysAndValues) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var v interface{} = "!MISSING"
+		if i+1 < len(keysAndValues) {
+			v = keysAndValues[i+1]
+		}
+		fmt.Fprintf(&b, " %v=%+v", keysAndValues[i], v)
+	}
+	return b.String()
+}
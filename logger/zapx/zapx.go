@@ -0,0 +1,108 @@
+// Copyright [2020] [thinkgos] thinkgo@aliyun.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package zapx 实现logger.StructuredLogger的zap适配
+package zapx
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/things-go/aliyun-iot/logger"
+)
+
+// Logger zap适配
+type Logger struct {
+	l     *zap.SugaredLogger
+	level *logger.AtomicLevel
+}
+
+var _ logger.StructuredLogger = (*Logger)(nil)
+
+// New 新建zap适配, 日志级别默认为 logger.LevelDebug, 同时受zap自身级别的限制
+func New(l *zap.Logger) *Logger {
+	return &Logger{
+		l.WithOptions(zap.AddCallerSkip(1)).Sugar(),
+		logger.NewAtomicLevel(logger.LevelDebug),
+	}
+}
+
+// Debugf implement logger.Logger interface.
+func (sf *Logger) Debugf(format string, args ...interface{}) {
+	if sf.level.Enabled(logger.LevelDebug) {
+		sf.l.Debugf(format, args...)
+	}
+}
+
+// Infof implement logger.Logger interface.
+func (sf *Logger) Infof(format string, args ...interface{}) {
+	if sf.level.Enabled(logger.LevelInfo) {
+		sf.l.Infof(format, args...)
+	}
+}
+
+// Warnf implement logger.Logger interface.
+func (sf *Logger) Warnf(format string, args ...interface{}) {
+	if sf.level.Enabled(logger.LevelWarn) {
+		sf.l.Warnf(format, args...)
+	}
+}
+
+// Errorf implement logger.Logger interface.
+func (sf *Logger) Errorf(format string, args ...interface{}) {
+	if sf.level.Enabled(logger.LevelError) {
+		sf.l.Errorf(format, args...)
+	}
+}
+
+// DPanicf implement logger.Logger interface.
+func (sf *Logger) DPanicf(format string, args ...interface{}) { sf.l.DPanicf(format, args...) }
+
+// Fatalf implement logger.Logger interface.
+func (sf *Logger) Fatalf(format string, args ...interface{}) { sf.l.Fatalf(format, args...) }
+
+// Debug implement logger.StructuredLogger interface.
+func (sf *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	if sf.level.Enabled(logger.LevelDebug) {
+		sf.l.Debugw(msg, keysAndValues...)
+	}
+}
+
+// Info implement logger.StructuredLogger interface.
+func (sf *Logger) Info(msg string, keysAndValues ...interface{}) {
+	if sf.level.Enabled(logger.LevelInfo) {
+		sf.l.Infow(msg, keysAndValues...)
+	}
+}
+
+// Warn implement logger.StructuredLogger interface.
+func (sf *Logger) Warn(msg string, keysAndValues ...interface{}) {
+	if sf.level.Enabled(logger.LevelWarn) {
+		sf.l.Warnw(msg, keysAndValues...)
+	}
+}
+
+// Error implement logger.StructuredLogger interface.
+func (sf *Logger) Error(msg string, keysAndValues ...interface{}) {
+	if sf.level.Enabled(logger.LevelError) {
+		sf.l.Errorw(msg, keysAndValues...)
+	}
+}
+
+// With implement logger.StructuredLogger interface.
+func (sf *Logger) With(keysAndValues ...interface{}) logger.StructuredLogger {
+	return &Logger{sf.l.With(keysAndValues...), sf.level}
+}
+
+// SetLevel implement logger.StructuredLogger interface.
+func (sf *Logger) SetLevel(l logger.Level) { sf.level.SetLevel(l) }
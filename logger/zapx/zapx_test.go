@@ -0,0 +1,34 @@
+package zapx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/things-go/aliyun-iot/logger"
+)
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	l := New(zap.New(core))
+
+	dl := l.With("productKey", "pk", "deviceName", "dn")
+	dl.Debug("thing.event.property.post", "requestID", 1)
+	l.SetLevel(logger.LevelWarn)
+	dl.Info("ignored")
+	l.Warnf("hello %s", "world")
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+	require.Equal(t, "thing.event.property.post", entries[0].Message)
+	require.Equal(t, map[string]interface{}{
+		"productKey": "pk",
+		"deviceName": "dn",
+		"requestID":  int64(1),
+	}, entries[0].ContextMap())
+	require.Equal(t, "hello world", entries[1].Message)
+	require.Equal(t, zapcore.WarnLevel, entries[1].Level)
+}
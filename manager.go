@@ -28,6 +28,11 @@ type DevMgr struct {
 	root  DevNode // 网关设备节点或独立设备节点信息
 	rw    sync.RWMutex
 	nodes map[string]*DevNode
+	// onlineChange 在线子设备数可能变化时调用
+	onlineChange func(n int)
+
+	twinMu       sync.RWMutex
+	twinWatchers []TwinWatcher
 }
 
 // DevNode 设备节点
@@ -38,6 +43,7 @@ type DevNode struct {
 	avail        bool
 	status       DevStatus
 	ext          interface{}
+	twin         *Twin
 }
 
 // ProductKey 获得productKey
@@ -58,20 +64,23 @@ func (sf *DevNode) Status() DevStatus { return sf.status }
 // Extend 获得扩展参数值
 func (sf *DevNode) Extend() interface{} { return sf.ext }
 
+// Twin 获得设备影子
+func (sf *DevNode) Twin() *Twin { return sf.twin }
+
 // NewDevMgr 设备管理是一个线程安全
 // root: 网关设备
 func NewDevMgr(root infra.MetaTriad) *DevMgr {
-	return &DevMgr{
-		root: DevNode{
-			root.ProductKey,
-			root.DeviceName,
-			root.DeviceSecret,
-			true,
-			DevStatusOnline,
-			nil,
-		},
-		nodes: make(map[string]*DevNode),
+	m := &DevMgr{nodes: make(map[string]*DevNode)}
+	m.root = DevNode{
+		root.ProductKey,
+		root.DeviceName,
+		root.DeviceSecret,
+		true,
+		DevStatusOnline,
+		nil,
+		newTwin(root.ProductKey, root.DeviceName, m.notifyTwin),
 	}
+	return m
 }
 
 // Len 设备个数,含root设备
@@ -104,6 +113,7 @@ func (sf *DevMgr) Add(meta infra.MetaTriad) error {
 		true,
 		DevStatusUnauthorized,
 		nil,
+		newTwin(meta.ProductKey, meta.DeviceName, sf.notifyTwin),
 	}
 	return nil
 }
@@ -113,6 +123,7 @@ func (sf *DevMgr) Delete(pk, dn string) {
 	sf.rw.Lock()
 	defer sf.rw.Unlock()
 	delete(sf.nodes, FormatKey(pk, dn))
+	sf.notifyOnlineLocked()
 }
 
 func (sf *DevMgr) searchLocked(pk, dn string) (*DevNode, error) {
@@ -193,6 +204,7 @@ func (sf *DevMgr) SetDeviceAvail(pk, dn string, enable bool) error {
 		return err
 	}
 	node.avail = enable
+	sf.notifyOnlineLocked()
 	return nil
 }
 
@@ -218,6 +230,7 @@ func (sf *DevMgr) SetDeviceStatus(pk, dn string, status DevStatus) error {
 		return err
 	}
 	node.status = status
+	sf.notifyOnlineLocked()
 	return nil
 }
 
@@ -231,9 +244,41 @@ func (sf *DevMgr) DeviceStatus(pk, dn string, status DevStatus) error {
 		return err
 	}
 	node.status = status
+	sf.notifyOnlineLocked()
 	return nil
 }
 
+// SubDevices 获取处于status状态且avail = true的子设备,不含root设备
+func (sf *DevMgr) SubDevices(status DevStatus) []infra.MetaPair {
+	sf.rw.RLock()
+	defer sf.rw.RUnlock()
+
+	pairs := make([]infra.MetaPair, 0, len(sf.nodes))
+	for _, node := range sf.nodes {
+		if node.avail && node.status == status {
+			pairs = append(pairs, infra.MetaPair{
+				ProductKey: node.productKey,
+				DeviceName: node.deviceName,
+			})
+		}
+	}
+	return pairs
+}
+
+// notifyOnlineLocked 通知在线子设备数
+func (sf *DevMgr) notifyOnlineLocked() {
+	if sf.onlineChange == nil {
+		return
+	}
+	n := 0
+	for _, node := range sf.nodes {
+		if node.avail && node.status == DevStatusOnline {
+			n++
+		}
+	}
+	sf.onlineChange(n)
+}
+
 // FormatKey format pk dn --> {pk}.{dn}
 func FormatKey(pk, dn string) string {
 	return pk + "." + dn
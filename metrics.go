@@ -0,0 +1,65 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"errors"
+	"time"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+// Metrics 客户端指标接口,实现需协程安全
+// prometheus实现见 aprom 包
+type Metrics interface {
+	// IncRequest 发送请求
+	IncRequest(method string)
+	// IncReply 收到回复, code为平台回复的错误码
+	IncReply(method string, code int)
+	// ObserveLatency 请求到收到回复的耗时
+	ObserveLatency(method string, d time.Duration)
+	// IncTimeout 等待回复超时
+	IncTimeout(method string)
+	// IncPublishFailure 发布消息失败
+	IncPublishFailure(method string)
+	// SetOnlineSubDevices 在线子设备数
+	SetOnlineSubDevices(n int)
+}
+
+// NopMetrics 实现Metrics接口的空实现
+type NopMetrics struct{}
+
+// 确保 NopMetrics 实现 Metrics 接口
+var _ Metrics = NopMetrics{}
+
+// IncRequest see interface Metrics
+func (NopMetrics) IncRequest(string) {}
+
+// IncReply see interface Metrics
+func (NopMetrics) IncReply(string, int) {}
+
+// ObserveLatency see interface Metrics
+func (NopMetrics) ObserveLatency(string, time.Duration) {}
+
+// IncTimeout see interface Metrics
+func (NopMetrics) IncTimeout(string) {}
+
+// IncPublishFailure see interface Metrics
+func (NopMetrics) IncPublishFailure(string) {}
+
+// SetOnlineSubDevices see interface Metrics
+func (NopMetrics) SetOnlineSubDevices(int) {}
+
+// replyCode 获取回复的错误码
+func replyCode(err error) int {
+	if err == nil {
+		return infra.CodeSuccess
+	}
+	var ce *infra.CodeError
+	if errors.As(err, &ce) {
+		return ce.Code()
+	}
+	return infra.CodeRequestError
+}
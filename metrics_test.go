@@ -0,0 +1,85 @@
+package aiot
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+type recordMetrics struct {
+	mu       sync.Mutex
+	requests []string
+	replies  []int
+	timeouts []string
+	failures []string
+	online   int
+}
+
+func (sf *recordMetrics) IncRequest(method string) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.requests = append(sf.requests, method)
+}
+
+func (sf *recordMetrics) IncReply(_ string, code int) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.replies = append(sf.replies, code)
+}
+
+func (sf *recordMetrics) ObserveLatency(string, time.Duration) {}
+
+func (sf *recordMetrics) IncTimeout(method string) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.timeouts = append(sf.timeouts, method)
+}
+
+func (sf *recordMetrics) IncPublishFailure(method string) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.failures = append(sf.failures, method)
+}
+
+func (sf *recordMetrics) SetOnlineSubDevices(n int) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.online = n
+}
+
+func TestMetricsHook(t *testing.T) {
+	m := &recordMetrics{}
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn, WithMetrics(m), WithEnableGateway())
+
+	token, err := c.SendRequest("/sys/pk/dn/thing/config/get", infra.MethodConfigGet, struct{}{})
+	require.NoError(t, err)
+	err = ProcThingConfigGetReply(c, "/sys/pk/dn/thing/config/get_reply",
+		[]byte(`{"id":"`+strconv.FormatUint(uint64(token.id), 10)+`","code":6713,"data":{}}`))
+	require.NoError(t, err)
+
+	token, err = c.SendRequest("/sys/pk/dn/thing/config/get", infra.MethodConfigGet, struct{}{})
+	require.NoError(t, err)
+	_, err = token.Wait(time.Millisecond)
+	require.Equal(t, ErrWaitTimeout, err)
+
+	conn.setOffline(true)
+	_, err = c.SendRequest("/sys/pk/dn/thing/config/get", infra.MethodConfigGet, struct{}{})
+	require.Error(t, err)
+
+	require.NoError(t, c.AddSubDevice(infra.MetaTriad{ProductKey: "pk", DeviceName: "sub"}))
+	require.NoError(t, c.SetDeviceStatus("pk", "sub", DevStatusOnline))
+	require.Equal(t, 1, m.online)
+	c.Delete("pk", "sub")
+
+	require.Equal(t, []string{infra.MethodConfigGet, infra.MethodConfigGet}, m.requests)
+	require.Equal(t, []int{infra.CodeRemoteConfigServiceDisabled}, m.replies)
+	require.Equal(t, []string{infra.MethodConfigGet}, m.timeouts)
+	require.Equal(t, []string{infra.MethodConfigGet}, m.failures)
+	require.Equal(t, 0, m.online)
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware 下行数据处理中间件
+type Middleware func(next ProcDownStream) ProcDownStream
+
+// middlewares 中间件链
+type middlewares struct {
+	mu    sync.RWMutex
+	chain []Middleware
+}
+
+// Use 添加中间件,先添加的中间件在外层,对 SubscribeAllTopic 的所有订阅生效,
+// 可在订阅后添加
+func (sf *Client) Use(mws ...Middleware) {
+	sf.middlewares.mu.Lock()
+	defer sf.middlewares.mu.Unlock()
+	sf.middlewares.chain = append(sf.middlewares.chain, mws...)
+}
+
+// wrap 使用中间件链包装下行数据处理函数,每次处理时获取当前的中间件链,
+// 使能链路追踪时最外层为追踪
+func (sf *Client) wrap(streamFunc ProcDownStream) ProcDownStream {
+	return sf.wrapContext(func(_ context.Context, c *Client, rawURI string, payload []byte) error {
+		return streamFunc(c, rawURI, payload)
+	})
+}
+
+// wrapContext 同 wrap, streamFunc的ctx为下行数据处理的上下文, 使能链路追踪时包含下行span
+func (sf *Client) wrapContext(streamFunc ProcDownStreamContext) ProcDownStream {
+	return func(c *Client, rawURI string, payload []byte) error {
+		sf.middlewares.mu.RLock()
+		chain := sf.middlewares.chain
+		sf.middlewares.mu.RUnlock()
+
+		ctx := context.Background()
+		var span trace.Span
+		if sf.tracer != nil {
+			ctx, span = sf.startDownStreamSpan(ctx, rawURI, payload)
+		}
+		h := func(c *Client, rawURI string, payload []byte) error {
+			return streamFunc(ctx, c, rawURI, payload)
+		}
+		for i := len(chain) - 1; i >= 0; i-- {
+			h = chain[i](h)
+		}
+		err := h(c, rawURI, payload)
+		if span != nil {
+			endSpan(span, err)
+		}
+		return err
+	}
+}
+
+// subscribe 订阅topic, 处理函数经过中间件链
+func (sf *Client) subscribe(topic string, streamFunc ProcDownStream) error {
+	return sf.Subscribe(topic, sf.wrap(streamFunc))
+}
+
+// subscribeContext 同 subscribe, 处理函数可获取下行数据处理的上下文
+func (sf *Client) subscribeContext(topic string, streamFunc ProcDownStreamContext) error {
+	return sf.Subscribe(topic, sf.wrapContext(streamFunc))
+}
+
+// Recovery 捕获处理函数的panic,转换为错误返回
+func Recovery() Middleware {
+	return func(next ProcDownStream) ProcDownStream {
+		return func(c *Client, rawURI string, payload []byte) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					c.StructuredLog().Error("panic", "topic", rawURI, "panic", r, "stack", string(debug.Stack()))
+					err = fmt.Errorf("topic: %s, panic: %v", rawURI, r)
+				}
+			}()
+			return next(c, rawURI, payload)
+		}
+	}
+}
+
+// DefaultRedactKeys 默认脱敏的json字段
+var DefaultRedactKeys = []string{"deviceSecret", "sign", "password"}
+
+// Logging 以Debug级别记录下行数据及处理耗时, 以Error级别记录处理错误
+// redactKeys: 需脱敏的json字段,为空时使用 DefaultRedactKeys
+func Logging(redactKeys ...string) Middleware {
+	if len(redactKeys) == 0 {
+		redactKeys = DefaultRedactKeys
+	}
+	quoted := make([]string, 0, len(redactKeys))
+	for _, k := range redactKeys {
+		quoted = append(quoted, regexp.QuoteMeta(k))
+	}
+	re := regexp.MustCompile(`("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+	return func(next ProcDownStream) ProcDownStream {
+		return func(c *Client, rawURI string, payload []byte) error {
+			start := time.Now()
+			err := next(c, rawURI, payload)
+			c.StructuredLog().Debug("downstream", "topic", rawURI, "payload", string(re.ReplaceAll(payload, []byte(`$1"***"`))), "cost", time.Since(start))
+			if err != nil {
+				c.StructuredLog().Error("process failed", "topic", rawURI, "error", err)
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package aiot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/logger"
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+type captureLogger struct {
+	logger.Discard
+	mu    sync.Mutex
+	lines []string
+}
+
+func (sf *captureLogger) Debug(msg string, keysAndValues ...interface{}) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.lines = append(sf.lines, msg+logger.FormatFields(keysAndValues...))
+}
+
+// printfLogger 只实现 logger.Logger 的日志
+type printfLogger struct {
+	logger.Logger
+	lines []string
+}
+
+func (sf *printfLogger) Debugf(format string, args ...interface{}) {
+	sf.lines = append(sf.lines, fmt.Sprintf(format, args...))
+}
+
+func TestMiddleware(t *testing.T) {
+	conn := newMockConn()
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next ProcDownStream) ProcDownStream {
+			return func(c *Client, rawURI string, payload []byte) error {
+				order = append(order, name)
+				return next(c, rawURI, payload)
+			}
+		}
+	}
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn, WithMiddleware(mw("a")))
+	require.NoError(t, c.SubscribeAllTopic("pk", "dn", false))
+	// 订阅后添加的中间件同样生效
+	c.Use(mw("b"), Recovery())
+	c.HandleService("reboot", func(*Client, string, string, []byte) error { panic("boom") })
+
+	topic := uri.URI(uri.SysPrefix, uri.ThingServiceRequestWildcardSome, "pk", "dn")
+	h, ok := conn.subscribe[topic]
+	require.True(t, ok)
+	err := h(c, "/sys/pk/dn/thing/service/reboot", []byte(`{"id":"1"}`))
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "boom"))
+	require.Equal(t, []string{"a", "b"}, order)
+}
+
+func TestMiddlewareLogging(t *testing.T) {
+	log := &captureLogger{}
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, newMockConn(), WithLogger(log))
+
+	h := c.wrap(func(*Client, string, []byte) error { return nil })
+	c.Use(Logging())
+	err := h(c, "/topic", []byte(`{"deviceSecret":"s3cr\"et","sign": "abc","name":"x"}`))
+	require.NoError(t, err)
+	require.Len(t, log.lines, 1)
+	require.True(t, strings.Contains(log.lines[0], `"deviceSecret":"***"`))
+	require.True(t, strings.Contains(log.lines[0], `"sign": "***"`))
+	require.True(t, strings.Contains(log.lines[0], `"name":"x"`))
+}
+
+func TestMiddlewareLoggingPrintf(t *testing.T) {
+	log := &printfLogger{}
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, newMockConn())
+	c.SetLogger(log)
+
+	h := c.wrap(func(*Client, string, []byte) error { return nil })
+	c.Use(Logging())
+	require.NoError(t, h(c, "/topic", []byte(`{}`)))
+	require.Len(t, log.lines, 1)
+	require.True(t, strings.HasPrefix(log.lines[0], "downstream topic=/topic"))
+
+	// 运行时修改日志级别
+	c.StructuredLog().SetLevel(logger.LevelInfo)
+	require.NoError(t, h(c, "/topic", []byte(`{}`)))
+	require.Len(t, log.lines, 1)
+}
@@ -0,0 +1,263 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+// OfflineMessage 离线缓存的上行请求
+type OfflineMessage struct {
+	ProductKey string          `json:"productKey"`
+	DeviceName string          `json:"deviceName"`
+	URI        string          `json:"uri"`
+	Method     string          `json:"method"`
+	Params     json.RawMessage `json:"params"`
+	Timestamp  int64           `json:"timestamp"`       // 入队时间,单位ms
+	QoS        *byte           `json:"qos,omitempty"`   // 请求的QoS, 为nil时使用默认值, 见 WithQoS
+	NoAck      bool            `json:"noAck,omitempty"` // 不需要云端回复, 见 WithAck
+}
+
+// requestOptions 重发时使用的请求选项
+func (sf *OfflineMessage) requestOptions() []RequestOption {
+	var opts []RequestOption
+	if sf.QoS != nil {
+		opts = append(opts, WithQoS(*sf.QoS))
+	}
+	if sf.NoAck {
+		opts = append(opts, WithAck(false))
+	}
+	return opts
+}
+
+// OfflineStore 离线消息存储,必须保证先进先出,实现需协程安全
+// 实现见 offline 包
+type OfflineStore interface {
+	// Push 消息入队
+	Push(msg *OfflineMessage) error
+	// Peek 获取队首消息,队列为空时返回 ErrNotFound
+	Peek() (*OfflineMessage, error)
+	// Pop 移除队首消息
+	Pop() error
+	// Len 队列消息数
+	Len() int
+}
+
+// PropertyHistoryIdentity 历史数据上报的设备标识
+type PropertyHistoryIdentity struct {
+	ProductKey string `json:"productKey"`
+	DeviceName string `json:"deviceName"`
+}
+
+// PropertyHistoryParams 物模型历史数据上报参数域
+type PropertyHistoryParams struct {
+	Identity   PropertyHistoryIdentity `json:"identity"`
+	Properties []json.RawMessage       `json:"properties,omitempty"`
+	Events     []json.RawMessage       `json:"events,omitempty"`
+}
+
+// sendRequestOrStore 设备在线时发送请求,设备不在线或发送失败时存入离线队列,
+// 离线队列不为空或正在重发时也存入离线队列, 以保证与离线消息的先后顺序.
+// 存入离线队列成功返回 ErrOfflineQueued
+func (sf *Client) sendRequestOrStore(ctx context.Context, pk, dn, _uri, method string, params interface{}, opts ...RequestOption) (*Token, error) {
+	if sf.offline == nil {
+		if !sf.IsActive(pk, dn) {
+			return nil, ErrNotActive
+		}
+		return sf.sendRequest(ctx, _uri, method, params, opts...)
+	}
+
+	o := newRequestOptions(opts...)
+	sf.offlineMu.Lock()
+	switch {
+	case sf.offlineReplaying || sf.offline.Len() > 0:
+		err := sf.storeOffline(pk, dn, _uri, method, params, o, ErrOfflineBacklog)
+		sf.offlineMu.Unlock()
+		return nil, err
+	case !sf.IsActive(pk, dn):
+		err := sf.storeOffline(pk, dn, _uri, method, params, o, ErrNotActive)
+		sf.offlineMu.Unlock()
+		return nil, err
+	}
+	sf.offlineMu.Unlock()
+
+	token, err := sf.sendRequest(ctx, _uri, method, params, opts...)
+	if err != nil {
+		sf.offlineMu.Lock()
+		defer sf.offlineMu.Unlock()
+		return nil, sf.storeOffline(pk, dn, _uri, method, params, o, err)
+	}
+	return token, nil
+}
+
+// storeOffline 存入离线队列,存入失败时返回cause, 调用者需持有offlineMu
+func (sf *Client) storeOffline(pk, dn, _uri, method string, params interface{}, o requestOptions, cause error) error {
+	py, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	msg := &OfflineMessage{
+		pk,
+		dn,
+		_uri,
+		method,
+		py,
+		infra.Millisecond(time.Now()),
+		nil,
+		!o.ack,
+	}
+	if o.qos != 1 {
+		msg.QoS = &o.qos
+	}
+	if err = sf.offline.Push(msg); err != nil {
+		sf.StructuredLog().Warn("offline store failed", "method", method, "error", err)
+		return cause
+	}
+	sf.StructuredLog().Debug("offline store", "method", method, "cause", cause)
+	return ErrOfflineQueued
+}
+
+// same 是否为同一离线消息, 存储可能返回消息的副本, 按内容比较
+func (sf *OfflineMessage) same(msg *OfflineMessage) bool {
+	if sf == msg {
+		return true
+	}
+	return sf.ProductKey == msg.ProductKey &&
+		sf.DeviceName == msg.DeviceName &&
+		sf.URI == msg.URI &&
+		sf.Method == msg.Method &&
+		sf.Timestamp == msg.Timestamp &&
+		bytes.Equal(sf.Params, msg.Params) &&
+		(sf.QoS == nil) == (msg.QoS == nil) &&
+		(sf.QoS == nil || *sf.QoS == *msg.QoS) &&
+		sf.NoAck == msg.NoAck
+}
+
+// ReplayOffline 按先进先出顺序重发离线队列中的消息, 使用入队时的请求选项.
+// 遇到消息所属设备不在线或发送失败时停止,保留该消息以保证顺序,
+// 此后的上报均存入离线队列, 直到下次重发.
+// 已在重发时直接返回. 使能 WithOfflineHistory 时,属性上报将改写为物模型历史数据上报
+func (sf *Client) ReplayOffline() error {
+	if sf.offline == nil {
+		return nil
+	}
+	sf.offlineMu.Lock()
+	if sf.offlineReplaying {
+		sf.offlineMu.Unlock()
+		return nil
+	}
+	sf.offlineReplaying = true
+	sf.offlineMu.Unlock()
+	err := sf.replay()
+	sf.offlineMu.Lock()
+	sf.offlineReplaying = false
+	sf.offlineMu.Unlock()
+	return err
+}
+
+// replay 重发离线队列中的消息, 队列为空时在持有offlineMu时结束重发,
+// 保证结束后的上报不会排在离线消息之前
+func (sf *Client) replay() error {
+	for {
+		sf.offlineMu.Lock()
+		if sf.offline.Len() == 0 {
+			sf.offlineReplaying = false
+			sf.offlineMu.Unlock()
+			return nil
+		}
+		msg, err := sf.offline.Peek()
+		sf.offlineMu.Unlock()
+		if err != nil {
+			if err == ErrNotFound {
+				return nil
+			}
+			return err
+		}
+		_uri, method, params := msg.URI, msg.Method, msg.Params
+		pk, dn := msg.ProductKey, msg.DeviceName
+		if sf.hasOfflineHistory && method == infra.MethodEventPropertyPost {
+			params, err = propertyToHistory(msg)
+			if err != nil { // 无法改写,按原样重发
+				sf.StructuredLog().Warn("offline replay rewrite history failed", "error", err)
+				params = msg.Params
+			} else {
+				pk, dn = sf.tetrad.ProductKey, sf.tetrad.DeviceName
+				_uri = sf.URIGateway(uri.SysPrefix, uri.ThingEventPropertyHistoryPost)
+				method = infra.MethodEventPropertyHistoryPost
+			}
+		}
+		if !sf.IsActive(pk, dn) {
+			return ErrNotActive
+		}
+		if _, err = sf.SendRequest(_uri, method, params, msg.requestOptions()...); err != nil {
+			return err
+		}
+		// 发送期间新消息入队可能已淘汰队首的消息, 仅当队首仍为已发送的消息时移除
+		sf.offlineMu.Lock()
+		head, err := sf.offline.Peek()
+		if err == nil && head.same(msg) {
+			err = sf.offline.Pop()
+		} else if err == ErrNotFound {
+			err = nil
+		}
+		sf.offlineMu.Unlock()
+		if err != nil {
+			return err
+		}
+		sf.StructuredLog().Debug("offline replay", "method", method)
+	}
+}
+
+// replayOffline 连接恢复后重发离线消息
+func (sf *Client) replayOffline() {
+	if err := sf.ReplayOffline(); err != nil {
+		sf.StructuredLog().Warn("offline replay stopped", "error", err)
+	}
+}
+
+// propertyToHistory 将属性上报的params改写为历史数据上报的params
+// {"id": value} --> [{"identity":{...},"properties":[{"id":{"value":value,"time":timestamp}}]}]
+// 已经是 {"value":..., "time":...} 格式的属性保持不变
+func propertyToHistory(msg *OfflineMessage) (json.RawMessage, error) {
+	var props map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &props); err != nil {
+		return nil, err
+	}
+	values := make(map[string]json.RawMessage, len(props))
+	for k, v := range props {
+		var tv struct {
+			Value json.RawMessage `json:"value"`
+			Time  *int64          `json:"time"`
+		}
+		if json.Unmarshal(v, &tv) == nil && tv.Value != nil && tv.Time != nil {
+			values[k] = v
+			continue
+		}
+		b, err := json.Marshal(struct {
+			Value json.RawMessage `json:"value"`
+			Time  int64           `json:"time"`
+		}{v, msg.Timestamp})
+		if err != nil {
+			return nil, err
+		}
+		values[k] = b
+	}
+	property, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal([]PropertyHistoryParams{
+		{
+			Identity:   PropertyHistoryIdentity{msg.ProductKey, msg.DeviceName},
+			Properties: []json.RawMessage{property},
+		},
+	})
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package offline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	aiot "github.com/things-go/aliyun-iot"
+)
+
+const fileSuffix = ".msg"
+
+// File 磁盘离线队列,每条消息保存为目录下的一个文件,文件名为递增的序号,
+// 重启后从目录中恢复队列
+type File struct {
+	mu    sync.Mutex
+	dir   string
+	cfg   config
+	seqs  []uint64
+	sizes []int64
+	bytes int64
+	next  uint64
+}
+
+// NewFile 新建磁盘离线队列,dir不存在时将创建
+func NewFile(dir string, opts ...Option) (*File, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sf := &File{dir: dir, cfg: newConfig(opts...), next: 1}
+	type item struct {
+		seq  uint64
+		size int64
+	}
+	items := make([]item, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, fileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		items = append(items, item{seq, info.Size()})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].seq < items[j].seq })
+	for _, v := range items {
+		sf.seqs = append(sf.seqs, v.seq)
+		sf.sizes = append(sf.sizes, v.size)
+		sf.bytes += v.size
+		sf.next = v.seq + 1
+	}
+	return sf, nil
+}
+
+// Push 实现aiot.OfflineStore接口, 单条消息超过最大字节数时直接返回ErrFull
+func (sf *File) Push(msg *aiot.OfflineMessage) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	size := int64(len(b))
+	if size > sf.cfg.maxBytes {
+		return ErrFull
+	}
+
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	for len(sf.seqs) >= sf.cfg.maxCount || sf.bytes+size > sf.cfg.maxBytes {
+		if sf.cfg.policy != PolicyDropOldest || len(sf.seqs) == 0 {
+			return ErrFull
+		}
+		if err = sf.popLocked(); err != nil {
+			return err
+		}
+	}
+
+	seq := sf.next
+	filename := sf.filename(seq)
+	tmp := filename + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp) // nolint: errcheck
+		return err
+	}
+	sf.next++
+	sf.seqs = append(sf.seqs, seq)
+	sf.sizes = append(sf.sizes, size)
+	sf.bytes += size
+	return nil
+}
+
+// Peek 实现aiot.OfflineStore接口, 无法解析的消息文件将被丢弃
+func (sf *File) Peek() (*aiot.OfflineMessage, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	for len(sf.seqs) > 0 {
+		b, err := ioutil.ReadFile(sf.filename(sf.seqs[0]))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		msg := &aiot.OfflineMessage{}
+		if err == nil && json.Unmarshal(b, msg) == nil {
+			return msg, nil
+		}
+		if err = sf.popLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, aiot.ErrNotFound
+}
+
+// Pop 实现aiot.OfflineStore接口
+func (sf *File) Pop() error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if len(sf.seqs) == 0 {
+		return aiot.ErrNotFound
+	}
+	return sf.popLocked()
+}
+
+// Len 实现aiot.OfflineStore接口
+func (sf *File) Len() int {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return len(sf.seqs)
+}
+
+func (sf *File) popLocked() error {
+	err := os.Remove(sf.filename(sf.seqs[0]))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	sf.bytes -= sf.sizes[0]
+	sf.seqs = sf.seqs[1:]
+	sf.sizes = sf.sizes[1:]
+	return nil
+}
+
+func (sf *File) filename(seq uint64) string {
+	return filepath.Join(sf.dir, fmt.Sprintf("%020d%s", seq, fileSuffix))
+}
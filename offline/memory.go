@@ -0,0 +1,78 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package offline
+
+import (
+	"sync"
+
+	aiot "github.com/things-go/aliyun-iot"
+)
+
+// Memory 内存离线队列,进程退出后消息丢失
+type Memory struct {
+	mu    sync.Mutex
+	cfg   config
+	msgs  []*aiot.OfflineMessage
+	bytes int64
+}
+
+// NewMemory 新建内存离线队列
+func NewMemory(opts ...Option) *Memory {
+	return &Memory{cfg: newConfig(opts...)}
+}
+
+// Push 实现aiot.OfflineStore接口, 单条消息超过最大字节数时直接返回ErrFull
+func (sf *Memory) Push(msg *aiot.OfflineMessage) error {
+	size := int64(len(msg.Params))
+	if size > sf.cfg.maxBytes {
+		return ErrFull
+	}
+
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	for len(sf.msgs) >= sf.cfg.maxCount || sf.bytes+size > sf.cfg.maxBytes {
+		if sf.cfg.policy != PolicyDropOldest || len(sf.msgs) == 0 {
+			return ErrFull
+		}
+		sf.popLocked()
+	}
+	sf.msgs = append(sf.msgs, msg)
+	sf.bytes += size
+	return nil
+}
+
+// Peek 实现aiot.OfflineStore接口
+func (sf *Memory) Peek() (*aiot.OfflineMessage, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if len(sf.msgs) == 0 {
+		return nil, aiot.ErrNotFound
+	}
+	return sf.msgs[0], nil
+}
+
+// Pop 实现aiot.OfflineStore接口
+func (sf *Memory) Pop() error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if len(sf.msgs) == 0 {
+		return aiot.ErrNotFound
+	}
+	sf.popLocked()
+	return nil
+}
+
+// Len 实现aiot.OfflineStore接口
+func (sf *Memory) Len() int {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return len(sf.msgs)
+}
+
+func (sf *Memory) popLocked() {
+	sf.bytes -= int64(len(sf.msgs[0].Params))
+	sf.msgs[0] = nil
+	sf.msgs = sf.msgs[1:]
+}
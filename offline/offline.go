@@ -0,0 +1,84 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package offline 实现aiot.OfflineStore离线消息队列,提供内存及磁盘两种实现
+package offline
+
+import (
+	"errors"
+
+	aiot "github.com/things-go/aliyun-iot"
+)
+
+// Policy 队列满时的处理策略
+type Policy byte
+
+// 队列满时的处理策略
+const (
+	// PolicyFIFO 先进先出,队列满时拒绝新消息,返回ErrFull
+	PolicyFIFO Policy = iota
+	// PolicyDropOldest 队列满时丢弃最旧的消息
+	PolicyDropOldest
+)
+
+// 默认值
+const (
+	DefaultMaxCount = 10000
+	DefaultMaxBytes = 16 << 20
+)
+
+// ErrFull 队列已满
+var ErrFull = errors.New("offline queue is full")
+
+// 确保实现 aiot.OfflineStore 接口
+var (
+	_ aiot.OfflineStore = (*Memory)(nil)
+	_ aiot.OfflineStore = (*File)(nil)
+)
+
+type config struct {
+	maxCount int
+	maxBytes int64
+	policy   Policy
+}
+
+// Option 选项
+type Option func(c *config)
+
+// WithMaxCount 设置队列最大消息数,默认 DefaultMaxCount
+func WithMaxCount(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.maxCount = n
+		}
+	}
+}
+
+// WithMaxBytes 设置队列最大字节数,默认 DefaultMaxBytes
+func WithMaxBytes(n int64) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.maxBytes = n
+		}
+	}
+}
+
+// WithPolicy 设置队列满时的处理策略,默认 PolicyFIFO
+func WithPolicy(p Policy) Option {
+	return func(c *config) {
+		c.policy = p
+	}
+}
+
+func newConfig(opts ...Option) config {
+	c := config{
+		DefaultMaxCount,
+		DefaultMaxBytes,
+		PolicyFIFO,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
@@ -0,0 +1,106 @@
+package offline
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	aiot "github.com/things-go/aliyun-iot"
+)
+
+func newMessage(v int) *aiot.OfflineMessage {
+	return &aiot.OfflineMessage{
+		ProductKey: "pk",
+		DeviceName: "dn",
+		Method:     "thing.event.property.post",
+		Params:     json.RawMessage(`{"v":` + strconv.Itoa(v) + `}`),
+	}
+}
+
+func testStore(t *testing.T, newStore func(opts ...Option) aiot.OfflineStore) {
+	t.Run("fifo", func(t *testing.T) {
+		s := newStore(WithMaxCount(2))
+		require.NoError(t, s.Push(newMessage(1)))
+		require.NoError(t, s.Push(newMessage(2)))
+		require.Equal(t, ErrFull, s.Push(newMessage(3)))
+		require.Equal(t, 2, s.Len())
+
+		msg, err := s.Peek()
+		require.NoError(t, err)
+		require.Equal(t, newMessage(1).Params, msg.Params)
+		require.NoError(t, s.Pop())
+		msg, err = s.Peek()
+		require.NoError(t, err)
+		require.Equal(t, newMessage(2).Params, msg.Params)
+		require.NoError(t, s.Pop())
+
+		_, err = s.Peek()
+		require.Equal(t, aiot.ErrNotFound, err)
+		require.Equal(t, aiot.ErrNotFound, s.Pop())
+	})
+	t.Run("drop oldest", func(t *testing.T) {
+		s := newStore(WithMaxCount(2), WithPolicy(PolicyDropOldest))
+		require.NoError(t, s.Push(newMessage(1)))
+		require.NoError(t, s.Push(newMessage(2)))
+		require.NoError(t, s.Push(newMessage(3)))
+		require.Equal(t, 2, s.Len())
+		msg, err := s.Peek()
+		require.NoError(t, err)
+		require.Equal(t, newMessage(2).Params, msg.Params)
+	})
+	t.Run("too large", func(t *testing.T) {
+		s := newStore(WithMaxBytes(256), WithPolicy(PolicyDropOldest))
+		require.NoError(t, s.Push(newMessage(1)))
+		require.NoError(t, s.Push(newMessage(2)))
+		msg := newMessage(3)
+		msg.Params = json.RawMessage(`"` + strings.Repeat("a", 256) + `"`)
+		require.Equal(t, ErrFull, s.Push(msg))
+		// 不淘汰已有的消息
+		require.Equal(t, 2, s.Len())
+	})
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, func(opts ...Option) aiot.OfflineStore {
+		return NewMemory(opts...)
+	})
+}
+
+func TestFile(t *testing.T) {
+	testStore(t, func(opts ...Option) aiot.OfflineStore {
+		dir, err := ioutil.TempDir("", "offline")
+		require.NoError(t, err)
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		s, err := NewFile(dir, opts...)
+		require.NoError(t, err)
+		return s
+	})
+
+	t.Run("reopen", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "offline")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		s, err := NewFile(dir)
+		require.NoError(t, err)
+		require.NoError(t, s.Push(newMessage(1)))
+		require.NoError(t, s.Push(newMessage(2)))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "garbage.txt"), []byte("x"), 0644))
+
+		s, err = NewFile(dir)
+		require.NoError(t, err)
+		require.Equal(t, 2, s.Len())
+		msg, err := s.Peek()
+		require.NoError(t, err)
+		require.Equal(t, newMessage(1).Params, msg.Params)
+		require.NoError(t, s.Pop())
+		require.NoError(t, s.Push(newMessage(3)))
+		require.Equal(t, 2, s.Len())
+	})
+}
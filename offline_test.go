@@ -0,0 +1,174 @@
+package aiot
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+type sliceStore struct {
+	msgs []*OfflineMessage
+}
+
+func (sf *sliceStore) Push(msg *OfflineMessage) error {
+	sf.msgs = append(sf.msgs, msg)
+	return nil
+}
+
+func (sf *sliceStore) Peek() (*OfflineMessage, error) {
+	if len(sf.msgs) == 0 {
+		return nil, ErrNotFound
+	}
+	return sf.msgs[0], nil
+}
+
+func (sf *sliceStore) Pop() error {
+	sf.msgs = sf.msgs[1:]
+	return nil
+}
+
+func (sf *sliceStore) Len() int { return len(sf.msgs) }
+
+// dropOldestStore 队列满时丢弃最旧消息的存储, Peek返回消息的副本
+type dropOldestStore struct {
+	sliceStore
+	max int
+}
+
+func (sf *dropOldestStore) Push(msg *OfflineMessage) error {
+	if len(sf.msgs) >= sf.max {
+		sf.msgs = sf.msgs[1:]
+	}
+	return sf.sliceStore.Push(msg)
+}
+
+func (sf *dropOldestStore) Peek() (*OfflineMessage, error) {
+	msg, err := sf.sliceStore.Peek()
+	if err != nil {
+		return nil, err
+	}
+	v := *msg
+	return &v, nil
+}
+
+// hookConn 发布前调用before
+type hookConn struct {
+	*mockConn
+	before func()
+}
+
+func (sf *hookConn) Publish(topic string, qos byte, payload interface{}) error {
+	if sf.before != nil {
+		sf.before()
+	}
+	return sf.mockConn.Publish(topic, qos, payload)
+}
+
+func TestClientOffline(t *testing.T) {
+	conn := newMockConn()
+	store := &sliceStore{}
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn,
+		WithOfflineStore(store), WithOfflineHistory())
+
+	conn.setOffline(true)
+	_, err := c.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temp": 1})
+	require.Equal(t, ErrOfflineQueued, err)
+	_, err = c.ThingEventPost("pk", "dn", "alarm", map[string]interface{}{"high": 1})
+	require.Equal(t, ErrOfflineQueued, err)
+	require.Equal(t, 2, store.Len())
+	timestamp := store.msgs[0].Timestamp
+
+	require.Error(t, c.ReplayOffline())
+	require.Equal(t, 2, store.Len())
+
+	conn.setOffline(false)
+	require.NoError(t, c.ReplayOffline())
+	require.Equal(t, 0, store.Len())
+
+	msgs := conn.messages()
+	require.Len(t, msgs, 2)
+	require.Equal(t, uri.URI(uri.SysPrefix, uri.ThingEventPropertyHistoryPost, "pk", "dn"), msgs[0].topic)
+	require.Equal(t, uri.URI(uri.SysPrefix, uri.ThingEventPost, "pk", "dn", "alarm"), msgs[1].topic)
+
+	req := struct {
+		Method string                  `json:"method"`
+		Params []PropertyHistoryParams `json:"params"`
+	}{}
+	require.NoError(t, json.Unmarshal(msgs[0].payload, &req))
+	require.Equal(t, infra.MethodEventPropertyHistoryPost, req.Method)
+	require.Len(t, req.Params, 1)
+	require.Equal(t, PropertyHistoryIdentity{"pk", "dn"}, req.Params[0].Identity)
+	require.JSONEq(t,
+		`{"temp":{"value":1,"time":`+strconv.FormatInt(timestamp, 10)+`}}`,
+		string(req.Params[0].Properties[0]))
+}
+
+func TestClientOfflineOrder(t *testing.T) {
+	conn := newMockConn()
+	store := &sliceStore{}
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn, WithOfflineStore(store))
+
+	conn.setOffline(true)
+	_, err := c.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temp": 1}, WithQoS(0), WithAck(false))
+	require.Equal(t, ErrOfflineQueued, err)
+	require.NotNil(t, store.msgs[0].QoS)
+	require.Equal(t, byte(0), *store.msgs[0].QoS)
+	require.True(t, store.msgs[0].NoAck)
+
+	// 连接恢复但未重发时, 后续上报排在离线消息之后
+	conn.setOffline(false)
+	_, err = c.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temp": 2})
+	require.Equal(t, ErrOfflineQueued, err)
+	require.Equal(t, 2, store.Len())
+	require.Nil(t, store.msgs[1].QoS)
+	require.False(t, store.msgs[1].NoAck)
+	require.Empty(t, conn.messages())
+
+	require.NoError(t, c.ReplayOffline())
+	require.Equal(t, 0, store.Len())
+	msgs := conn.messages()
+	require.Len(t, msgs, 2)
+	// 重发时使用入队时的请求选项
+	require.Equal(t, byte(0), msgs[0].qos)
+	require.Contains(t, string(msgs[0].payload), `"sys":{"ack":0}`)
+	require.Contains(t, string(msgs[0].payload), `"temp":1`)
+	require.Equal(t, byte(1), msgs[1].qos)
+	require.Contains(t, string(msgs[1].payload), `"temp":2`)
+
+	// 队列为空时直接发送
+	_, err = c.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temp": 3})
+	require.NoError(t, err)
+	require.Len(t, conn.messages(), 3)
+}
+
+func TestClientOfflineReplayEvict(t *testing.T) {
+	conn := &hookConn{mockConn: newMockConn()}
+	store := &dropOldestStore{max: 2}
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn, WithOfflineStore(store))
+
+	conn.setOffline(true)
+	for i := 1; i <= 2; i++ {
+		_, err := c.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temp": i})
+		require.Equal(t, ErrOfflineQueued, err)
+	}
+	conn.setOffline(false)
+
+	// 重发第一条消息期间入队的消息淘汰了正在发送的队首, 不得误删未发送的消息
+	conn.before = func() {
+		conn.before = nil
+		_, err := c.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temp": 3})
+		require.Equal(t, ErrOfflineQueued, err)
+	}
+	require.NoError(t, c.ReplayOffline())
+	require.Equal(t, 0, store.Len())
+	msgs := conn.messages()
+	require.Len(t, msgs, 3)
+	for i, msg := range msgs {
+		require.Contains(t, string(msg.payload), `"temp":`+strconv.Itoa(i+1))
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/tsl"
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+// PropertySetter 属性设置函数, value为平台下发的属性值
+// 返回设备实际应用的属性值, 为nil时使用value, 用于设置后重新上报, 见 WithPropertySetRepost
+type PropertySetter func(c *Client, pk, dn string, value json.RawMessage) (interface{}, error)
+
+// PropertySetError 属性设置失败的属性
+type PropertySetError struct {
+	Errors map[string]error // 属性标识符 -> 设置失败的错误
+}
+
+// Identifiers 设置失败的属性标识符,有序
+func (sf *PropertySetError) Identifiers() []string {
+	ids := make([]string, 0, len(sf.Errors))
+	for id := range sf.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Error implement error
+func (sf *PropertySetError) Error() string {
+	ids := sf.Identifiers()
+	s := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s = append(s, fmt.Sprintf("%s: %v", id, sf.Errors[id]))
+	}
+	return "property set failed, " + strings.Join(s, "; ")
+}
+
+// HandlePropertySet 注册属性的设置函数, f为nil时取消注册.
+// 注册了设置函数后, 属性设置请求将按属性标识符分发到设置函数并自动回复:
+// 全部成功时回复成功, 否则回复 infra.CodeRequestError, message中列出失败的属性及原因.
+// 未注册设置函数的属性视为设置失败. 设置了物模型时设置前校验属性值, 见 SetThingModel.
+// 优先于 HandleService 注册的处理函数及 Callback.ThingServicePropertySet
+func (sf *Client) HandlePropertySet(identifier string, f PropertySetter) {
+	sf.router.mu.Lock()
+	defer sf.router.mu.Unlock()
+	if f == nil {
+		delete(sf.router.setters, identifier)
+	} else {
+		sf.router.setters[identifier] = f
+	}
+}
+
+func (sf *Client) hasPropertySetter() bool {
+	sf.router.mu.RLock()
+	defer sf.router.mu.RUnlock()
+	return len(sf.router.setters) > 0
+}
+
+func (sf *Client) propertySetter(identifier string) PropertySetter {
+	sf.router.mu.RLock()
+	defer sf.router.mu.RUnlock()
+	return sf.router.setters[identifier]
+}
+
+// servePropertySet 分发属性设置请求到各属性的设置函数, 回复并按需重新上报设置成功的属性
+func (sf *Client) servePropertySet(ctx context.Context, pk, dn string, payload []byte) error {
+	req := struct {
+		ID     uint                       `json:"id,string"`
+		Params map[string]json.RawMessage `json:"params"`
+	}{}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(req.Params))
+	for id := range req.Params {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	applied := make(map[string]interface{}, len(ids))
+	failed := make(map[string]error)
+	for _, id := range ids {
+		v, err := sf.setProperty(pk, dn, id, req.Params[id])
+		if err != nil {
+			failed[id] = err
+			continue
+		}
+		applied[id] = v
+	}
+
+	rsp := Response{ID: req.ID, Code: infra.CodeSuccess, Data: "{}"}
+	if len(failed) > 0 {
+		err := &PropertySetError{failed}
+		rsp.Code, rsp.Message = infra.CodeRequestError, err.Error()
+		sf.StructuredLog().Warn("property set failed", "productKey", pk, "deviceName", dn,
+			"requestID", req.ID, "identifiers", err.Identifiers(), "error", err)
+	}
+	_uri := uri.URI(uri.SysPrefix, uri.ThingServicePropertySetReply, pk, dn)
+	if err := sf.Response(_uri, rsp); err != nil {
+		return err
+	}
+
+	if sf.propertySetRepost && len(applied) > 0 {
+		if _, err := sf.thingEventPropertyPost(ctx, pk, dn, applied); err != nil && err != ErrOfflineQueued {
+			sf.StructuredLog().Warn("property set repost failed", "productKey", pk, "deviceName", dn, "error", err)
+		}
+	}
+	return nil
+}
+
+// setProperty 校验并调用属性的设置函数, 返回设备实际应用的属性值
+func (sf *Client) setProperty(pk, dn, identifier string, value json.RawMessage) (v interface{}, err error) {
+	f := sf.propertySetter(identifier)
+	if f == nil {
+		return nil, ErrNotSupportFeature
+	}
+	if thing, ok := sf.identifierModel(pk, identifier); ok {
+		_, id := tsl.SplitIdentifier(identifier)
+		if p, ok := thing.Property(id); ok && !p.Writable() {
+			return nil, &tsl.ValidationError{Identifier: identifier, Reason: "property is read only"}
+		}
+		if err = thing.ValidateProperties(map[string]json.RawMessage{identifier: value}); err != nil {
+			return nil, err
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if v, err = f(sf, pk, dn, value); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		v = value
+	}
+	return v, nil
+}
@@ -0,0 +1,89 @@
+package aiot
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/tsl"
+)
+
+func TestHandlePropertySet(t *testing.T) {
+	thing, err := tsl.LoadFile("tsl/testdata/thing.json")
+	require.NoError(t, err)
+	thing.Profile.ProductKey = ""
+
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn, WithPropertySetRepost())
+
+	values := make(map[string]string)
+	setter := func(c *Client, pk, dn string, value json.RawMessage) (interface{}, error) {
+		if string(value) == `"busy"` {
+			return nil, errors.New("device busy")
+		}
+		return nil, nil
+	}
+	c.HandlePropertySet("switch", func(c *Client, pk, dn string, value json.RawMessage) (interface{}, error) {
+		values["switch"] = string(value)
+		return 1, nil // 设备实际应用的值
+	})
+	c.HandlePropertySet("label", setter)
+	c.HandlePropertySet("temperature", setter)
+
+	// 全部成功, 回复后重新上报
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/property/set",
+		[]byte(`{"id":"20","version":"1.0","params":{"switch":0,"label":"a"},"method":"thing.service.property.set"}`)))
+	msgs := conn.messages()
+	require.Len(t, msgs, 2)
+	require.Equal(t, "/sys/pk/dn/thing/service/property/set_reply", msgs[0].topic)
+	rsp := ResponseRawData{}
+	require.NoError(t, json.Unmarshal(msgs[0].payload, &rsp))
+	require.Equal(t, uint(20), rsp.ID)
+	require.Equal(t, infra.CodeSuccess, rsp.Code)
+	require.Equal(t, "0", values["switch"])
+	require.Equal(t, "/sys/pk/dn/thing/event/property/post", msgs[1].topic)
+	req := struct {
+		Params map[string]json.RawMessage `json:"params"`
+	}{}
+	require.NoError(t, json.Unmarshal(msgs[1].payload, &req))
+	require.Equal(t, map[string]json.RawMessage{"switch": json.RawMessage("1"), "label": json.RawMessage(`"a"`)}, req.Params)
+
+	// 部分失败, 回复中列出失败的属性, 仅重新上报成功的属性
+	c.SetThingModel("pk", thing)
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/property/set",
+		[]byte(`{"id":"21","params":{"switch":1,"label":"busy","mode":1,"temperature":20},"method":"thing.service.property.set"}`)))
+	msgs = conn.messages()
+	require.Len(t, msgs, 4)
+	require.NoError(t, json.Unmarshal(msgs[2].payload, &rsp))
+	require.Equal(t, uint(21), rsp.ID)
+	require.Equal(t, infra.CodeRequestError, rsp.Code)
+	require.Contains(t, rsp.Message, "label: device busy")
+	require.Contains(t, rsp.Message, "mode: not support feature")
+	require.Contains(t, rsp.Message, "temperature: tsl: temperature: property is read only")
+	require.NotContains(t, rsp.Message, "switch")
+	req.Params = nil
+	require.NoError(t, json.Unmarshal(msgs[3].payload, &req))
+	require.Equal(t, map[string]json.RawMessage{"switch": json.RawMessage("1")}, req.Params)
+
+	// 属性值不符合物模型
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/property/set",
+		[]byte(`{"id":"22","params":{"switch":5},"method":"thing.service.property.set"}`)))
+	msgs = conn.messages()
+	require.Len(t, msgs, 5)
+	require.NoError(t, json.Unmarshal(msgs[4].payload, &rsp))
+	require.Equal(t, infra.CodeRequestError, rsp.Code)
+	require.Equal(t, "1", values["switch"])
+
+	// 取消所有设置函数后交由 Callback 处理
+	c.HandlePropertySet("switch", nil)
+	c.HandlePropertySet("label", nil)
+	c.HandlePropertySet("temperature", nil)
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/property/set",
+		[]byte(`{"id":"23","params":{"switch":1},"method":"thing.service.property.set"}`)))
+	msgs = conn.messages()
+	require.NoError(t, json.Unmarshal(msgs[len(msgs)-1].payload, &rsp))
+	require.Equal(t, "thing.service.property.set not supported", rsp.Message)
+}
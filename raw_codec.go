@@ -0,0 +1,127 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+// RawCodec 透传模式下Alink请求,应答与设备二进制帧的编解码, 实现需协程安全
+// 使能 WithEnableModelRaw 并设置 WithRawCodec 后:
+//   - 属性上报,事件上报等上行请求(thing.event.*)编码后通过 up_raw 发送
+//   - up_raw_reply 解码后按Alink应答处理, 即 Token, HandleReply 及 Callback 可正常使用
+//   - down_raw 解码后按Alink下行请求处理(属性设置,服务调用), 其回复编码后通过 down_raw_reply 发送
+//
+// 实现见 rawcodec 包
+type RawCodec interface {
+	// EncodeRequest 将上行请求编码为 up_raw 的二进制帧
+	EncodeRequest(req *Request) ([]byte, error)
+	// DecodeResponse 将 up_raw_reply 的二进制帧解码为上行请求的应答, method为应答对应请求的Alink方法
+	DecodeResponse(frame []byte) (method string, rsp *ResponseRawData, err error)
+	// DecodeRequest 将 down_raw 的二进制帧解码为下行请求, Params为 json.RawMessage
+	DecodeRequest(frame []byte) (*Request, error)
+	// EncodeResponse 将下行请求的回复编码为 down_raw_reply 的二进制帧, method为请求的Alink方法
+	EncodeResponse(method string, rsp *Response) ([]byte, error)
+}
+
+// rawCodec 获取产品的二进制帧编解码, 未使能透传或未设置时返回nil
+func (sf *Client) rawCodec(pk string) RawCodec {
+	if !sf.hasRawModel {
+		return nil
+	}
+	if codec, ok := sf.rawCodecs[pk]; ok {
+		return codec
+	}
+	return sf.rawCodecs[""]
+}
+
+// rawCodecURI 获取 /sys/{productKey}/{deviceName}/thing/... 主题所属产品的二进制帧编解码
+func (sf *Client) rawCodecURI(_uri string) (codec RawCodec, pk, dn string) {
+	uris := uri.Spilt(_uri)
+	if len(uris) < 4 || uris[0] != "sys" || uris[3] != "thing" {
+		return nil, "", ""
+	}
+	pk, dn = uris[1], uris[2]
+	return sf.rawCodec(pk), pk, dn
+}
+
+// requestRaw 上行请求编码后通过 up_raw 发送, 返回false表示请求不使用透传
+func (sf *Client) requestRaw(_uri string, req *Request, qos byte) (bool, error) {
+	if !strings.HasPrefix(req.Method, "thing.event.") {
+		return false, nil
+	}
+	codec, pk, dn := sf.rawCodecURI(_uri)
+	if codec == nil {
+		return false, nil
+	}
+	frame, err := codec.EncodeRequest(req)
+	if err != nil {
+		return true, err
+	}
+	return true, sf.Publish(uri.URI(uri.SysPrefix, uri.ThingModelUpRaw, pk, dn), qos, frame)
+}
+
+// responseRaw 服务调用的回复编码后通过 down_raw_reply 发送, 返回false表示回复不使用透传
+func (sf *Client) responseRaw(_uri string, rsp *Response) (bool, error) {
+	codec, pk, dn := sf.rawCodecURI(_uri)
+	if codec == nil {
+		return false, nil
+	}
+	// /sys/{pk}/{dn}/thing/service/{tsl.service.identifier}_reply --> thing.service.{tsl.service.identifier}
+	uris := uri.Spilt(_uri)
+	if len(uris) < 6 || uris[4] != "service" || !strings.HasSuffix(_uri, "_"+uri.ReplySuffix) {
+		return false, nil
+	}
+	method := strings.TrimSuffix(strings.Join(uris[3:], "."), "_"+uri.ReplySuffix)
+	frame, err := codec.EncodeResponse(method, rsp)
+	if err != nil {
+		return true, err
+	}
+	return true, sf.Publish(uri.URI(uri.SysPrefix, uri.ThingModelDownRawReply, pk, dn), 1, frame)
+}
+
+// procRawReply 解码 up_raw_reply 并按Alink应答处理
+func (sf *Client) procRawReply(codec RawCodec, pk, dn string, frame []byte) error {
+	method, rsp, err := codec.DecodeResponse(frame)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(rsp)
+	if err != nil {
+		return err
+	}
+	// thing.event.property.post --> /sys/{pk}/{dn}/thing/event/property/post_reply
+	_uri := uri.ReplyWithRequestURI(uri.URI(uri.SysPrefix, strings.ReplaceAll(method, ".", uri.Sep), pk, dn))
+	switch {
+	case method == infra.MethodEventPropertyHistoryPost:
+		return ProcThingEventPropertyHistoryPostReply(sf, _uri, payload)
+	case strings.HasPrefix(method, "thing.event.") && strings.HasSuffix(method, ".post"):
+		return ProcThingEventPostReply(sf, _uri, payload)
+	}
+	return ProcReplyRawData(sf, _uri, payload)
+}
+
+// procRawRequest 解码 down_raw 并按Alink下行请求处理
+func (sf *Client) procRawRequest(ctx context.Context, codec RawCodec, pk, dn string, frame []byte) error {
+	req, err := codec.DecodeRequest(frame)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(req.Method, "thing.service.") {
+		return ErrNotSupportFeature
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	// thing.service.property.set --> /sys/{pk}/{dn}/thing/service/property/set
+	_uri := uri.URI(uri.SysPrefix, strings.ReplaceAll(req.Method, ".", uri.Sep), pk, dn)
+	return ProcThingServiceRequestContext(ctx, sf, _uri, payload)
+}
@@ -0,0 +1,98 @@
+package aiot
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+// jsonRawFrame 测试用的帧, 以json承载Alink请求及应答
+type jsonRawFrame struct {
+	ID     uint            `json:"id"`
+	Method string          `json:"method"`
+	Code   int             `json:"code,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+type jsonRawCodec struct{}
+
+func (jsonRawCodec) EncodeRequest(req *Request) ([]byte, error) {
+	params, err := json.Marshal(req.Params)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonRawFrame{ID: req.ID, Method: req.Method, Data: params})
+}
+
+func (jsonRawCodec) DecodeResponse(frame []byte) (string, *ResponseRawData, error) {
+	f := jsonRawFrame{}
+	if err := json.Unmarshal(frame, &f); err != nil {
+		return "", nil, err
+	}
+	return f.Method, &ResponseRawData{ID: f.ID, Code: f.Code, Data: f.Data}, nil
+}
+
+func (jsonRawCodec) DecodeRequest(frame []byte) (*Request, error) {
+	f := jsonRawFrame{}
+	if err := json.Unmarshal(frame, &f); err != nil {
+		return nil, err
+	}
+	return &Request{ID: f.ID, Version: DefaultVersion, Params: f.Data, Method: f.Method}, nil
+}
+
+func (jsonRawCodec) EncodeResponse(method string, rsp *Response) ([]byte, error) {
+	return json.Marshal(jsonRawFrame{ID: rsp.ID, Method: method, Code: rsp.Code})
+}
+
+func TestRawCodec(t *testing.T) {
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn,
+		WithEnableModelRaw(), WithRawCodec("", jsonRawCodec{}), WithPropertySetRepost())
+
+	// 属性上报编码后通过 up_raw 发送, up_raw_reply 解码后完成 Token
+	token, err := c.ThingEventPropertyPost("pk", "dn", map[string]int{"switch": 1})
+	require.NoError(t, err)
+	msgs := conn.messages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, "/sys/pk/dn/thing/model/up_raw", msgs[0].topic)
+	f := jsonRawFrame{}
+	require.NoError(t, json.Unmarshal(msgs[0].payload, &f))
+	require.Equal(t, infra.MethodEventPropertyPost, f.Method)
+	require.JSONEq(t, `{"switch":1}`, string(f.Data))
+
+	reply, err := json.Marshal(jsonRawFrame{ID: f.ID, Method: f.Method, Code: infra.CodeSuccess, Data: json.RawMessage("{}")})
+	require.NoError(t, err)
+	require.NoError(t, ProcThingModelUpRawReply(c, "/sys/pk/dn/thing/model/up_raw_reply", reply))
+	m, err := token.Wait(time.Second)
+	require.NoError(t, err)
+	require.NoError(t, m.Err())
+	require.Equal(t, f.ID, m.ID)
+
+	// down_raw 解码后分发到属性设置函数, 回复编码后通过 down_raw_reply 发送
+	var got json.RawMessage
+	c.HandlePropertySet("switch", func(c *Client, pk, dn string, value json.RawMessage) (interface{}, error) {
+		got = value
+		return nil, nil
+	})
+	set, err := json.Marshal(jsonRawFrame{ID: 30, Method: infra.MethodServicePropertySet, Data: json.RawMessage(`{"switch":0}`)})
+	require.NoError(t, err)
+	require.NoError(t, ProcThingModelDownRaw(c, "/sys/pk/dn/thing/model/down_raw", set))
+	require.Equal(t, "0", string(got))
+	msgs = conn.messages()
+	require.Len(t, msgs, 3)
+	require.Equal(t, "/sys/pk/dn/thing/model/down_raw_reply", msgs[1].topic)
+	f = jsonRawFrame{}
+	require.NoError(t, json.Unmarshal(msgs[1].payload, &f))
+	require.Equal(t, jsonRawFrame{ID: 30, Method: infra.MethodServicePropertySet, Code: infra.CodeSuccess}, f)
+	require.Equal(t, "/sys/pk/dn/thing/model/up_raw", msgs[2].topic)
+
+	// 未设置编解码的产品仍不支持Alink上报
+	c = New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, newMockConn(),
+		WithEnableModelRaw(), WithRawCodec("other", jsonRawCodec{}))
+	_, err = c.ThingEventPropertyPost("pk", "dn", map[string]int{"switch": 1})
+	require.Equal(t, ErrNotSupportFeature, err)
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package rawcodec 实现aiot.RawCodec透传二进制帧编解码,
+// 提供Alink标准二进制帧及按声明的字段布局编码数据域
+// @see https://help.aliyun.com/document_detail/68703.html
+package rawcodec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	aiot "github.com/things-go/aliyun-iot"
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+// 阿里云透传示例脚本的命令字
+const (
+	CommandReport      byte = 0x00 // 属性上报
+	CommandSet         byte = 0x01 // 属性设置
+	CommandReportReply byte = 0x02 // 属性上报的应答
+	CommandSetReply    byte = 0x03 // 属性设置的应答
+)
+
+// 帧头长度
+const (
+	requestHeaderSize  = 5 // 命令字(1) + 请求ID(4)
+	responseHeaderSize = 7 // 命令字(1) + 请求ID(4) + code(2)
+)
+
+// 错误定义
+var (
+	ErrInvalidFrame   = errors.New("rawcodec: invalid frame")
+	ErrUnknownCommand = errors.New("rawcodec: unknown command")
+	ErrUnknownMethod  = errors.New("rawcodec: unknown method")
+)
+
+// 确保实现 aiot.RawCodec 接口
+var _ aiot.RawCodec = (*Frame)(nil)
+
+// Command Alink方法与请求帧,应答帧命令字的对应关系
+type Command struct {
+	Method  string // Alink方法, 如 infra.MethodEventPropertyPost
+	Request byte   // 请求帧的命令字
+	Reply   byte   // 应答帧的命令字
+}
+
+// DefaultCommands 阿里云透传示例脚本的命令字: 属性上报及属性设置
+func DefaultCommands() []Command {
+	return []Command{
+		{infra.MethodEventPropertyPost, CommandReport, CommandReportReply},
+		{infra.MethodServicePropertySet, CommandSet, CommandSetReply},
+	}
+}
+
+// Body 帧数据域的编解码
+// key为请求的Alink方法时编解码请求的params域, 为 {method}_reply 时编解码应答的data域
+type Body interface {
+	Encode(key string, v json.RawMessage) ([]byte, error)
+	Decode(key string, b []byte) (json.RawMessage, error)
+}
+
+// JSON 数据域为json文本
+type JSON struct{}
+
+// Encode implement Body
+func (JSON) Encode(_ string, v json.RawMessage) ([]byte, error) { return v, nil }
+
+// Decode implement Body
+func (JSON) Decode(_ string, b []byte) (json.RawMessage, error) {
+	if len(b) == 0 {
+		return json.RawMessage("{}"), nil
+	}
+	if !json.Valid(b) {
+		return nil, ErrInvalidFrame
+	}
+	return append(json.RawMessage{}, b...), nil
+}
+
+// Option 选项
+type Option func(*Frame)
+
+// WithBody 设置数据域的编解码, 默认 JSON
+func WithBody(b Body) Option {
+	return func(f *Frame) {
+		f.body = b
+	}
+}
+
+// WithCommand 增加或替换Alink方法的命令字, 如事件上报 thing.event.{tsl.event.identifier}.post,
+// 服务调用 thing.service.{tsl.service.identifier}
+func WithCommand(method string, request, reply byte) Option {
+	return func(f *Frame) {
+		for i := range f.commands {
+			if f.commands[i].Method == method {
+				f.commands[i] = Command{method, request, reply}
+				return
+			}
+		}
+		f.commands = append(f.commands, Command{method, request, reply})
+	}
+}
+
+// Frame Alink标准二进制帧, 多字节整数均为大端
+// 请求帧: 命令字(1字节) | 请求ID(4字节) | params
+// 应答帧: 命令字(1字节) | 请求ID(4字节) | code(2字节) | data
+type Frame struct {
+	commands []Command
+	body     Body
+}
+
+// NewFrame 新建Alink标准二进制帧编解码, 默认包含 DefaultCommands 的命令字
+func NewFrame(opts ...Option) *Frame {
+	f := &Frame{
+		commands: DefaultCommands(),
+		body:     JSON{},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+func (sf *Frame) requestCommand(method string) (byte, byte, error) {
+	for _, c := range sf.commands {
+		if c.Method == method {
+			return c.Request, c.Reply, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+}
+
+func (sf *Frame) method(cmd byte, reply bool) (string, error) {
+	for _, c := range sf.commands {
+		if (!reply && c.Request == cmd) || (reply && c.Reply == cmd) {
+			return c.Method, nil
+		}
+	}
+	return "", fmt.Errorf("%w: 0x%02x", ErrUnknownCommand, cmd)
+}
+
+// EncodeRequest implement aiot.RawCodec
+func (sf *Frame) EncodeRequest(req *aiot.Request) ([]byte, error) {
+	cmd, _, err := sf.requestCommand(req.Method)
+	if err != nil {
+		return nil, err
+	}
+	params, err := toRawMessage(req.Params)
+	if err != nil {
+		return nil, err
+	}
+	body, err := sf.body.Encode(req.Method, params)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, requestHeaderSize, requestHeaderSize+len(body))
+	b[0] = cmd
+	binary.BigEndian.PutUint32(b[1:], uint32(req.ID))
+	return append(b, body...), nil
+}
+
+// DecodeRequest implement aiot.RawCodec
+func (sf *Frame) DecodeRequest(frame []byte) (*aiot.Request, error) {
+	if len(frame) < requestHeaderSize {
+		return nil, ErrInvalidFrame
+	}
+	method, err := sf.method(frame[0], false)
+	if err != nil {
+		return nil, err
+	}
+	params, err := sf.body.Decode(method, frame[requestHeaderSize:])
+	if err != nil {
+		return nil, err
+	}
+	return &aiot.Request{
+		ID:      uint(binary.BigEndian.Uint32(frame[1:])),
+		Version: aiot.DefaultVersion,
+		Params:  params,
+		Method:  method,
+	}, nil
+}
+
+// EncodeResponse implement aiot.RawCodec
+func (sf *Frame) EncodeResponse(method string, rsp *aiot.Response) ([]byte, error) {
+	_, cmd, err := sf.requestCommand(method)
+	if err != nil {
+		return nil, err
+	}
+	data, err := toRawMessage(rsp.Data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := sf.body.Encode(method+"_reply", data)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, responseHeaderSize, responseHeaderSize+len(body))
+	b[0] = cmd
+	binary.BigEndian.PutUint32(b[1:], uint32(rsp.ID))
+	binary.BigEndian.PutUint16(b[5:], uint16(rsp.Code))
+	return append(b, body...), nil
+}
+
+// DecodeResponse implement aiot.RawCodec
+func (sf *Frame) DecodeResponse(frame []byte) (string, *aiot.ResponseRawData, error) {
+	if len(frame) < responseHeaderSize {
+		return "", nil, ErrInvalidFrame
+	}
+	method, err := sf.method(frame[0], true)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := sf.body.Decode(method+"_reply", frame[responseHeaderSize:])
+	if err != nil {
+		return "", nil, err
+	}
+	return method, &aiot.ResponseRawData{
+		ID:   uint(binary.BigEndian.Uint32(frame[1:])),
+		Code: int(binary.BigEndian.Uint16(frame[5:])),
+		Data: data,
+	}, nil
+}
+
+// toRawMessage 转换为json, 字符串视为json文本, 如回复中常用的 "{}"
+func toRawMessage(v interface{}) (json.RawMessage, error) {
+	switch vv := v.(type) {
+	case nil:
+		return nil, nil
+	case json.RawMessage:
+		return vv, nil
+	case []byte:
+		return vv, nil
+	case string:
+		if json.Valid([]byte(vv)) {
+			return json.RawMessage(vv), nil
+		}
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,50 @@
+package rawcodec
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	aiot "github.com/things-go/aliyun-iot"
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+func TestFrame(t *testing.T) {
+	f := NewFrame()
+
+	b, err := f.EncodeRequest(&aiot.Request{ID: 0x0102, Params: map[string]int{"switch": 1}, Method: infra.MethodEventPropertyPost})
+	require.NoError(t, err)
+	require.Equal(t, append([]byte{CommandReport, 0, 0, 1, 2}, `{"switch":1}`...), b)
+
+	method, rsp, err := f.DecodeResponse(append([]byte{CommandReportReply, 0, 0, 1, 2, 0, 200}, "{}"...))
+	require.NoError(t, err)
+	require.Equal(t, infra.MethodEventPropertyPost, method)
+	require.Equal(t, &aiot.ResponseRawData{ID: 0x0102, Code: 200, Data: json.RawMessage("{}")}, rsp)
+
+	req, err := f.DecodeRequest(append([]byte{CommandSet, 0, 0, 0, 9}, `{"switch":0}`...))
+	require.NoError(t, err)
+	require.Equal(t, &aiot.Request{ID: 9, Version: aiot.DefaultVersion, Params: json.RawMessage(`{"switch":0}`), Method: infra.MethodServicePropertySet}, req)
+
+	b, err = f.EncodeResponse(infra.MethodServicePropertySet, &aiot.Response{ID: 9, Code: 200, Data: "{}"})
+	require.NoError(t, err)
+	require.Equal(t, append([]byte{CommandSetReply, 0, 0, 0, 9, 0, 200}, "{}"...), b)
+
+	// 错误的帧
+	_, _, err = f.DecodeResponse([]byte{CommandReportReply, 0, 0})
+	require.Equal(t, ErrInvalidFrame, err)
+	_, err = f.DecodeRequest([]byte{0x7f, 0, 0, 0, 1})
+	require.True(t, errors.Is(err, ErrUnknownCommand))
+	_, err = f.EncodeRequest(&aiot.Request{Method: "thing.event.alarm.post"})
+	require.True(t, errors.Is(err, ErrUnknownMethod))
+
+	// 自定义命令字
+	f = NewFrame(WithCommand("thing.event.alarm.post", 0x10, 0x11))
+	b, err = f.EncodeRequest(&aiot.Request{ID: 1, Params: map[string]int{"level": 2}, Method: "thing.event.alarm.post"})
+	require.NoError(t, err)
+	require.Equal(t, byte(0x10), b[0])
+	method, _, err = f.DecodeResponse([]byte{0x11, 0, 0, 0, 1, 0, 200})
+	require.NoError(t, err)
+	require.Equal(t, "thing.event.alarm.post", method)
+}
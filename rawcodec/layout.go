@@ -0,0 +1,276 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package rawcodec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// FieldType 字段类型
+type FieldType string
+
+// 字段类型
+const (
+	Int8    FieldType = "int8"
+	Uint8   FieldType = "uint8"
+	Int16   FieldType = "int16"
+	Uint16  FieldType = "uint16"
+	Int32   FieldType = "int32"
+	Uint32  FieldType = "uint32"
+	Float32 FieldType = "float32"
+	Float64 FieldType = "float64"
+	Bool    FieldType = "bool"   // 1字节, 0: false, 其它: true
+	String  FieldType = "string" // 定长, 不足补0
+)
+
+// size 字段的字节长度
+func (sf Field) size() int {
+	switch sf.Type {
+	case Int8, Uint8, Bool:
+		return 1
+	case Int16, Uint16:
+		return 2
+	case Int32, Uint32, Float32:
+		return 4
+	case Float64:
+		return 8
+	case String:
+		return sf.Length
+	}
+	return 0
+}
+
+// Field 字段
+type Field struct {
+	Identifier string    `json:"identifier"`       // 属性或参数标识符
+	Type       FieldType `json:"type"`             // 字段类型
+	Length     int       `json:"length,omitempty"` // String 类型的字节长度
+	// Scale 缩放系数, 非0时帧中的值 = 属性值 / Scale, 如 0.1 表示帧中为属性值的10倍
+	Scale float64 `json:"scale,omitempty"`
+}
+
+// Layout 字段布局, 按字段顺序定长编码, 编码时所有字段必须存在
+type Layout struct {
+	LittleEndian bool    `json:"littleEndian,omitempty"` // 多字节字段是否为小端, 默认大端
+	Fields       []Field `json:"fields"`
+}
+
+func (sf *Layout) order() binary.ByteOrder {
+	if sf.LittleEndian {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// Size 布局的字节长度, 含无效字段类型时返回 -1
+func (sf *Layout) Size() int {
+	n := 0
+	for _, f := range sf.Fields {
+		size := f.size()
+		if size <= 0 {
+			return -1
+		}
+		n += size
+	}
+	return n
+}
+
+// Encode 按字段布局编码json对象
+func (sf *Layout) Encode(v json.RawMessage) ([]byte, error) {
+	size := sf.Size()
+	if size < 0 {
+		return nil, fmt.Errorf("rawcodec: invalid layout")
+	}
+	values := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(v, &values); err != nil {
+		return nil, err
+	}
+
+	order := sf.order()
+	b := make([]byte, size)
+	off := 0
+	for _, f := range sf.Fields {
+		raw, ok := values[f.Identifier]
+		if !ok {
+			return nil, fmt.Errorf("rawcodec: field %s missing", f.Identifier)
+		}
+		if err := f.encode(order, b[off:off+f.size()], raw); err != nil {
+			return nil, err
+		}
+		off += f.size()
+	}
+	return b, nil
+}
+
+// Decode 按字段布局解码为json对象
+func (sf *Layout) Decode(b []byte) (json.RawMessage, error) {
+	size := sf.Size()
+	if size < 0 {
+		return nil, fmt.Errorf("rawcodec: invalid layout")
+	}
+	if len(b) != size {
+		return nil, ErrInvalidFrame
+	}
+
+	order := sf.order()
+	values := make(map[string]interface{}, len(sf.Fields))
+	off := 0
+	for _, f := range sf.Fields {
+		values[f.Identifier] = f.decode(order, b[off:off+f.size()])
+		off += f.size()
+	}
+	return json.Marshal(values)
+}
+
+func (sf Field) encode(order binary.ByteOrder, b []byte, raw json.RawMessage) error {
+	switch sf.Type {
+	case String:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return fmt.Errorf("rawcodec: field %s, %w", sf.Identifier, err)
+		}
+		if len(s) > len(b) {
+			return fmt.Errorf("rawcodec: field %s exceeds %d bytes", sf.Identifier, len(b))
+		}
+		copy(b, s)
+		return nil
+	case Bool:
+		var bv bool
+		if json.Unmarshal(raw, &bv) == nil {
+			if bv {
+				b[0] = 1
+			}
+			return nil
+		}
+	}
+
+	var v float64
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Errorf("rawcodec: field %s, %w", sf.Identifier, err)
+	}
+	if sf.Scale != 0 {
+		v /= sf.Scale
+	}
+	switch sf.Type {
+	case Float32:
+		order.PutUint32(b, math.Float32bits(float32(v)))
+		return nil
+	case Float64:
+		order.PutUint64(b, math.Float64bits(v))
+		return nil
+	case Bool:
+		if v != 0 {
+			b[0] = 1
+		}
+		return nil
+	}
+
+	v = math.Round(v)
+	if min, max := sf.intRange(); v < min || v > max {
+		return fmt.Errorf("rawcodec: field %s value %v out of range [%v, %v]", sf.Identifier, v, min, max)
+	}
+	switch sf.Type {
+	case Int8, Uint8:
+		b[0] = byte(int64(v))
+	case Int16, Uint16:
+		order.PutUint16(b, uint16(int64(v)))
+	case Int32, Uint32:
+		order.PutUint32(b, uint32(int64(v)))
+	}
+	return nil
+}
+
+func (sf Field) intRange() (float64, float64) {
+	switch sf.Type {
+	case Int8:
+		return math.MinInt8, math.MaxInt8
+	case Uint8:
+		return 0, math.MaxUint8
+	case Int16:
+		return math.MinInt16, math.MaxInt16
+	case Uint16:
+		return 0, math.MaxUint16
+	case Int32:
+		return math.MinInt32, math.MaxInt32
+	}
+	return 0, math.MaxUint32
+}
+
+func (sf Field) decode(order binary.ByteOrder, b []byte) interface{} {
+	var v float64
+	switch sf.Type {
+	case String:
+		return string(bytes.TrimRight(b, "\x00"))
+	case Bool:
+		return b[0] != 0
+	case Int8:
+		v = float64(int8(b[0]))
+	case Uint8:
+		v = float64(b[0])
+	case Int16:
+		v = float64(int16(order.Uint16(b)))
+	case Uint16:
+		v = float64(order.Uint16(b))
+	case Int32:
+		v = float64(int32(order.Uint32(b)))
+	case Uint32:
+		v = float64(order.Uint32(b))
+	case Float32:
+		v = float64(math.Float32frombits(order.Uint32(b)))
+	case Float64:
+		v = math.Float64frombits(order.Uint64(b))
+	}
+	if sf.Scale != 0 {
+		v *= sf.Scale
+		// 消除缩放带来的浮点误差, 如 253 * 0.1
+		if p := math.Pow(10, decimals(sf.Scale)); p > 1 {
+			v = math.Round(v*p) / p
+		}
+	}
+	return v
+}
+
+// decimals 缩放系数的小数位数
+func decimals(scale float64) float64 {
+	n := 0.0
+	for scale != math.Trunc(scale) && n < 15 {
+		scale *= 10
+		n++
+	}
+	return n
+}
+
+// Layouts 按Alink方法声明字段布局的数据域编解码, 实现 Body
+// key为请求的Alink方法或 {method}_reply, 未声明布局的应答data域为空
+type Layouts map[string]*Layout
+
+// Encode implement Body
+func (sf Layouts) Encode(key string, v json.RawMessage) ([]byte, error) {
+	l, ok := sf[key]
+	if !ok {
+		if strings.HasSuffix(key, "_reply") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: no layout for %s", ErrUnknownMethod, key)
+	}
+	return l.Encode(v)
+}
+
+// Decode implement Body
+func (sf Layouts) Decode(key string, b []byte) (json.RawMessage, error) {
+	l, ok := sf[key]
+	if !ok {
+		if strings.HasSuffix(key, "_reply") {
+			return json.RawMessage("{}"), nil
+		}
+		return nil, fmt.Errorf("%w: no layout for %s", ErrUnknownMethod, key)
+	}
+	return l.Decode(b)
+}
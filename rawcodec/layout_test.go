@@ -0,0 +1,76 @@
+package rawcodec
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	aiot "github.com/things-go/aliyun-iot"
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+func TestLayout(t *testing.T) {
+	l := &Layout{
+		Fields: []Field{
+			{Identifier: "switch", Type: Bool},
+			{Identifier: "temperature", Type: Int16, Scale: 0.1},
+			{Identifier: "humidity", Type: Uint8},
+			{Identifier: "label", Type: String, Length: 4},
+			{Identifier: "voltage", Type: Float32},
+		},
+	}
+	require.Equal(t, 12, l.Size())
+
+	b, err := l.Encode(json.RawMessage(`{"switch":true,"temperature":-25.3,"humidity":60,"label":"ab","voltage":3.5}`))
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 0xff, 0x03, 60, 'a', 'b', 0, 0, 0x40, 0x60, 0, 0}, b)
+
+	v, err := l.Decode(b)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"switch":true,"temperature":-25.3,"humidity":60,"label":"ab","voltage":3.5}`, string(v))
+
+	// 小端
+	le := &Layout{LittleEndian: true, Fields: []Field{{Identifier: "count", Type: Uint32}}}
+	b, err = le.Encode(json.RawMessage(`{"count":258}`))
+	require.NoError(t, err)
+	require.Equal(t, []byte{2, 1, 0, 0}, b)
+
+	// 错误
+	_, err = l.Encode(json.RawMessage(`{"switch":true}`))
+	require.Error(t, err)
+	_, err = l.Encode(json.RawMessage(`{"switch":true,"temperature":20,"humidity":256,"label":"ab","voltage":1}`))
+	require.Error(t, err)
+	_, err = l.Encode(json.RawMessage(`{"switch":true,"temperature":20,"humidity":1,"label":"abcde","voltage":1}`))
+	require.Error(t, err)
+	_, err = l.Decode(b)
+	require.Equal(t, ErrInvalidFrame, err)
+}
+
+func TestLayouts(t *testing.T) {
+	f := NewFrame(WithBody(Layouts{
+		infra.MethodEventPropertyPost:  {Fields: []Field{{Identifier: "temperature", Type: Int16, Scale: 0.1}}},
+		infra.MethodServicePropertySet: {Fields: []Field{{Identifier: "switch", Type: Uint8}}},
+	}))
+
+	b, err := f.EncodeRequest(&aiot.Request{ID: 1, Params: map[string]float64{"temperature": 20.5}, Method: infra.MethodEventPropertyPost})
+	require.NoError(t, err)
+	require.Equal(t, []byte{CommandReport, 0, 0, 0, 1, 0, 205}, b)
+
+	// 未声明布局的应答data域为空
+	_, rsp, err := f.DecodeResponse([]byte{CommandReportReply, 0, 0, 0, 1, 0, 200})
+	require.NoError(t, err)
+	require.Equal(t, json.RawMessage("{}"), rsp.Data)
+
+	req, err := f.DecodeRequest([]byte{CommandSet, 0, 0, 0, 2, 1})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"switch":1}`, string(req.Params.(json.RawMessage)))
+
+	b, err = f.EncodeResponse(infra.MethodServicePropertySet, &aiot.Response{ID: 2, Code: 200, Data: "{}"})
+	require.NoError(t, err)
+	require.Equal(t, []byte{CommandSetReply, 0, 0, 0, 2, 0, 200}, b)
+
+	_, err = Layouts{}.Encode("thing.event.alarm.post", json.RawMessage("{}"))
+	require.True(t, errors.Is(err, ErrUnknownMethod))
+}
@@ -0,0 +1,212 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package rawscript
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	aiot "github.com/things-go/aliyun-iot"
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+// ErrNotSubscribed 设备未订阅下行主题
+var ErrNotSubscribed = errors.New("rawscript: topic not subscribed")
+
+// 确保实现 aiot.Conn 接口
+var _ aiot.Conn = (*Harness)(nil)
+
+// Uplink 设备经 up_raw 上行的透传数据
+type Uplink struct {
+	Topic   string
+	Payload []byte        // 设备上行的原始透传数据
+	Request *aiot.Request // 平台侧解码得到的Alink请求, Params为 json.RawMessage, 解码失败时为nil
+	Err     error         // 解码失败的错误
+}
+
+// Harness 离线测试用的模拟云端, 实现 aiot.Conn, 无需连接物联网平台.
+// 设备经 up_raw 上行的透传数据以平台侧编解码(如 Script)解码为Alink请求并记录, 见 Uplinks,
+// 解码成功时经 up_raw_reply 自动应答; Invoke 将Alink下行请求编码后经 down_raw 下发,
+// 并等待设备经 down_raw_reply 的回复. 需调用 Connect 订阅主题
+type Harness struct {
+	*aiot.Client
+	codec     PlatformCodec
+	requestID uint32
+
+	mu        sync.Mutex
+	subs      map[string]aiot.ProcDownStream
+	uplinks   []Uplink
+	pending   map[uint]chan *aiot.ResponseRawData
+	replyCode int
+}
+
+// NewHarness 新建模拟云端及连接到该云端的透传设备, codec为平台侧编解码, 自动使能 aiot.WithEnableModelRaw
+func NewHarness(meta infra.MetaTriad, codec PlatformCodec, opts ...aiot.Option) *Harness {
+	opts = append([]aiot.Option{aiot.WithEnableModelRaw()}, opts...)
+	m := aiot.New(meta, nil, opts...)
+	h := &Harness{
+		Client:    m,
+		codec:     codec,
+		subs:      make(map[string]aiot.ProcDownStream),
+		pending:   make(map[uint]chan *aiot.ResponseRawData),
+		replyCode: infra.CodeSuccess,
+	}
+	m.Conn = h
+	return h
+}
+
+// SetReplyCode 设置平台对上行请求应答的code, 默认 infra.CodeSuccess
+func (sf *Harness) SetReplyCode(code int) {
+	sf.mu.Lock()
+	sf.replyCode = code
+	sf.mu.Unlock()
+}
+
+// Uplinks 设备已上行的透传数据
+func (sf *Harness) Uplinks() []Uplink {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return append([]Uplink{}, sf.uplinks...)
+}
+
+// Invoke 下发Alink请求到设备, 如属性设置 infra.MethodServicePropertySet,
+// 服务调用 thing.service.{tsl.service.identifier}, 返回平台侧解码的设备回复
+func (sf *Harness) Invoke(ctx context.Context, pk, dn, method string, params interface{}) (*aiot.ResponseRawData, error) {
+	req := &aiot.Request{
+		ID:      uint(atomic.AddUint32(&sf.requestID, 1)),
+		Version: aiot.DefaultVersion,
+		Params:  params,
+		Method:  method,
+	}
+	frame, err := sf.codec.EncodeDownlink(req)
+	if err != nil {
+		return nil, err
+	}
+
+	_uri := uri.URI(uri.SysPrefix, uri.ThingModelDownRaw, pk, dn)
+	ch := make(chan *aiot.ResponseRawData, 1)
+	sf.mu.Lock()
+	streamFunc, ok := sf.subs[_uri]
+	if ok {
+		sf.pending[req.ID] = ch
+	}
+	sf.mu.Unlock()
+	if !ok {
+		return nil, ErrNotSubscribed
+	}
+	defer func() {
+		sf.mu.Lock()
+		delete(sf.pending, req.ID)
+		sf.mu.Unlock()
+	}()
+
+	if err = streamFunc(sf.Client, _uri, frame); err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case rsp := <-ch:
+		return rsp, nil
+	}
+}
+
+// Publish implement aiot.Conn
+func (sf *Harness) Publish(topic string, _ byte, payload interface{}) error {
+	var b []byte
+	switch v := payload.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(topic, uri.Sep+uri.ThingModelUpRaw):
+		sf.uplink(topic, b)
+	case strings.HasSuffix(topic, uri.Sep+uri.ThingModelDownRawReply):
+		sf.downlinkReply(b)
+	}
+	return nil
+}
+
+// uplink 解码并记录上行透传数据, 解码成功时自动应答
+func (sf *Harness) uplink(topic string, payload []byte) {
+	req, err := sf.codec.DecodeUplink(payload)
+	sf.mu.Lock()
+	sf.uplinks = append(sf.uplinks, Uplink{topic, payload, req, err})
+	code := sf.replyCode
+	replyURI := uri.ReplyWithRequestURI(topic)
+	streamFunc := sf.subs[replyURI]
+	sf.mu.Unlock()
+	if err != nil {
+		sf.StructuredLog().Warn("harness: decode uplink failed", "topic", topic, "error", err)
+		return
+	}
+	if streamFunc == nil || (req.Sys != nil && req.Sys.Ack == 0) {
+		return
+	}
+
+	frame, err := sf.codec.EncodeUplinkReply(req.Method, &aiot.Response{ID: req.ID, Code: code, Data: "{}"})
+	if err != nil {
+		sf.StructuredLog().Warn("harness: encode uplink reply failed", "topic", topic, "error", err)
+		return
+	}
+	// 与mqtt一致, 异步投递应答
+	go func() {
+		if err := streamFunc(sf.Client, replyURI, frame); err != nil {
+			sf.StructuredLog().Warn("harness: process uplink reply failed", "topic", replyURI, "error", err)
+		}
+	}()
+}
+
+// downlinkReply 解码设备对下行请求的回复
+func (sf *Harness) downlinkReply(payload []byte) {
+	_, rsp, err := sf.codec.DecodeDownlinkReply(payload)
+	if err != nil {
+		sf.StructuredLog().Warn("harness: decode downlink reply failed", "error", err)
+		return
+	}
+	sf.mu.Lock()
+	ch, ok := sf.pending[rsp.ID]
+	sf.mu.Unlock()
+	if ok {
+		select {
+		case ch <- rsp:
+		default:
+		}
+	}
+}
+
+// Subscribe implement aiot.Conn
+func (sf *Harness) Subscribe(topic string, streamFunc aiot.ProcDownStream) error {
+	sf.mu.Lock()
+	sf.subs[topic] = streamFunc
+	sf.mu.Unlock()
+	return nil
+}
+
+// UnSubscribe implement aiot.Conn
+func (sf *Harness) UnSubscribe(topic ...string) error {
+	sf.mu.Lock()
+	for _, t := range topic {
+		delete(sf.subs, t)
+	}
+	sf.mu.Unlock()
+	return nil
+}
+
+// Close implement aiot.Conn
+func (sf *Harness) Close() error { return nil }
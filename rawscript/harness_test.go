@@ -0,0 +1,67 @@
+package rawscript
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	aiot "github.com/things-go/aliyun-iot"
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/rawcodec"
+)
+
+func TestHarness(t *testing.T) {
+	s, err := LoadFile("testdata/script.js")
+	require.NoError(t, err)
+
+	// 设备侧按固件的帧格式编解码, 模拟云端以数据解析脚本编解码
+	codec := rawcodec.NewFrame(rawcodec.WithBody(rawcodec.Layouts{
+		infra.MethodEventPropertyPost: {Fields: []rawcodec.Field{
+			{Identifier: "temperature", Type: rawcodec.Int16, Scale: 0.1},
+			{Identifier: "switch", Type: rawcodec.Uint8},
+		}},
+		infra.MethodServicePropertySet: {Fields: []rawcodec.Field{
+			{Identifier: "switch", Type: rawcodec.Uint8},
+		}},
+	}))
+	h := NewHarness(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, s, aiot.WithRawCodec("", codec))
+	require.NoError(t, h.Connect())
+
+	token, err := h.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temperature": -25.3, "switch": 1})
+	require.NoError(t, err)
+	m, err := token.Wait(time.Second)
+	require.NoError(t, err)
+	require.NoError(t, m.Err())
+
+	uplinks := h.Uplinks()
+	require.Len(t, uplinks, 1)
+	require.NoError(t, uplinks[0].Err)
+	require.Equal(t, "/sys/pk/dn/thing/model/up_raw", uplinks[0].Topic)
+	require.Equal(t, infra.MethodEventPropertyPost, uplinks[0].Request.Method)
+	require.JSONEq(t, `{"temperature":-25.3,"switch":1}`, string(uplinks[0].Request.Params.(json.RawMessage)))
+
+	var got json.RawMessage
+	h.HandlePropertySet("switch", func(c *aiot.Client, pk, dn string, value json.RawMessage) (interface{}, error) {
+		got = value
+		return nil, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	rsp, err := h.Invoke(ctx, "pk", "dn", infra.MethodServicePropertySet, map[string]int{"switch": 1})
+	require.NoError(t, err)
+	require.Equal(t, infra.CodeSuccess, rsp.Code)
+	require.Equal(t, "1", string(got))
+
+	// 平台应答失败
+	h.SetReplyCode(infra.CodeRequestError)
+	token, err = h.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temperature": 20, "switch": 0})
+	require.NoError(t, err)
+	_, err = token.Wait(time.Second)
+	require.Error(t, err)
+
+	_, err = h.Invoke(ctx, "pk", "other", infra.MethodServicePropertySet, map[string]int{"switch": 1})
+	require.Equal(t, ErrNotSubscribed, err)
+}
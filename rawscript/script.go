@@ -0,0 +1,299 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package rawscript 在本地嵌入式js引擎中运行阿里云透传产品的数据解析脚本,
+// 即脚本的 rawDataToProtocol 及 protocolToRawData 函数, 无需部署到云端即可校验设备的透传帧.
+// Script 实现平台侧的编解码 PlatformCodec, Harness 以此模拟云端, 用于离线测试.
+// @see https://help.aliyun.com/document_detail/68702.html
+package rawscript
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	aiot "github.com/things-go/aliyun-iot"
+)
+
+// 默认值
+const (
+	DefaultTimeout = time.Second
+)
+
+// 脚本函数名
+const (
+	FuncRawDataToProtocol = "rawDataToProtocol"
+	FuncProtocolToRawData = "protocolToRawData"
+)
+
+// 错误定义
+var (
+	ErrTimeout       = errors.New("rawscript: script execution timeout")
+	ErrInvalidResult = errors.New("rawscript: invalid script result")
+)
+
+// MaxFrameSize protocolToRawData 返回的二进制帧最大长度, 即mqtt消息的最大长度
+const MaxFrameSize = 256 * 1024
+
+// PlatformCodec 平台侧透传帧编解码, 方向与设备侧的 aiot.RawCodec 相反, 不能用于 aiot.WithRawCodec
+type PlatformCodec interface {
+	// DecodeUplink 将设备 up_raw 的二进制帧解码为上行请求, Params为 json.RawMessage
+	DecodeUplink(frame []byte) (*aiot.Request, error)
+	// EncodeUplinkReply 将平台对上行请求的应答编码为 up_raw_reply 的二进制帧, method为请求的Alink方法
+	EncodeUplinkReply(method string, rsp *aiot.Response) ([]byte, error)
+	// EncodeDownlink 将平台的下行请求编码为 down_raw 的二进制帧
+	EncodeDownlink(req *aiot.Request) ([]byte, error)
+	// DecodeDownlinkReply 将设备 down_raw_reply 的二进制帧解码为下行请求的回复, method可能为空
+	DecodeDownlinkReply(frame []byte) (method string, rsp *aiot.ResponseRawData, err error)
+}
+
+// 确保实现 PlatformCodec 接口
+var _ PlatformCodec = (*Script)(nil)
+
+// Option 选项
+type Option func(*Script)
+
+// WithTimeout 单次脚本函数执行的超时时间, 默认 DefaultTimeout, 0 表示不限制
+func WithTimeout(d time.Duration) Option {
+	return func(s *Script) {
+		s.timeout = d
+	}
+}
+
+// Script 阿里云数据解析脚本, 协程安全. 作为平台侧编解码 PlatformCodec:
+//   - DecodeUplink: 设备上行请求(up_raw) --> rawDataToProtocol
+//   - EncodeUplinkReply: 平台对上行请求的应答(up_raw_reply) <-- protocolToRawData
+//   - EncodeDownlink: 平台下行请求(down_raw) <-- protocolToRawData
+//   - DecodeDownlinkReply: 设备对下行请求的回复(down_raw_reply) --> rawDataToProtocol
+type Script struct {
+	mu                sync.Mutex
+	vm                *goja.Runtime
+	rawDataToProtocol goja.Callable
+	protocolToRawData goja.Callable
+	jsonParse         goja.Callable
+	timeout           time.Duration
+}
+
+// New 加载脚本源码, 脚本需定义 rawDataToProtocol 及 protocolToRawData 函数
+func New(src string, opts ...Option) (*Script, error) {
+	sf := &Script{
+		vm:      goja.New(),
+		timeout: DefaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(sf)
+	}
+
+	if _, err := sf.run(func() (goja.Value, error) { return sf.vm.RunString(src) }); err != nil {
+		return nil, err
+	}
+	var ok bool
+	if sf.rawDataToProtocol, ok = goja.AssertFunction(sf.vm.Get(FuncRawDataToProtocol)); !ok {
+		return nil, fmt.Errorf("rawscript: function %s not defined", FuncRawDataToProtocol)
+	}
+	if sf.protocolToRawData, ok = goja.AssertFunction(sf.vm.Get(FuncProtocolToRawData)); !ok {
+		return nil, fmt.Errorf("rawscript: function %s not defined", FuncProtocolToRawData)
+	}
+	sf.jsonParse, _ = goja.AssertFunction(sf.vm.Get("JSON").ToObject(sf.vm).Get("parse"))
+	return sf, nil
+}
+
+// LoadFile 从文件加载脚本
+func LoadFile(filename string, opts ...Option) (*Script, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return New(string(src), opts...)
+}
+
+// RawDataToProtocol 执行脚本的 rawDataToProtocol, 将设备上行的透传数据转换为Alink JSON.
+// 与云端一致, 脚本入参为有符号字节(-128~127)数组
+func (sf *Script) RawDataToProtocol(raw []byte) (json.RawMessage, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	items := make([]interface{}, len(raw))
+	for i, b := range raw {
+		items[i] = int8(b)
+	}
+	v, err := sf.run(func() (goja.Value, error) {
+		return sf.rawDataToProtocol(goja.Undefined(), sf.vm.NewArray(items...))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, fmt.Errorf("%w: %s returned %v", ErrInvalidResult, FuncRawDataToProtocol, v)
+	}
+	return json.Marshal(v.Export())
+}
+
+// ProtocolToRawData 执行脚本的 protocolToRawData, 将Alink JSON转换为下行到设备的透传数据.
+// v为json文本(string, []byte, json.RawMessage)或可json序列化的值,
+// 脚本返回值为数组或类型化数组, 元素按字节截断
+func (sf *Script) ProtocolToRawData(v interface{}) ([]byte, error) {
+	var text string
+	switch vv := v.(type) {
+	case string:
+		text = vv
+	case []byte:
+		text = string(vv)
+	case json.RawMessage:
+		text = string(vv)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	result, err := sf.run(func() (goja.Value, error) {
+		arg, err := sf.jsonParse(goja.Undefined(), sf.vm.ToValue(text))
+		if err != nil {
+			return nil, err
+		}
+		return sf.protocolToRawData(goja.Undefined(), arg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if goja.IsUndefined(result) || goja.IsNull(result) {
+		return nil, fmt.Errorf("%w: %s returned %v", ErrInvalidResult, FuncProtocolToRawData, result)
+	}
+	obj := result.ToObject(sf.vm)
+	length := obj.Get("length")
+	if length == nil || goja.IsUndefined(length) {
+		return nil, fmt.Errorf("%w: %s returned %v", ErrInvalidResult, FuncProtocolToRawData, result)
+	}
+	n := length.ToInteger()
+	if n < 0 || n > MaxFrameSize {
+		return nil, fmt.Errorf("%w: %s returned length %d", ErrInvalidResult, FuncProtocolToRawData, n)
+	}
+	raw := make([]byte, n)
+	for i := range raw {
+		v := obj.Get(strconv.Itoa(i))
+		if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+			return nil, fmt.Errorf("%w: %s returned no element at %d", ErrInvalidResult, FuncProtocolToRawData, i)
+		}
+		raw[i] = byte(v.ToInteger())
+	}
+	return raw, nil
+}
+
+// run 执行脚本, 超时后中断
+func (sf *Script) run(f func() (goja.Value, error)) (goja.Value, error) {
+	if sf.timeout > 0 {
+		t := time.AfterFunc(sf.timeout, func() { sf.vm.Interrupt(ErrTimeout) })
+		defer func() {
+			t.Stop()
+			sf.vm.ClearInterrupt()
+		}()
+	}
+	v, err := f()
+	if err != nil {
+		var ie *goja.InterruptedError
+		if errors.As(err, &ie) && ie.Value() == ErrTimeout {
+			return nil, ErrTimeout
+		}
+		return nil, fmt.Errorf("rawscript: %w", err)
+	}
+	return v, nil
+}
+
+// alink 脚本转换得到的Alink JSON, id及code可能为字符串或数字
+type alink struct {
+	ID      json.RawMessage `json:"id"`
+	Version string          `json:"version"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Code    json.RawMessage `json:"code"`
+	Data    json.RawMessage `json:"data"`
+	Message string          `json:"message"`
+}
+
+func (sf *Script) decode(frame []byte) (*alink, error) {
+	b, err := sf.RawDataToProtocol(frame)
+	if err != nil {
+		return nil, err
+	}
+	v := &alink{}
+	if err = json.Unmarshal(b, v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResult, err)
+	}
+	return v, nil
+}
+
+// DecodeUplink implement PlatformCodec, 以 rawDataToProtocol 解码设备的上行请求
+func (sf *Script) DecodeUplink(frame []byte) (*aiot.Request, error) {
+	v, err := sf.decode(frame)
+	if err != nil {
+		return nil, err
+	}
+	if v.Method == "" {
+		return nil, fmt.Errorf("%w: method missing", ErrInvalidResult)
+	}
+	id, err := parseUint(v.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: id, %v", ErrInvalidResult, err)
+	}
+	return &aiot.Request{ID: id, Version: v.Version, Params: v.Params, Method: v.Method}, nil
+}
+
+// DecodeDownlinkReply implement PlatformCodec, 以 rawDataToProtocol 解码设备对下行请求的回复,
+// 脚本未给出method时返回空
+func (sf *Script) DecodeDownlinkReply(frame []byte) (string, *aiot.ResponseRawData, error) {
+	v, err := sf.decode(frame)
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := parseUint(v.ID)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: id, %v", ErrInvalidResult, err)
+	}
+	code, err := parseUint(v.Code)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: code, %v", ErrInvalidResult, err)
+	}
+	return v.Method, &aiot.ResponseRawData{ID: id, Code: int(code), Data: v.Data, Message: v.Message}, nil
+}
+
+// EncodeDownlink implement PlatformCodec, 以 protocolToRawData 编码平台的下行请求
+func (sf *Script) EncodeDownlink(req *aiot.Request) ([]byte, error) {
+	return sf.ProtocolToRawData(req)
+}
+
+// EncodeUplinkReply implement PlatformCodec, 以 protocolToRawData 编码平台对上行请求的应答
+func (sf *Script) EncodeUplinkReply(method string, rsp *aiot.Response) ([]byte, error) {
+	r := *rsp
+	// 回复中常用的 "{}" 视为json文本
+	if s, ok := r.Data.(string); ok && json.Valid([]byte(s)) {
+		r.Data = json.RawMessage(s)
+	}
+	return sf.ProtocolToRawData(struct {
+		aiot.Response
+		Version string `json:"version"`
+		Method  string `json:"method"`
+	}{r, aiot.DefaultVersion, method})
+}
+
+// parseUint 解析字符串或数字形式的无符号整数
+func parseUint(b json.RawMessage) (uint, error) {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		s = string(b)
+	}
+	v, err := strconv.ParseUint(s, 10, 0)
+	return uint(v), err
+}
@@ -0,0 +1,88 @@
+package rawscript
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	aiot "github.com/things-go/aliyun-iot"
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+func TestScript(t *testing.T) {
+	s, err := LoadFile("testdata/script.js")
+	require.NoError(t, err)
+
+	// 温度 -25.3 即 0xff03
+	v, err := s.RawDataToProtocol([]byte{0x00, 0, 0, 0, 7, 0xff, 0x03, 1})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"method":"thing.event.property.post","version":"1.0","id":"7","params":{"temperature":-25.3,"switch":1}}`, string(v))
+
+	b, err := s.ProtocolToRawData(`{"id":"8","version":"1.0","method":"thing.service.property.set","params":{"switch":1}}`)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x01, 0, 0, 0, 8, 1}, b)
+
+	// 平台侧 PlatformCodec
+	req, err := s.DecodeUplink([]byte{0x00, 0, 0, 1, 0, 0, 200, 0})
+	require.NoError(t, err)
+	require.Equal(t, uint(256), req.ID)
+	require.Equal(t, infra.MethodEventPropertyPost, req.Method)
+	require.JSONEq(t, `{"temperature":20,"switch":0}`, string(req.Params.(json.RawMessage)))
+
+	b, err = s.EncodeUplinkReply(req.Method, &aiot.Response{ID: req.ID, Code: infra.CodeSuccess, Data: "{}"})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x02, 0, 0, 1, 0, 0, 200}, b)
+
+	b, err = s.EncodeDownlink(&aiot.Request{ID: 9, Params: map[string]int{"switch": 0}, Method: infra.MethodServicePropertySet})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x01, 0, 0, 0, 9, 0}, b)
+
+	method, rsp, err := s.DecodeDownlinkReply([]byte{0x03, 0, 0, 0, 9, 0, 200})
+	require.NoError(t, err)
+	require.Equal(t, "", method)
+	require.Equal(t, uint(9), rsp.ID)
+	require.Equal(t, infra.CodeSuccess, rsp.Code)
+
+	// 脚本未能解析的帧
+	_, err = s.DecodeUplink([]byte{0x7f})
+	require.ErrorIs(t, err, ErrInvalidResult)
+}
+
+func TestScriptError(t *testing.T) {
+	_, err := New(`function rawDataToProtocol(bytes) { return {}; }`)
+	require.Error(t, err)
+	_, err = New(`function rawDataToProtocol(bytes) {`)
+	require.Error(t, err)
+
+	s, err := New(`
+function rawDataToProtocol(bytes) { while (true) {} }
+function protocolToRawData(json) { return null; }
+`, WithTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	_, err = s.RawDataToProtocol([]byte{0})
+	require.Equal(t, ErrTimeout, err)
+	_, err = s.ProtocolToRawData(`{}`)
+	require.ErrorIs(t, err, ErrInvalidResult)
+}
+
+func TestScriptInvalidRawData(t *testing.T) {
+	for _, src := range []string{
+		// 稀疏数组
+		`var a = []; a[2] = 1; return a;`,
+		// 类数组对象
+		`return {length: 2, 0: 1};`,
+		// 长度超出限制
+		`return {length: 1e12};`,
+		`return {length: -1};`,
+	} {
+		s, err := New(`
+function rawDataToProtocol(bytes) { return {}; }
+function protocolToRawData(json) { ` + src + ` }
+`)
+		require.NoError(t, err)
+		_, err = s.ProtocolToRawData(`{}`)
+		require.ErrorIs(t, err, ErrInvalidResult, src)
+	}
+}
@@ -0,0 +1,71 @@
+// 透传产品数据解析脚本, 帧格式与 rawcodec.Frame 一致:
+// 请求帧: 命令字(1字节) | 请求ID(4字节) | params
+// 应答帧: 命令字(1字节) | 请求ID(4字节) | code(2字节) | data
+var COMMAND_REPORT = 0x00;
+var COMMAND_SET = 0x01;
+var COMMAND_REPORT_REPLY = 0x02;
+var COMMAND_SET_REPLY = 0x03;
+var ALINK_PROP_REPORT_METHOD = 'thing.event.property.post';
+var ALINK_PROP_SET_METHOD = 'thing.service.property.set';
+
+function rawDataToProtocol(bytes) {
+    var uint8Array = new Uint8Array(bytes.length);
+    for (var i = 0; i < bytes.length; i++) {
+        uint8Array[i] = bytes[i] & 0xff;
+    }
+    var dataView = new DataView(uint8Array.buffer, 0);
+    var jsonMap = {};
+    var fHead = uint8Array[0];
+    if (fHead == COMMAND_REPORT) {
+        jsonMap['method'] = ALINK_PROP_REPORT_METHOD;
+        jsonMap['version'] = '1.0';
+        jsonMap['id'] = '' + dataView.getUint32(1);
+        jsonMap['params'] = {
+            'temperature': dataView.getInt16(5) / 10,
+            'switch': uint8Array[7]
+        };
+    } else if (fHead == COMMAND_SET_REPLY) {
+        jsonMap['version'] = '1.0';
+        jsonMap['id'] = '' + dataView.getUint32(1);
+        jsonMap['code'] = '' + dataView.getUint16(5);
+        jsonMap['data'] = {};
+    }
+    return jsonMap;
+}
+
+function protocolToRawData(json) {
+    var method = json['method'];
+    var id = parseInt(json['id']);
+    var payloadArray = [];
+    if (method == ALINK_PROP_SET_METHOD) {
+        payloadArray = payloadArray.concat(buffer_uint8(COMMAND_SET));
+        payloadArray = payloadArray.concat(buffer_uint32(id));
+        payloadArray = payloadArray.concat(buffer_uint8(json['params']['switch']));
+    } else if (method == ALINK_PROP_REPORT_METHOD) {
+        payloadArray = payloadArray.concat(buffer_uint8(COMMAND_REPORT_REPLY));
+        payloadArray = payloadArray.concat(buffer_uint32(id));
+        payloadArray = payloadArray.concat(buffer_uint16(json['code']));
+    }
+    return payloadArray;
+}
+
+function buffer_uint8(value) {
+    var uint8Array = new Uint8Array(1);
+    var dv = new DataView(uint8Array.buffer, 0);
+    dv.setUint8(0, value);
+    return [].slice.call(uint8Array);
+}
+
+function buffer_uint16(value) {
+    var uint8Array = new Uint8Array(2);
+    var dv = new DataView(uint8Array.buffer, 0);
+    dv.setUint16(0, value);
+    return [].slice.call(uint8Array);
+}
+
+function buffer_uint32(value) {
+    var uint8Array = new Uint8Array(4);
+    var dv = new DataView(uint8Array.buffer, 0);
+    dv.setUint32(0, value);
+    return [].slice.call(uint8Array);
+}
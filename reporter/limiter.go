@@ -0,0 +1,46 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package reporter
+
+import (
+	"time"
+)
+
+// limiter 令牌桶限速,非协程安全
+type limiter struct {
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(qps float64, burst int, now time.Time) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{qps, float64(burst), float64(burst), now}
+}
+
+// available 是否有可用的令牌
+func (sf *limiter) available(now time.Time) bool {
+	if elapsed := now.Sub(sf.last).Seconds(); elapsed > 0 {
+		sf.tokens += elapsed * sf.qps
+		if sf.tokens > sf.burst {
+			sf.tokens = sf.burst
+		}
+		sf.last = now
+	}
+	return sf.tokens >= 1
+}
+
+// take 消耗一个令牌
+func (sf *limiter) take() { sf.tokens-- }
+
+// put 归还一个令牌
+func (sf *limiter) put() {
+	if sf.tokens++; sf.tokens > sf.burst {
+		sf.tokens = sf.burst
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package reporter 属性上报引擎,支持变化死区,周期心跳,最小上报间隔,
+// 按窗口合并上报及按设备,网关限速
+package reporter
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+
+	aiot "github.com/things-go/aliyun-iot"
+)
+
+// 默认值
+const (
+	DefaultWindow = time.Second
+)
+
+// Poster 属性上报接口, aiot.Client 实现了该接口
+type Poster interface {
+	ThingEventPropertyPost(pk, dn string, params interface{}, opts ...aiot.RequestOption) (*aiot.Token, error)
+}
+
+// Policy 属性上报策略,零值表示值有变化即上报
+type Policy struct {
+	// 绝对死区,数值变化量大于等于该值才上报
+	Deadband float64
+	// 百分比死区,数值变化量相对上次上报值的百分比大于等于该值才上报,如 5 表示 5%
+	DeadbandPercent float64
+	// 心跳周期,距上次上报超过该时间,即使值无变化也上报, 0 表示不启用
+	Heartbeat time.Duration
+	// 最小上报间隔,距上次上报不足该时间的变化将延后上报
+	MinInterval time.Duration
+}
+
+// Option 选项
+type Option func(*Reporter)
+
+// WithWindow 合并窗口,窗口内的变化合并为一次上报, 默认 DefaultWindow
+func WithWindow(d time.Duration) Option {
+	return func(r *Reporter) {
+		if d > 0 {
+			r.window = d
+		}
+	}
+}
+
+// WithDeviceRate 每个设备的上报速率限制
+// qps: 每秒上报次数, burst: 突发上报次数
+func WithDeviceRate(qps float64, burst int) Option {
+	return func(r *Reporter) {
+		r.deviceQPS, r.deviceBurst = qps, burst
+	}
+}
+
+// WithGatewayRate 网关(所有设备合计)的上报速率限制
+// qps: 每秒上报次数, burst: 突发上报次数
+func WithGatewayRate(qps float64, burst int) Option {
+	return func(r *Reporter) {
+		if qps > 0 {
+			r.gateway = newLimiter(qps, burst, time.Now())
+		}
+	}
+}
+
+// WithRequestOptions 上报时使用的单次请求选项,如 aiot.WithAck(false) 关闭云端回复
+func WithRequestOptions(opts ...aiot.RequestOption) Option {
+	return func(r *Reporter) {
+		r.requestOpts = opts
+	}
+}
+
+type property struct {
+	policy     Policy
+	value      interface{}
+	hasValue   bool
+	reported   interface{}
+	reportedAt time.Time
+	hasReport  bool
+}
+
+type device struct {
+	pk, dn     string
+	properties map[string]*property
+	limiter    *limiter
+}
+
+// Reporter 属性上报引擎
+type Reporter struct {
+	poster      Poster
+	window      time.Duration
+	deviceQPS   float64
+	deviceBurst int
+	gateway     *limiter
+	requestOpts []aiot.RequestOption
+
+	mu      sync.Mutex
+	devices map[string]*device
+	order   []string
+	next    int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New 新建属性上报引擎, 需调用 Close 停止
+func New(poster Poster, opts ...Option) *Reporter {
+	r := &Reporter{
+		poster:  poster,
+		window:  DefaultWindow,
+		devices: make(map[string]*device),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.wg.Add(1)
+	go r.run()
+	return r
+}
+
+// Close 停止上报,未上报的变化将被丢弃
+func (sf *Reporter) Close() error {
+	select {
+	case <-sf.done:
+	default:
+		close(sf.done)
+	}
+	sf.wg.Wait()
+	return nil
+}
+
+// Declare 声明属性的上报策略,未声明的属性使用零值策略
+func (sf *Reporter) Declare(pk, dn, id string, p Policy) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.propertyLocked(pk, dn, id).policy = p
+}
+
+// Set 更新属性值,按策略在之后的窗口上报
+func (sf *Reporter) Set(pk, dn, id string, value interface{}) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	prop := sf.propertyLocked(pk, dn, id)
+	prop.value, prop.hasValue = value, true
+}
+
+func (sf *Reporter) propertyLocked(pk, dn, id string) *property {
+	key := aiot.FormatKey(pk, dn)
+	dev, ok := sf.devices[key]
+	if !ok {
+		dev = &device{pk: pk, dn: dn, properties: make(map[string]*property)}
+		if sf.deviceQPS > 0 {
+			dev.limiter = newLimiter(sf.deviceQPS, sf.deviceBurst, time.Now())
+		}
+		sf.devices[key] = dev
+		sf.order = append(sf.order, key)
+	}
+	prop, ok := dev.properties[id]
+	if !ok {
+		prop = &property{}
+		dev.properties[id] = prop
+	}
+	return prop
+}
+
+func (sf *Reporter) run() {
+	defer sf.wg.Done()
+	tick := time.NewTicker(sf.window)
+	defer tick.Stop()
+	for {
+		select {
+		case <-sf.done:
+			return
+		case now := <-tick.C:
+			sf.flush(now)
+		}
+	}
+}
+
+// report 一次待上报的设备属性
+type report struct {
+	dev    *device
+	params map[string]interface{}
+}
+
+// flush 上报所有到期的属性,每个设备合并为一次上报
+// 在锁内取出待上报的属性并预占令牌, 在锁外上报, 上报失败时归还令牌, 属性在之后的窗口重新上报
+func (sf *Reporter) flush(now time.Time) {
+	reports := sf.collect(now)
+	if len(reports) == 0 {
+		return
+	}
+
+	failed := make([]bool, len(reports))
+	for i, rp := range reports {
+		_, err := sf.poster.ThingEventPropertyPost(rp.dev.pk, rp.dev.dn, rp.params, sf.requestOpts...)
+		failed[i] = err != nil && !errors.Is(err, aiot.ErrOfflineQueued)
+	}
+
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	for i, rp := range reports {
+		if failed[i] {
+			if sf.gateway != nil {
+				sf.gateway.put()
+			}
+			if rp.dev.limiter != nil {
+				rp.dev.limiter.put()
+			}
+			continue
+		}
+		for id, v := range rp.params {
+			prop := rp.dev.properties[id]
+			prop.reported, prop.reportedAt, prop.hasReport = v, now, true
+		}
+	}
+}
+
+// collect 取出所有到期的属性并消耗令牌
+// 超出速率限制的设备延后到之后的窗口,从上次中断的设备开始轮询以保证公平
+func (sf *Reporter) collect(now time.Time) []report {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	var reports []report
+	n := len(sf.order)
+	for i := 0; i < n; i++ {
+		idx := (sf.next + i) % n
+		dev := sf.devices[sf.order[idx]]
+		params := make(map[string]interface{})
+		for id, prop := range dev.properties {
+			if prop.due(now) {
+				params[id] = prop.value
+			}
+		}
+		if len(params) == 0 {
+			continue
+		}
+		if sf.gateway != nil && !sf.gateway.available(now) {
+			sf.next = idx
+			return reports
+		}
+		if dev.limiter != nil && !dev.limiter.available(now) {
+			continue
+		}
+		if sf.gateway != nil {
+			sf.gateway.take()
+		}
+		if dev.limiter != nil {
+			dev.limiter.take()
+		}
+		reports = append(reports, report{dev, params})
+	}
+	sf.next = 0
+	return reports
+}
+
+// due 属性是否需要上报
+func (sf *property) due(now time.Time) bool {
+	if !sf.hasValue {
+		return false
+	}
+	if !sf.hasReport {
+		return true
+	}
+	elapsed := now.Sub(sf.reportedAt)
+	if sf.policy.Heartbeat > 0 && elapsed >= sf.policy.Heartbeat {
+		return true
+	}
+	return elapsed >= sf.policy.MinInterval && sf.changed()
+}
+
+// changed 当前值相对上次上报值是否超出死区
+func (sf *property) changed() bool {
+	cur, ok1 := toFloat(sf.value)
+	last, ok2 := toFloat(sf.reported)
+	if !ok1 || !ok2 {
+		return !reflect.DeepEqual(sf.value, sf.reported)
+	}
+	delta := math.Abs(cur - last)
+	if delta == 0 {
+		return false
+	}
+	if sf.policy.Deadband > 0 && delta < sf.policy.Deadband {
+		return false
+	}
+	if sf.policy.DeadbandPercent > 0 && last != 0 &&
+		delta/math.Abs(last)*100 < sf.policy.DeadbandPercent {
+		return false
+	}
+	return true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
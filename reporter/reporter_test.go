@@ -0,0 +1,124 @@
+package reporter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	aiot "github.com/things-go/aliyun-iot"
+)
+
+type post struct {
+	pk, dn string
+	params map[string]interface{}
+}
+
+type mockPoster struct {
+	posts  []post
+	onPost func() error
+}
+
+func (sf *mockPoster) ThingEventPropertyPost(pk, dn string, params interface{}, _ ...aiot.RequestOption) (*aiot.Token, error) {
+	sf.posts = append(sf.posts, post{pk, dn, params.(map[string]interface{})})
+	if sf.onPost != nil {
+		return nil, sf.onPost()
+	}
+	return nil, nil
+}
+
+func (sf *mockPoster) reset() []post {
+	posts := sf.posts
+	sf.posts = nil
+	return posts
+}
+
+func TestReporterPolicy(t *testing.T) {
+	p := &mockPoster{}
+	r := New(p, WithWindow(time.Hour))
+	defer r.Close()
+
+	r.Declare("pk", "dn", "temp", Policy{Deadband: 0.5})
+	r.Declare("pk", "dn", "hum", Policy{DeadbandPercent: 10, Heartbeat: time.Minute})
+	r.Declare("pk", "dn", "mode", Policy{MinInterval: 10 * time.Second})
+
+	now := time.Now()
+	r.Set("pk", "dn", "temp", 20.0)
+	r.Set("pk", "dn", "hum", 50)
+	r.Set("pk", "dn", "mode", "auto")
+	r.flush(now)
+	require.Equal(t, []post{{"pk", "dn", map[string]interface{}{"temp": 20.0, "hum": 50, "mode": "auto"}}}, p.reset())
+
+	// 死区内不上报, 最小间隔内不上报
+	now = now.Add(time.Second)
+	r.Set("pk", "dn", "temp", 20.3)
+	r.Set("pk", "dn", "hum", 54)
+	r.Set("pk", "dn", "mode", "manual")
+	r.flush(now)
+	require.Empty(t, p.reset())
+
+	// 相对上次上报值超出死区, 合并为一次上报
+	now = now.Add(10 * time.Second)
+	r.Set("pk", "dn", "temp", 20.6)
+	r.Set("pk", "dn", "hum", 56)
+	r.flush(now)
+	require.Equal(t, []post{{"pk", "dn", map[string]interface{}{"temp": 20.6, "hum": 56, "mode": "manual"}}}, p.reset())
+
+	// 心跳
+	now = now.Add(time.Minute)
+	r.flush(now)
+	require.Equal(t, []post{{"pk", "dn", map[string]interface{}{"hum": 56}}}, p.reset())
+}
+
+func TestReporterRate(t *testing.T) {
+	p := &mockPoster{}
+	r := New(p, WithWindow(time.Hour), WithDeviceRate(1, 1), WithGatewayRate(2, 2))
+	defer r.Close()
+
+	now := time.Now()
+	for _, dn := range []string{"a", "b", "c"} {
+		r.Set("pk", dn, "v", 1)
+	}
+	r.flush(now)
+	require.Len(t, p.reset(), 2) // 网关限速
+
+	r.Set("pk", "a", "v", 2)
+	now = now.Add(500 * time.Millisecond)
+	r.flush(now)
+	posts := p.reset()
+	require.Len(t, posts, 1) // a 设备限速, c 获得网关令牌
+	require.Equal(t, "c", posts[0].dn)
+
+	now = now.Add(time.Second)
+	r.flush(now)
+	posts = p.reset()
+	require.Len(t, posts, 1)
+	require.Equal(t, "a", posts[0].dn)
+	require.Equal(t, 2, posts[0].params["v"])
+}
+
+func TestReporterPostUnlocked(t *testing.T) {
+	p := &mockPoster{}
+	r := New(p, WithWindow(time.Hour), WithGatewayRate(1, 1))
+	defer r.Close()
+
+	// 上报时不持有锁, 上报中更新的值在之后的窗口上报
+	now := time.Now()
+	r.Set("pk", "dn", "v", 1)
+	p.onPost = func() error {
+		r.Set("pk", "dn", "v", 2)
+		return nil
+	}
+	r.flush(now)
+	require.Equal(t, []post{{"pk", "dn", map[string]interface{}{"v": 1}}}, p.reset())
+
+	// 上报失败归还令牌, 之后的窗口重新上报
+	p.onPost = func() error { return errors.New("publish failed") }
+	now = now.Add(time.Second)
+	r.flush(now)
+	require.Len(t, p.reset(), 1)
+	p.onPost = nil
+	r.flush(now)
+	require.Equal(t, []post{{"pk", "dn", map[string]interface{}{"v": 2}}}, p.reset())
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+// requestOptions 单次请求的选项
+type requestOptions struct {
+	qos byte
+	ack bool
+	end func(err error) // 需要回复的请求结束时调用, 仅内部使用
+}
+
+// RequestOption 单次请求的配置选项
+type RequestOption func(*requestOptions)
+
+// WithQoS 设置请求发布的QoS,默认为1
+func WithQoS(qos byte) RequestOption {
+	return func(o *requestOptions) {
+		o.qos = qos
+	}
+}
+
+// WithAck 设置是否需要云端回复(sys.ack),默认需要.
+// 不需要回复时请求体携带 "sys":{"ack":0},返回的Token在发布成功后即完成.
+func WithAck(ack bool) RequestOption {
+	return func(o *requestOptions) {
+		o.ack = ack
+	}
+}
+
+// withEnd 设置需要回复的请求收到回复,超时或取消时的回调, err为nil表示请求成功
+func withEnd(end func(err error)) RequestOption {
+	return func(o *requestOptions) {
+		o.end = end
+	}
+}
+
+func newRequestOptions(opts ...RequestOption) requestOptions {
+	o := requestOptions{qos: 1, ack: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// sys 请求的sys参数域,需要回复时为nil,保持与未设置时一致
+func (sf requestOptions) sys() *RequestSys {
+	if sf.ack {
+		return nil
+	}
+	return &RequestSys{Ack: 0}
+}
+
+// completedToken 已完成的Token,用于无需回复的请求
+func completedToken(id uint, method string) *Token {
+	ch := make(chan Message, 1)
+	ch <- Message{ID: id}
+	return &Token{id: id, method: method, message: ch}
+}
@@ -0,0 +1,58 @@
+package aiot
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+func TestRequestOption(t *testing.T) {
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn)
+
+	t.Run("default", func(t *testing.T) {
+		token, err := c.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temp": 1})
+		require.NoError(t, err)
+		msgs := conn.messages()
+		msg := msgs[len(msgs)-1]
+		require.Equal(t, byte(1), msg.qos)
+		require.NotContains(t, string(msg.payload), `"sys"`)
+
+		_, err = token.Wait(time.Millisecond)
+		require.Equal(t, ErrWaitTimeout, err)
+	})
+
+	t.Run("no ack", func(t *testing.T) {
+		token, err := c.ThingEventPost("pk", "dn", "alarm", map[string]interface{}{"high": 1},
+			WithAck(false), WithQoS(0))
+		require.NoError(t, err)
+		msgs := conn.messages()
+		msg := msgs[len(msgs)-1]
+		require.Equal(t, byte(0), msg.qos)
+
+		req := struct {
+			ID  uint `json:"id,string"`
+			Sys struct {
+				Ack *int `json:"ack"`
+			} `json:"sys"`
+		}{}
+		require.NoError(t, json.Unmarshal(msg.payload, &req))
+		require.NotNil(t, req.Sys.Ack)
+		require.Equal(t, 0, *req.Sys.Ack)
+
+		m, err := token.Wait(time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, req.ID, m.ID)
+	})
+
+	t.Run("publish failed", func(t *testing.T) {
+		conn.setOffline(true)
+		defer conn.setOffline(false)
+		_, err := c.SendRequest("/topic", "thing.test", nil, WithAck(false))
+		require.Error(t, err)
+	})
+}
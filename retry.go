@@ -0,0 +1,145 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+// 重试策略默认值
+const (
+	DefaultRetryMaxAttempts    = 3
+	DefaultRetryInitialBackoff = time.Millisecond * 200
+	DefaultRetryMaxBackoff     = time.Second * 5
+	DefaultRetryMultiplier     = 2
+	DefaultRetryJitter         = 0.2
+	DefaultRetryAttemptTimeout = time.Second * 3
+)
+
+// RetryPolicy Link*同步调用的重试策略
+type RetryPolicy struct {
+	// 最大尝试次数,含第一次调用, <= 1 表示不重试
+	MaxAttempts int
+	// 第一次重试前的退避时间
+	InitialBackoff time.Duration
+	// 最大退避时间
+	MaxBackoff time.Duration
+	// 退避时间的增长倍数
+	Multiplier float64
+	// 退避时间的随机抖动比例,取值[0,1]
+	Jitter float64
+	// 每次尝试等待回复的超时时间,0表示仅由调用者的超时控制,此时等待超时不会重试
+	AttemptTimeout time.Duration
+	// 判断错误是否可重试,为nil时使用 DefaultRetryable
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy 默认重试策略
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    DefaultRetryMaxAttempts,
+		InitialBackoff: DefaultRetryInitialBackoff,
+		MaxBackoff:     DefaultRetryMaxBackoff,
+		Multiplier:     DefaultRetryMultiplier,
+		Jitter:         DefaultRetryJitter,
+		AttemptTimeout: DefaultRetryAttemptTimeout,
+	}
+}
+
+// NoRetry 不重试的策略,用于需要快速失败的方法
+func NoRetry() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// DefaultRetryable 默认的可重试错误判断
+// 等待超时,平台限流及平台系统异常可重试,鉴权,参数等错误不重试
+func DefaultRetryable(err error) bool {
+	if errors.Is(err, ErrWaitTimeout) {
+		return true
+	}
+	var ce *infra.CodeError
+	if errors.As(err, &ce) {
+		switch ce.Code() {
+		case infra.CodeRequestTooMany,
+			infra.CodeDpScriptRequestTooMuch,
+			infra.CodeSystemUnknownException,
+			infra.CodeSystemException,
+			infra.CodeTimeout:
+			return true
+		}
+	}
+	return false
+}
+
+func (sf *RetryPolicy) retryable(err error) bool {
+	if sf.Retryable != nil {
+		return sf.Retryable(err)
+	}
+	return DefaultRetryable(err)
+}
+
+// backoff 第attempt次尝试失败后的退避时间, attempt从1开始
+func (sf *RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(sf.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= sf.Multiplier
+		if sf.MaxBackoff > 0 && d > float64(sf.MaxBackoff) {
+			d = float64(sf.MaxBackoff)
+			break
+		}
+	}
+	if sf.Jitter > 0 {
+		d += d * sf.Jitter * (rand.Float64()*2 - 1) // nolint: gosec
+	}
+	if d < 0 {
+		d = 0
+	}
+	return time.Duration(d)
+}
+
+// retryPolicy 获取方法的重试策略,优先使用方法的策略,其次使用全局策略,都没有返回nil
+func (sf *Client) retryPolicy(method string) *RetryPolicy {
+	if p, ok := sf.methodRetryPolicy[method]; ok {
+		return p
+	}
+	return sf.retryPolicyDefault
+}
+
+// doRetry 按method的重试策略执行fn,直到成功,不可重试,次数用完或ctx完成
+func (sf *Client) doRetry(ctx context.Context, method string, fn func(ctx context.Context) error) error {
+	policy := sf.retryPolicy(method)
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if policy == nil {
+			return fn(ctx)
+		}
+
+		actx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.AttemptTimeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, policy.AttemptTimeout)
+		}
+		err := fn(actx)
+		cancel()
+		if err == nil || ctx.Err() != nil || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return err
+		}
+		sf.StructuredLog().Debug("retry", "method", method, "attempt", attempt, "error", err)
+
+		tm := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			tm.Stop()
+			return err
+		case <-tm.C:
+		}
+	}
+}
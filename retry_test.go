@@ -0,0 +1,71 @@
+package aiot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+func TestDefaultRetryable(t *testing.T) {
+	require.True(t, DefaultRetryable(ErrWaitTimeout))
+	require.True(t, DefaultRetryable(infra.NewCodeError(infra.CodeRequestTooMany, "")))
+	require.False(t, DefaultRetryable(infra.NewCodeError(infra.CodeRequestParamsError, "")))
+	require.False(t, DefaultRetryable(infra.NewCodeError(infra.CodeTopoRequestAuthError, "")))
+	require.False(t, DefaultRetryable(ErrNotActive))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: time.Millisecond * 100,
+		MaxBackoff:     time.Millisecond * 300,
+		Multiplier:     2,
+	}
+	require.Equal(t, time.Millisecond*100, p.backoff(1))
+	require.Equal(t, time.Millisecond*200, p.backoff(2))
+	require.Equal(t, time.Millisecond*300, p.backoff(3))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.backoff(1)
+		require.True(t, d >= time.Millisecond*50 && d <= time.Millisecond*150)
+	}
+}
+
+func TestClientDoRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 1}
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, nil,
+		WithRetryPolicy(policy),
+		WithMethodRetryPolicy(infra.MethodTopoAdd, NoRetry()),
+	)
+
+	attempts := 0
+	err := c.doRetry(context.Background(), infra.MethodEventPropertyPost, func(context.Context) error {
+		attempts++
+		return ErrWaitTimeout
+	})
+	require.Equal(t, ErrWaitTimeout, err)
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = c.doRetry(context.Background(), infra.MethodEventPropertyPost, func(context.Context) error {
+		attempts++
+		if attempts < 2 {
+			return infra.NewCodeError(infra.CodeRequestTooMany, "")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, attempts)
+
+	attempts = 0
+	err = c.doRetry(context.Background(), infra.MethodTopoAdd, func(context.Context) error {
+		attempts++
+		return ErrWaitTimeout
+	})
+	require.Equal(t, ErrWaitTimeout, err)
+	require.Equal(t, 1, attempts)
+}
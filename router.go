@@ -0,0 +1,104 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+// Handler 下行请求或通知的处理函数
+// pk, dn: 消息所属设备, payload: 原始报文
+type Handler func(c *Client, pk, dn string, payload []byte) error
+
+// ReplyHandler 上行请求应答的处理函数
+// err: 平台应答的错误, pk, dn: 消息所属设备, payload: 原始报文
+type ReplyHandler func(c *Client, err error, pk, dn string, payload []byte) error
+
+// router 按Alink method路由下行消息,未注册的消息交由 Callback 或 GwCallback 处理
+type router struct {
+	mu            sync.RWMutex
+	handlers      map[string]Handler
+	replyHandlers map[string]ReplyHandler
+	services      map[string]serviceFunc    // 服务标识符 -> 类型化的服务处理函数
+	setters       map[string]PropertySetter // 属性标识符 -> 属性设置函数
+	userTopics    []*userTopic              // 自定义topic类,按声明顺序匹配
+}
+
+func newRouter() *router {
+	return &router{
+		handlers:      make(map[string]Handler),
+		replyHandlers: make(map[string]ReplyHandler),
+		services:      make(map[string]serviceFunc),
+		setters:       make(map[string]PropertySetter),
+	}
+}
+
+// Handle 注册下行请求或通知的处理函数, h为nil时取消注册
+// method: Alink方法, 如 infra.MethodConfigPush, infra.MethodTopoChange
+func (sf *Client) Handle(method string, h Handler) {
+	sf.router.mu.Lock()
+	defer sf.router.mu.Unlock()
+	if h == nil {
+		delete(sf.router.handlers, method)
+	} else {
+		sf.router.handlers[method] = h
+	}
+}
+
+// HandleService 注册服务调用的处理函数,需用户自行做回复
+// serviceID: 服务标识符, "property.set" 为设置属性
+func (sf *Client) HandleService(serviceID string, h Handler) {
+	sf.Handle(fmt.Sprintf(infra.MethodServiceFormat, serviceID), h)
+}
+
+// HandleReply 注册上行请求应答的处理函数, h为nil时取消注册
+// method: 请求的Alink方法, 如 infra.MethodConfigGet
+func (sf *Client) HandleReply(method string, h ReplyHandler) {
+	sf.router.mu.Lock()
+	defer sf.router.mu.Unlock()
+	if h == nil {
+		delete(sf.router.replyHandlers, method)
+	} else {
+		sf.router.replyHandlers[method] = h
+	}
+}
+
+// HandleEventReply 注册事件上报应答的处理函数
+// eventID: 事件标识符, "property" 为属性上报
+func (sf *Client) HandleEventReply(eventID string, h ReplyHandler) {
+	sf.HandleReply(fmt.Sprintf(infra.MethodEventFormatPost, eventID), h)
+}
+
+func (sf *Client) handler(method string) Handler {
+	sf.router.mu.RLock()
+	defer sf.router.mu.RUnlock()
+	return sf.router.handlers[method]
+}
+
+func (sf *Client) replyHandler(method string) ReplyHandler {
+	sf.router.mu.RLock()
+	defer sf.router.mu.RUnlock()
+	return sf.router.replyHandlers[method]
+}
+
+// replyNotSupported 未注册处理函数且未设置 Callback 的服务调用,回复请求错误,避免平台等待超时
+func (sf *Client) replyNotSupported(rawURI, method string, payload []byte) error {
+	req := &Request{}
+	if err := json.Unmarshal(payload, req); err != nil {
+		return err
+	}
+	_uri := uri.ReplyWithRequestURI(rawURI)
+	return sf.Response(_uri, Response{
+		ID:      req.ID,
+		Code:    infra.CodeRequestError,
+		Data:    "{}",
+		Message: method + " not supported",
+	})
+}
@@ -0,0 +1,77 @@
+package aiot
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+type serviceCb struct {
+	NopCb
+	services []string
+}
+
+func (sf *serviceCb) ThingServiceRequest(_ *Client, srvID, _, _ string, _ []byte) error {
+	sf.services = append(sf.services, srvID)
+	return nil
+}
+
+func TestRouterService(t *testing.T) {
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn)
+
+	var called []string
+	c.HandleService("reboot", func(c *Client, pk, dn string, payload []byte) error {
+		called = append(called, pk+"."+dn)
+		return nil
+	})
+	req := []byte(`{"id":"123","version":"1.0","params":{},"method":"thing.service.reboot"}`)
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/reboot", req))
+	require.Equal(t, []string{"pk.dn"}, called)
+	require.Empty(t, conn.messages())
+
+	// 未注册, 未设置Callback, 回复请求错误
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/upgrade", req))
+	msgs := conn.messages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, "/sys/pk/dn/thing/service/upgrade_reply", msgs[0].topic)
+	rsp := Response{}
+	require.NoError(t, json.Unmarshal(msgs[0].payload, &rsp))
+	require.Equal(t, uint(123), rsp.ID)
+	require.Equal(t, infra.CodeRequestError, rsp.Code)
+
+	// 取消注册后交由Callback处理
+	cb := &serviceCb{}
+	c = New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn, WithCallback(cb))
+	c.HandleService("reboot", func(*Client, string, string, []byte) error { return nil })
+	c.HandleService("reboot", nil)
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/reboot", req))
+	require.Equal(t, []string{"reboot"}, cb.services)
+}
+
+func TestRouterReply(t *testing.T) {
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, newMockConn())
+
+	var gotErr error
+	var eventID string
+	c.HandleEventReply("alarm", func(c *Client, err error, pk, dn string, payload []byte) error {
+		gotErr, eventID = err, "alarm"
+		return nil
+	})
+	rsp := []byte(`{"id":"1","code":460,"data":{},"message":"bad"}`)
+	require.NoError(t, ProcThingEventPostReply(c, "/sys/pk/dn/thing/event/alarm/post_reply", rsp))
+	require.Equal(t, "alarm", eventID)
+	require.Error(t, gotErr)
+
+	var method string
+	c.HandleReply(infra.MethodConfigGet, func(c *Client, err error, pk, dn string, payload []byte) error {
+		method = infra.MethodConfigGet
+		return err
+	})
+	rsp = []byte(`{"id":"2","code":200,"data":{}}`)
+	require.NoError(t, ProcThingConfigGetReply(c, "/sys/pk/dn/thing/config/get_reply", rsp))
+	require.Equal(t, infra.MethodConfigGet, method)
+}
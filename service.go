@@ -0,0 +1,130 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+// ServiceRequest 服务调用的请求信息
+type ServiceRequest struct {
+	ProductKey string
+	DeviceName string
+	ServiceID  string // 服务标识符
+	ID         uint   // 请求ID
+	MessageID  string // 同步服务(RRPC)的消息ID, 异步服务为空
+	ctx        context.Context
+}
+
+// IsSync 是否为同步服务(RRPC)调用
+func (sf ServiceRequest) IsSync() bool { return sf.MessageID != "" }
+
+// Context 请求的上下文, 使能链路追踪时包含下行span, 处理函数中上报数据时应使用该上下文
+func (sf ServiceRequest) Context() context.Context {
+	if sf.ctx == nil {
+		return context.Background()
+	}
+	return sf.ctx
+}
+
+// ServiceFunc 类型化的服务处理函数, in为请求的params域, 返回的Out为回复的data域
+// 返回 *infra.CodeError 时使用其code及message回复, 其它错误回复 infra.CodeRequestError
+type ServiceFunc[In, Out any] func(c *Client, req ServiceRequest, in In) (Out, error)
+
+// serviceFunc 类型擦除后的服务处理函数
+type serviceFunc func(c *Client, req ServiceRequest, params json.RawMessage) (interface{}, error)
+
+// errDecodeParams 请求的params域解码失败
+type errDecodeParams struct{ err error }
+
+func (sf errDecodeParams) Error() string { return "decode params: " + sf.err.Error() }
+
+// ServeService 注册服务的类型化处理函数, f为nil时取消注册.
+// 库将解码请求的params域为In, 调用f, 并将结果按请求的id回复:
+// 异步服务回复到 /sys/{productKey}/{deviceName}/thing/service/{tsl.service.identifier}_reply,
+// 同步服务(RRPC)回复到 /sys/{productKey}/{deviceName}/rrpc/response/{messageId}.
+// 设置了物模型时回复前校验服务的输出参数, 见 SetThingModel.
+// 优先于 HandleService 注册的处理函数及 Callback
+func ServeService[In, Out any](c *Client, serviceID string, f ServiceFunc[In, Out]) {
+	c.router.mu.Lock()
+	defer c.router.mu.Unlock()
+	if f == nil {
+		delete(c.router.services, serviceID)
+		return
+	}
+	c.router.services[serviceID] = func(c *Client, req ServiceRequest, params json.RawMessage) (interface{}, error) {
+		var in In
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &in); err != nil {
+				return nil, errDecodeParams{err}
+			}
+		}
+		return f(c, req, in)
+	}
+}
+
+func (sf *Client) service(serviceID string) serviceFunc {
+	sf.router.mu.RLock()
+	defer sf.router.mu.RUnlock()
+	return sf.router.services[serviceID]
+}
+
+// serve 解码请求,调用服务处理函数并回复
+func (sf *Client) serve(f serviceFunc, req ServiceRequest, payload []byte) error {
+	r := struct {
+		ID     uint            `json:"id,string"`
+		Params json.RawMessage `json:"params"`
+	}{}
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return err
+	}
+	req.ID = r.ID
+
+	out, err := f(sf, req, r.Params)
+	if err == nil {
+		if out == nil {
+			out = json.RawMessage("{}")
+		}
+		err = sf.validateServiceOutput(req.ProductKey, req.ServiceID, out)
+	}
+	rsp := Response{ID: req.ID, Code: infra.CodeSuccess, Data: out}
+	if err != nil {
+		rsp = serviceErrorResponse(req.ID, err)
+		sf.StructuredLog().Warn("service failed", "productKey", req.ProductKey, "deviceName", req.DeviceName,
+			"serviceID", req.ServiceID, "requestID", req.ID, "error", err)
+	}
+	if req.IsSync() {
+		return sf.RRPCResponse(req.ProductKey, req.DeviceName, req.MessageID, rsp)
+	}
+	return sf.ThingServiceResponse(req.ProductKey, req.DeviceName, req.ServiceID, rsp)
+}
+
+// serviceErrorResponse 服务处理失败的回复
+func serviceErrorResponse(id uint, err error) Response {
+	code, message := infra.CodeRequestError, err.Error()
+	var ce *infra.CodeError
+	var de errDecodeParams
+	switch {
+	case errors.As(err, &ce):
+		code, message = ce.Code(), ce.Message()
+	case errors.As(err, &de):
+		code = infra.CodeRequestParamsError
+	}
+	return Response{ID: id, Code: code, Data: "{}", Message: message}
+}
+
+// serviceIDFromMethod 从Alink方法 thing.service.{tsl.service.identifier} 中获取服务标识符
+func serviceIDFromMethod(method string) (string, bool) {
+	const prefix = "thing.service."
+	if !strings.HasPrefix(method, prefix) || method == infra.MethodServicePropertySet {
+		return "", false
+	}
+	return strings.TrimPrefix(method, prefix), true
+}
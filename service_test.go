@@ -0,0 +1,101 @@
+package aiot
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/tsl"
+)
+
+type rebootInput struct {
+	Delay int `json:"delay"`
+}
+
+type rebootOutput struct {
+	Result string `json:"result"`
+}
+
+func lastResponse(t *testing.T, conn *mockConn) (string, ResponseRawData) {
+	msgs := conn.messages()
+	require.NotEmpty(t, msgs)
+	msg := msgs[len(msgs)-1]
+	rsp := ResponseRawData{}
+	require.NoError(t, json.Unmarshal(msg.payload, &rsp))
+	return msg.topic, rsp
+}
+
+func TestServeService(t *testing.T) {
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn)
+
+	var got []ServiceRequest
+	ServeService(c, "reboot", func(c *Client, req ServiceRequest, in rebootInput) (rebootOutput, error) {
+		got = append(got, req)
+		switch in.Delay {
+		case 99:
+			return rebootOutput{}, infra.NewCodeError(infra.CodeRequestParamsError, "delay too long")
+		case 100:
+			return rebootOutput{Result: string(make([]byte, 200))}, nil
+		}
+		return rebootOutput{"ok"}, nil
+	})
+
+	// 异步服务
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/reboot",
+		[]byte(`{"id":"12","version":"1.0","params":{"delay":5},"method":"thing.service.reboot"}`)))
+	topic, rsp := lastResponse(t, conn)
+	require.Equal(t, "/sys/pk/dn/thing/service/reboot_reply", topic)
+	require.Equal(t, uint(12), rsp.ID)
+	require.Equal(t, infra.CodeSuccess, rsp.Code)
+	require.JSONEq(t, `{"result":"ok"}`, string(rsp.Data))
+	require.Equal(t, ServiceRequest{"pk", "dn", "reboot", 12, "", context.Background()}, got[0])
+
+	// 同步服务(RRPC)
+	require.NoError(t, ProcRRPCRequest(c, "/sys/pk/dn/rrpc/request/m1",
+		[]byte(`{"id":"13","version":"1.0","params":{"delay":1},"method":"thing.service.reboot"}`)))
+	topic, rsp = lastResponse(t, conn)
+	require.Equal(t, "/sys/pk/dn/rrpc/response/m1", topic)
+	require.Equal(t, uint(13), rsp.ID)
+	require.Equal(t, infra.CodeSuccess, rsp.Code)
+	require.True(t, got[1].IsSync())
+
+	// 处理函数返回code错误
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/reboot",
+		[]byte(`{"id":"14","params":{"delay":99},"method":"thing.service.reboot"}`)))
+	_, rsp = lastResponse(t, conn)
+	require.Equal(t, infra.CodeRequestParamsError, rsp.Code)
+	require.Equal(t, "delay too long", rsp.Message)
+
+	// params解码失败
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/reboot",
+		[]byte(`{"id":"15","params":{"delay":"x"},"method":"thing.service.reboot"}`)))
+	_, rsp = lastResponse(t, conn)
+	require.Equal(t, uint(15), rsp.ID)
+	require.Equal(t, infra.CodeRequestParamsError, rsp.Code)
+	require.Len(t, got, 3)
+
+	// 输出参数不符合物模型
+	thing, err := tsl.LoadFile("tsl/testdata/thing.json")
+	require.NoError(t, err)
+	c.SetThingModel("pk", thing)
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/reboot",
+		[]byte(`{"id":"16","params":{"delay":100},"method":"thing.service.reboot"}`)))
+	_, rsp = lastResponse(t, conn)
+	require.Equal(t, infra.CodeRequestError, rsp.Code)
+	require.Contains(t, rsp.Message, "reboot.result")
+
+	// 取消注册后交由 Callback 处理
+	ServeService[rebootInput, rebootOutput](c, "reboot", nil)
+	require.NoError(t, ProcThingServiceRequest(c, "/sys/pk/dn/thing/service/reboot",
+		[]byte(`{"id":"17","params":{"delay":1},"method":"thing.service.reboot"}`)))
+	_, rsp = lastResponse(t, conn)
+	require.Equal(t, "thing.service.reboot not supported", rsp.Message)
+	n := len(conn.messages())
+	require.NoError(t, ProcRRPCRequest(c, "/sys/pk/dn/rrpc/request/m2",
+		[]byte(`{"id":"18","params":{"delay":1},"method":"thing.service.reboot"}`)))
+	require.Len(t, conn.messages(), n)
+}
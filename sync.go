@@ -5,7 +5,8 @@
 package aiot
 
 import (
-	"strconv"
+	"context"
+	"sync"
 	"time"
 )
 
@@ -17,9 +18,19 @@ type Message struct {
 	err error
 }
 
+// Err 回复携带的错误
+func (sf Message) Err() error { return sf.err }
+
+// OrphanReply 未找到等待者的回复的处理函数
+// late为true表示回复到达时请求已超时或已取消,否则为未知ID的回复
+type OrphanReply func(c *Client, msg Message, late bool)
+
 // Token defines the interface for the tokens used to indicate when actions have completed.
 type Token struct {
+	id      uint
+	method  string
 	message chan Message
+	table   *pendingTable
 }
 
 // closedchan is a reusable closed channel.
@@ -31,37 +42,237 @@ func init() {
 
 // Wait the entry response,return ID,Data and error
 func (sf *Token) Wait(timeout time.Duration) (m Message, err error) {
-	tm := time.NewTimer(timeout)
-	defer tm.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return sf.WaitContext(ctx)
+}
+
+// WaitContext the entry response,return ID,Data and error
+// ctx超时返回 ErrWaitTimeout, ctx取消返回 context.Canceled,
+// 两者都会将对应的请求从缓存中移除,后续到达的回复将被丢弃.
+// 等待期间请求不会因缓存过期而被移除.
+func (sf *Token) WaitContext(ctx context.Context) (m Message, err error) {
+	if sf.table != nil {
+		sf.table.hold(sf.id)
+	}
 	select {
 	case m, ok := <-sf.message:
 		if ok {
 			return m, m.err
 		}
 		return m, ErrEntryClosed
-	case <-tm.C:
+	case <-ctx.Done():
+	}
+	err = ctx.Err()
+	if err == context.DeadlineExceeded {
+		err = ErrWaitTimeout
+		if sf.table != nil {
+			sf.table.metrics.IncTimeout(sf.method)
+		}
+	}
+	if sf.table != nil {
+		sf.table.cancel(sf.id, err)
+	}
+	return m, err
+}
+
+// Cancel 取消等待,将请求从缓存中移除,后续到达的回复将被丢弃
+func (sf *Token) Cancel() {
+	if sf.table != nil {
+		sf.table.cancel(sf.id, context.Canceled)
+	}
+}
+
+// pendingEntry 等待回复的请求
+type pendingEntry struct {
+	token    *Token
+	sentAt   time.Time
+	deadline time.Time
+	waiting  bool            // 有等待者时不会因过期而移除
+	end      func(err error) // 请求结束时调用,可为nil
+}
+
+// finish 请求结束
+func (sf *pendingEntry) finish(err error) {
+	if sf.end != nil {
+		sf.end(err)
+	}
+}
+
+// pendingTable 等待回复的请求表
+type pendingTable struct {
+	mu         sync.Mutex
+	entries    map[uint]*pendingEntry
+	closed     map[uint]time.Time // 已超时或已取消的请求ID,用于识别迟到的回复
+	expiration time.Duration
+	interval   time.Duration
+	timer      *time.Timer // 表不为空时每隔interval清理一次, 表为空时停止
+	metrics    Metrics
+}
+
+func newPendingTable(expiration, cleanupInterval time.Duration, metrics Metrics) *pendingTable {
+	if cleanupInterval <= 0 {
+		cleanupInterval = DefaultCacheCleanupInterval
+	}
+	return &pendingTable{
+		entries:    make(map[uint]*pendingEntry),
+		closed:     make(map[uint]time.Time),
+		expiration: expiration,
+		interval:   cleanupInterval,
+		metrics:    metrics,
+	}
+}
+
+// put 插入一个请求,无等待者时将在expiration后过期
+// end: 请求收到回复,超时,取消或过期时调用,可为nil
+func (sf *pendingTable) put(id uint, method string, end func(err error)) *Token {
+	now := time.Now()
+	token := &Token{id, method, make(chan Message, 1), sf}
+
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.entries[id] = &pendingEntry{token, now, now.Add(sf.expiration), false, end}
+	delete(sf.closed, id)
+	sf.scheduleLocked()
+	return token
+}
+
+// hold 标记请求有等待者
+func (sf *pendingTable) hold(id uint) {
+	sf.mu.Lock()
+	if entry, ok := sf.entries[id]; ok {
+		entry.waiting = true
+	}
+	sf.mu.Unlock()
+}
+
+// cancel 移除请求,并记录为已关闭, err为请求结束的原因
+func (sf *pendingTable) cancel(id uint, err error) {
+	now := time.Now()
+	sf.mu.Lock()
+	entry, ok := sf.entries[id]
+	if ok {
+		delete(sf.entries, id)
+		sf.closed[id] = now.Add(sf.expiration)
+		sf.scheduleLocked()
 	}
-	return m, ErrWaitTimeout
+	sf.mu.Unlock()
+	if ok {
+		entry.finish(err)
+	}
+}
+
+// signal 通知请求收到回复, 未找到请求时返回false, late表示请求是否已超时或已取消
+func (sf *pendingTable) signal(msg Message) (found, late bool) {
+	sf.mu.Lock()
+	entry, ok := sf.entries[msg.ID]
+	if ok {
+		delete(sf.entries, msg.ID)
+	} else {
+		_, late = sf.closed[msg.ID]
+		delete(sf.closed, msg.ID)
+	}
+	sf.mu.Unlock()
+
+	if !ok {
+		return false, late
+	}
+	sf.metrics.IncReply(entry.token.method, replyCode(msg.err))
+	sf.metrics.ObserveLatency(entry.token.method, time.Since(entry.sentAt))
+	entry.finish(msg.err)
+	select {
+	case entry.token.message <- msg:
+	default:
+	}
+	return true, false
+}
+
+// len 等待回复的请求数
+func (sf *pendingTable) len() int {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return len(sf.entries)
+}
+
+// scheduleLocked 未启动清理定时器时启动
+func (sf *pendingTable) scheduleLocked() {
+	if sf.timer == nil {
+		sf.timer = time.AfterFunc(sf.interval, sf.tick)
+	}
+}
+
+// tick 定时清理, 表不为空时继续下一次清理
+func (sf *pendingTable) tick() {
+	sf.cleanup(time.Now())
+	sf.mu.Lock()
+	if len(sf.entries) > 0 || len(sf.closed) > 0 {
+		sf.timer.Reset(sf.interval)
+	} else {
+		sf.timer = nil
+	}
+	sf.mu.Unlock()
 }
 
-// putPending 缓存插入指定ID3
-func (sf *Client) putPending(id uint) *Token {
+// cleanup 清理无等待者且已过期的请求及过期的关闭记录, 释放锁后结束过期的请求
+func (sf *pendingTable) cleanup(now time.Time) {
+	var expired []*pendingEntry
+	sf.mu.Lock()
+	for id, entry := range sf.entries {
+		if !entry.waiting && now.After(entry.deadline) {
+			delete(sf.entries, id)
+			sf.closed[id] = now.Add(sf.expiration)
+			expired = append(expired, entry)
+		}
+	}
+	for id, deadline := range sf.closed {
+		if now.After(deadline) {
+			delete(sf.closed, id)
+		}
+	}
+	sf.mu.Unlock()
+	for _, entry := range expired {
+		entry.finish(ErrWaitTimeout)
+	}
+}
+
+// putPending 缓存插入指定ID
+func (sf *Client) putPending(id uint, method string) *Token {
+	return sf.putPendingWithEnd(id, method, nil)
+}
+
+// putPendingWithEnd 缓存插入指定ID, end在请求结束时调用,可为nil
+func (sf *Client) putPendingWithEnd(id uint, method string, end func(err error)) *Token {
+	sf.metrics.IncRequest(method)
 	if sf.mode != ModeMQTT {
-		return &Token{closedchan}
+		if end != nil {
+			end(nil)
+		}
+		return &Token{id, method, closedchan, nil}
 	}
-	entry := &Token{make(chan Message, 1)}
-	sf.msgCache.SetDefault(strconv.FormatUint(uint64(id), 10), entry)
-	return entry
+	return sf.pending.put(id, method, end)
 }
 
 // signalPending 指定缓存id收到回复,并发出同步通知
+// 未找到等待者时,交由 OrphanReply 处理
 func (sf *Client) signalPending(msg Message) {
-	key := strconv.FormatUint(uint64(msg.ID), 10)
-	if v, ok := sf.msgCache.Get(key); ok {
-		sf.msgCache.Delete(key)
-		select {
-		case v.(*Token).message <- msg:
-		default:
+	if sf.pending == nil {
+		return
+	}
+	found, late := sf.pending.signal(msg)
+	if !found {
+		if late {
+			sf.StructuredLog().Debug("late reply", "requestID", msg.ID)
+		}
+		if sf.orphanReply != nil {
+			sf.orphanReply(sf, msg, late)
 		}
 	}
 }
+
+// PendingLen 等待回复的请求数
+func (sf *Client) PendingLen() int {
+	if sf.pending == nil {
+		return 0
+	}
+	return sf.pending.len()
+}
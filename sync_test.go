@@ -0,0 +1,89 @@
+package aiot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+func TestTokenWaitContext(t *testing.T) {
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, nil)
+
+	t.Run("reply", func(t *testing.T) {
+		token := c.putPending(1, infra.MethodEventPropertyPost)
+		require.Equal(t, 1, c.PendingLen())
+		c.signalPending(Message{ID: 1, Data: "data"})
+		msg, err := token.WaitContext(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "data", msg.Data)
+		require.Equal(t, 0, c.PendingLen())
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		token := c.putPending(2, infra.MethodEventPropertyPost)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := token.WaitContext(ctx)
+		require.Equal(t, context.Canceled, err)
+		require.Equal(t, 0, c.PendingLen())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		token := c.putPending(3, infra.MethodEventPropertyPost)
+		_, err := token.Wait(time.Millisecond)
+		require.Equal(t, ErrWaitTimeout, err)
+		require.Equal(t, 0, c.PendingLen())
+	})
+}
+
+func TestPendingOrphanReply(t *testing.T) {
+	var gotID uint
+	var gotLate bool
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, nil,
+		WithOrphanReply(func(_ *Client, msg Message, late bool) {
+			gotID, gotLate = msg.ID, late
+		}))
+
+	token := c.putPending(10, infra.MethodEventPropertyPost)
+	token.Cancel()
+	c.signalPending(Message{ID: 10})
+	require.Equal(t, uint(10), gotID)
+	require.True(t, gotLate)
+
+	c.signalPending(Message{ID: 11})
+	require.Equal(t, uint(11), gotID)
+	require.False(t, gotLate)
+}
+
+func TestPendingExpiration(t *testing.T) {
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, nil,
+		WithCache(time.Millisecond, time.Millisecond))
+
+	waited := c.putPending(1, infra.MethodEventPropertyPost)
+	c.pending.hold(waited.id)
+	var ended error
+	endCh := make(chan struct{})
+	c.putPendingWithEnd(2, infra.MethodEventPropertyPost, func(err error) {
+		// 在锁外结束, 可访问请求表
+		_ = c.PendingLen()
+		ended = err
+		close(endCh)
+	})
+	// 定时清理, 无等待者的2被清理, 有等待者的1保留
+	select {
+	case <-endCh:
+	case <-time.After(time.Second):
+		t.Fatal("pending entry not expired")
+	}
+	require.Equal(t, ErrWaitTimeout, ended)
+	require.Equal(t, 1, c.PendingLen())
+
+	c.signalPending(Message{ID: 1})
+	_, err := waited.Wait(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, 0, c.PendingLen())
+}
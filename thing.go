@@ -18,6 +18,8 @@ const (
 )
 
 // Callback 事件回调接口
+// 推荐使用 Client.Handle, Client.HandleService, Client.HandleReply 按方法注册处理函数,
+// Callback 仅处理未注册处理函数的消息
 type Callback interface {
 	// 透传应答
 	ThingModelUpRawReply(c *Client, productKey, deviceName string, payload []byte) error
@@ -51,7 +53,7 @@ type Callback interface {
 	ThingDialPostReply(c *Client, err error, productKey, deviceName string) error
 
 	// service
-	// 设置设备属性, 需用户自行做回复
+	// 设置设备属性, 需用户自行做回复. 使用 HandlePropertySet 注册了属性设置函数时不调用
 	ThingServicePropertySet(c *Client, productKey, deviceName string, payload []byte) error
 	// 设备服务调用,需用户自行做回复
 	ThingServiceRequest(c *Client, srvID, productKey, deviceName string, payload []byte) error
@@ -68,7 +70,7 @@ type Callback interface {
 	ThingOtaFirmwareGetReply(c *Client, productKey, deviceName string, data OtaFirmwareData) error
 }
 
-// GwCallback 网关事件接口
+// GwCallback 网关事件接口, 同 Callback 仅处理未注册处理函数的消息
 type GwCallback interface {
 	// 520错误已做自动登陆回复
 	ExtErrorResponse(c *Client, err error, productKey, deviceName string) error
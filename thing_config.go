@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/things-go/aliyun-iot/infra"
@@ -49,11 +50,16 @@ type ConfigPushRequest struct {
 // request:  /sys/{productKey}/{deviceName}/thing/config/get
 // response: /sys/{productKey}/{deviceName}/thing/config/get_reply
 func (sf *Client) ThingConfigGet(pk, dn string) (*Token, error) {
+	return sf.thingConfigGet(context.Background(), pk, dn)
+}
+
+// thingConfigGet 同 ThingConfigGet, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingConfigGet(ctx context.Context, pk, dn string) (*Token, error) {
 	if !sf.IsActive(pk, dn) {
 		return nil, ErrNotActive
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingConfigGet, pk, dn)
-	return sf.SendRequest(_uri, infra.MethodConfigGet, ConfigGetParams{
+	return sf.sendRequest(ctx, _uri, infra.MethodConfigGet, ConfigGetParams{
 		"product",
 		"file",
 	})
@@ -81,7 +87,10 @@ func ProcThingConfigGetReply(c *Client, rawURI string, payload []byte) error {
 	}
 	c.signalPending(Message{rsp.ID, rsp.Data, err})
 	pk, dn := uris[1], uris[2]
-	c.Log.Debugf("thing.config.get.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.config.get.reply", "requestID", rsp.ID, "topic", rawURI)
+	if h := c.replyHandler(infra.MethodConfigGet); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingConfigGetReply(c, err, pk, dn, rsp.Data)
 }
 
@@ -91,7 +100,7 @@ func ProcThingConfigGetReply(c *Client, rawURI string, payload []byte) error {
 // response:  /sys/{productKey}/{deviceName}/thing/config/push_reply
 // subscribe: /sys/{productKey}/{deviceName}/thing/config/push
 func ProcThingConfigPush(c *Client, rawURI string, payload []byte) error {
-	c.Log.Debugf("thing.config.push")
+	c.StructuredLog().Debug("thing.config.push")
 	uris := uri.Spilt(rawURI)
 	if len(uris) < 6 {
 		return ErrInvalidURI
@@ -103,8 +112,11 @@ func ProcThingConfigPush(c *Client, rawURI string, payload []byte) error {
 	_uri := uri.ReplyWithRequestURI(rawURI)
 	err := c.Response(_uri, Response{ID: req.ID, Code: infra.CodeSuccess, Data: "{}"})
 	if err != nil {
-		c.Log.Errorf("thing.config.push.reply %+v", err)
+		c.StructuredLog().Error("thing.config.push.reply", "error", err)
 	}
 	pk, dn := uris[1], uris[2]
+	if h := c.handler(infra.MethodConfigPush); h != nil {
+		return h(c, pk, dn, payload)
+	}
 	return c.cb.ThingConfigPush(c, pk, dn, req.Params)
 }
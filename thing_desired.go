@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/things-go/aliyun-iot/infra"
@@ -17,6 +18,11 @@ import (
 // request:  /sys/{productKey}/{deviceName}/thing/property/desired/get
 // response: /sys/{productKey}/{deviceName}/thing/property/desired/get_reply
 func (sf *Client) ThingDesiredPropertyGet(pk, dn string, params []string) (*Token, error) {
+	return sf.thingDesiredPropertyGet(context.Background(), pk, dn, params)
+}
+
+// thingDesiredPropertyGet 同 ThingDesiredPropertyGet, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingDesiredPropertyGet(ctx context.Context, pk, dn string, params []string) (*Token, error) {
 	if !sf.hasDesired {
 		return nil, ErrNotSupportFeature
 	}
@@ -24,13 +30,18 @@ func (sf *Client) ThingDesiredPropertyGet(pk, dn string, params []string) (*Toke
 		return nil, ErrNotActive
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingDesiredPropertyGet, pk, dn)
-	return sf.SendRequest(_uri, infra.MethodDesiredPropertyGet, params)
+	return sf.sendRequest(ctx, _uri, infra.MethodDesiredPropertyGet, params)
 }
 
-// ThingDesiredPropertyDelete 清空期望属性值
+// ThingDesiredPropertyDelete 清空期望属性值, 收到成功的回复后从设备影子中删除期望值
 // request:  /sys/{productKey}/{deviceName}/thing/property/desired/delete
 // response: /sys/{productKey}/{deviceName}/thing/property/desired/delete_reply
 func (sf *Client) ThingDesiredPropertyDelete(pk, dn string, params interface{}) (*Token, error) {
+	return sf.thingDesiredPropertyDelete(context.Background(), pk, dn, params)
+}
+
+// thingDesiredPropertyDelete 同 ThingDesiredPropertyDelete, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingDesiredPropertyDelete(ctx context.Context, pk, dn string, params interface{}) (*Token, error) {
 	if !sf.hasDesired {
 		return nil, ErrNotSupportFeature
 	}
@@ -38,7 +49,11 @@ func (sf *Client) ThingDesiredPropertyDelete(pk, dn string, params interface{})
 		return nil, ErrNotActive
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingDesiredPropertyDelete, pk, dn)
-	return sf.SendRequest(_uri, infra.MethodDesiredPropertyDelete, params)
+	return sf.sendRequest(ctx, _uri, infra.MethodDesiredPropertyDelete, params, withEnd(func(err error) {
+		if err == nil {
+			sf.recordDesiredDeleted(pk, dn, params)
+		}
+	}))
 }
 
 // ProcThingDesiredPropertyGetReply 处理获取期望属性值的应答
@@ -63,9 +78,15 @@ func ProcThingDesiredPropertyGetReply(c *Client, rawURI string, payload []byte)
 
 	c.signalPending(Message{rsp.ID, dupJSONRawMessage(rsp.Data), err})
 
-	c.Log.Debugf("thing.property.desired.get.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.property.desired.get.reply", "requestID", rsp.ID, "topic", rawURI)
 
 	pk, dn := uris[1], uris[2]
+	if err == nil {
+		c.recordDesired(pk, dn, rsp.Data)
+	}
+	if h := c.replyHandler(infra.MethodDesiredPropertyGet); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingDesiredPropertyGetReply(c, err, pk, dn, rsp.Data)
 }
 
@@ -88,8 +109,11 @@ func ProcThingDesiredPropertyDeleteReply(c *Client, rawURI string, payload []byt
 	}
 	c.signalPending(Message{rsp.ID, nil, err})
 
-	c.Log.Debugf("thing.property.desired.delete.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.property.desired.delete.reply", "requestID", rsp.ID, "topic", rawURI)
 
 	pk, dn := uris[1], uris[2]
+	if h := c.replyHandler(infra.MethodDesiredPropertyDelete); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingDesiredPropertyDeleteReply(c, err, pk, dn)
 }
@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/things-go/aliyun-iot/infra"
@@ -53,7 +54,7 @@ type DiagRequest struct {
 	Params  DiagParam `json:"params"`
 }
 
-func (sf *Client) thingDiagPost(pk, dn string, p interface{}, isNow bool) (*Token, error) {
+func (sf *Client) thingDiagPost(ctx context.Context, pk, dn string, p interface{}, isNow bool) (*Token, error) {
 	var model string
 
 	if !sf.hasDiag {
@@ -69,39 +70,41 @@ func (sf *Client) thingDiagPost(pk, dn string, p interface{}, isNow bool) (*Toke
 		model = "format=simple|quantity=batch|time=history"
 	}
 
-	id := sf.nextRequestID()
-	out, err := json.Marshal(&DiagRequest{
-		id,
-		sf.version,
-		DiagParam{
-			p,
-			model,
-		}})
-	if err != nil {
-		return nil, err
-	}
-
-	sf.Log.Debugf("thing.diag.post @%d", id)
 	_uri := uri.URI(uri.SysPrefix, uri.ThingDiagPost, pk, dn)
-	if err = sf.Publish(_uri, 1, out); err != nil {
-		return nil, err
-	}
-	return sf.putPending(id), nil
+	// 请求中不带method
+	return sf.send(ctx, _uri, infra.MethodDiagPost, newRequestOptions(), func(id uint) error {
+		out, err := json.Marshal(&DiagRequest{
+			id,
+			sf.version,
+			DiagParam{
+				p,
+				model,
+			}})
+		if err != nil {
+			return err
+		}
+		return sf.Publish(_uri, 1, out)
+	})
 }
 
 // ThingDiagPost 设备主动上报当前网络状态
 // request:  /sys/{productKey}/{deviceName}/_thing/diag/post
 // response: /sys/{productKey}/{deviceName}/_thing/diag/post_reply
 func (sf *Client) ThingDiagPost(pk, dn string, p P) (*Token, error) {
-	return sf.thingDiagPost(pk, dn, p, true)
+	return sf.thingDiagPost(context.Background(), pk, dn, p, true)
 }
 
 // ThingDiagHistoryPost 设备主动上报历史网络状态
 func (sf *Client) ThingDiagHistoryPost(pk, dn string, ps []P) (*Token, error) {
+	return sf.thingDiagHistoryPost(context.Background(), pk, dn, ps)
+}
+
+// thingDiagHistoryPost 同 ThingDiagHistoryPost, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingDiagHistoryPost(ctx context.Context, pk, dn string, ps []P) (*Token, error) {
 	if len(ps) == 0 {
 		return nil, ErrInvalidParameter
 	}
-	return sf.thingDiagPost(pk, dn, ps, false)
+	return sf.thingDiagPost(ctx, pk, dn, ps, false)
 }
 
 // ProcThingDialPostReply 处理设备主动上报网络状态回复
@@ -124,7 +127,10 @@ func ProcThingDialPostReply(c *Client, rawURI string, payload []byte) error {
 	}
 
 	c.signalPending(Message{rsp.ID, nil, err})
-	c.Log.Debugf("thing.diag.post.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.diag.post.reply", "requestID", rsp.ID, "topic", rawURI)
 	pk, dn := uris[1], uris[2]
+	if h := c.replyHandler(infra.MethodDiagPost); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingDialPostReply(c, err, pk, dn)
 }
@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -15,29 +16,48 @@ import (
 // @see https://help.aliyun.com/document_detail/89301.html?spm=a2c4g.11186623.6.706.78b524baCoL1Gf
 
 // ThingEventPropertyPost 设备上报属性数据
+// 设置了物模型时发送前校验参数,见 SetThingModel
+// 设置了离线队列时,设备不在线或发送失败将存入离线队列,并返回 ErrOfflineQueued
+// 发送或存入离线队列成功后记录到设备影子,见 Twin
 // request:  /sys/{productKey}/{deviceName}/thing/event/property/post
 // response: /sys/{productKey}/{deviceName}/thing/event/property/post_reply
-func (sf *Client) ThingEventPropertyPost(pk, dn string, params interface{}) (*Token, error) {
-	if sf.hasRawModel {
+func (sf *Client) ThingEventPropertyPost(pk, dn string, params interface{}, opts ...RequestOption) (*Token, error) {
+	return sf.thingEventPropertyPost(context.Background(), pk, dn, params, opts...)
+}
+
+// thingEventPropertyPost 同 ThingEventPropertyPost, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingEventPropertyPost(ctx context.Context, pk, dn string, params interface{}, opts ...RequestOption) (*Token, error) {
+	if sf.hasRawModel && sf.rawCodec(pk) == nil {
 		return nil, ErrNotSupportFeature
 	}
-	if !sf.IsActive(pk, dn) {
-		return nil, ErrNotActive
+	if err := sf.validateProperties(pk, params); err != nil {
+		return nil, err
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingEventPropertyPost, pk, dn)
-	return sf.SendRequest(_uri, infra.MethodEventPropertyPost, params)
+	token, err := sf.sendRequestOrStore(ctx, pk, dn, _uri, infra.MethodEventPropertyPost, params, opts...)
+	if err == nil || err == ErrOfflineQueued {
+		sf.recordReported(pk, dn, params)
+	}
+	return token, err
 }
 
 // ThingEventPost 设备事件上报
+// 设置了物模型时发送前校验参数,见 SetThingModel
+// 设置了离线队列时,设备不在线或发送失败将存入离线队列,并返回 ErrOfflineQueued
 // request:  /sys/{productKey}/{deviceName}/thing/event/{tsl.event.identifier}/post
 // response: /sys/{productKey}/{deviceName}/thing/event/{tsl.event.identifier}/post_reply
-func (sf *Client) ThingEventPost(pk, dn, eventID string, params interface{}) (*Token, error) {
-	if !sf.IsActive(pk, dn) {
-		return nil, ErrNotActive
+func (sf *Client) ThingEventPost(pk, dn, eventID string, params interface{}, opts ...RequestOption) (*Token, error) {
+	return sf.thingEventPost(context.Background(), pk, dn, eventID, params, opts...)
+}
+
+// thingEventPost 同 ThingEventPost, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingEventPost(ctx context.Context, pk, dn, eventID string, params interface{}, opts ...RequestOption) (*Token, error) {
+	if err := sf.validateEvent(pk, eventID, params); err != nil {
+		return nil, err
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingEventPost, pk, dn, eventID)
 	method := fmt.Sprintf(infra.MethodEventFormatPost, eventID)
-	return sf.SendRequest(_uri, method, params)
+	return sf.sendRequestOrStore(ctx, pk, dn, _uri, method, params, opts...)
 }
 
 // ThingEventPropertyPackPost 网关批量上报数据
@@ -45,6 +65,11 @@ func (sf *Client) ThingEventPost(pk, dn, eventID string, params interface{}) (*T
 // request:  /sys/{productKey}/{deviceName}/thing/event/property/pack/post
 // response: /sys/{productKey}/{deviceName}/thing/event/property/pack/post_reply
 func (sf *Client) ThingEventPropertyPackPost(params interface{}) (*Token, error) {
+	return sf.thingEventPropertyPackPost(context.Background(), params)
+}
+
+// thingEventPropertyPackPost 同 ThingEventPropertyPackPost, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingEventPropertyPackPost(ctx context.Context, params interface{}) (*Token, error) {
 	if !sf.isGateway {
 		return nil, ErrNotSupportFeature
 	}
@@ -52,7 +77,7 @@ func (sf *Client) ThingEventPropertyPackPost(params interface{}) (*Token, error)
 		return nil, ErrNotActive
 	}
 	_uri := sf.URIGateway(uri.SysPrefix, uri.ThingEventPropertyPackPost)
-	return sf.SendRequest(_uri, infra.MethodEventPropertyPackPost, params)
+	return sf.sendRequest(ctx, _uri, infra.MethodEventPropertyPackPost, params)
 }
 
 // ThingEventPropertyHistoryPost  物模型历史数据上报
@@ -60,11 +85,38 @@ func (sf *Client) ThingEventPropertyPackPost(params interface{}) (*Token, error)
 // request： /sys/{productKey}/{deviceName}/thing/event/property/history/post
 // response：/sys/{productKey}/{deviceName}/thing/event/property/history/post_reply
 func (sf *Client) ThingEventPropertyHistoryPost(params interface{}) (*Token, error) {
+	return sf.thingEventPropertyHistoryPost(context.Background(), params)
+}
+
+// thingEventPropertyHistoryPost 同 ThingEventPropertyHistoryPost, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingEventPropertyHistoryPost(ctx context.Context, params interface{}) (*Token, error) {
 	if !sf.IsActive(sf.tetrad.ProductKey, sf.tetrad.DeviceName) {
 		return nil, ErrNotActive
 	}
 	_uri := sf.URIGateway(uri.SysPrefix, uri.ThingEventPropertyHistoryPost)
-	return sf.SendRequest(_uri, infra.MethodEventPropertyHistoryPost, params)
+	return sf.sendRequest(ctx, _uri, infra.MethodEventPropertyHistoryPost, params)
+}
+
+// ThingEventPropertyHistoryPostBatch 物模型历史数据上报, 按单次上报的限制拆分为多次上报, 见 WithHistoryLimit
+// 设置了物模型时发送前校验属性值及事件参数,见 SetThingModel
+// 返回已发送的各次上报的Token, 发送失败时返回已发送的Token及错误
+func (sf *Client) ThingEventPropertyHistoryPostBatch(h *PropertyHistory) ([]*Token, error) {
+	if err := sf.validateHistory(h); err != nil {
+		return nil, err
+	}
+	batches, err := h.Build(sf.historyLimit)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*Token, 0, len(batches))
+	for _, params := range batches {
+		token, err := sf.ThingEventPropertyHistoryPost(params)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
 }
 
 // ProcThingEventPostReply 处理ThingEvent XXX上行的应答
@@ -91,7 +143,10 @@ func ProcThingEventPostReply(c *Client, rawURI string, payload []byte) error {
 
 	pk, dn := uris[1], uris[2]
 	eventID := uris[5]
-	c.Log.Debugf("thing.event.%s.post.reply @%d", eventID, rsp.ID)
+	c.StructuredLog().Debug("thing.event.post.reply", "eventID", eventID, "requestID", rsp.ID, "topic", rawURI)
+	if h := c.replyHandler(fmt.Sprintf(infra.MethodEventFormatPost, eventID)); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	if eventID == property {
 		return c.cb.ThingEventPropertyPostReply(c, err, pk, dn)
 	}
@@ -119,7 +174,10 @@ func ProcThingEventPropertyPackPostReply(c *Client, rawURI string, payload []byt
 
 	c.signalPending(Message{rsp.ID, nil, err})
 	pk, dn := uris[1], uris[2]
-	c.Log.Debugf("thing.event.property.pack.post.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.event.property.pack.post.reply", "requestID", rsp.ID, "topic", rawURI)
+	if h := c.replyHandler(infra.MethodEventPropertyPackPost); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingEventPropertyPackPostReply(c, err, pk, dn)
 }
 
@@ -143,6 +201,9 @@ func ProcThingEventPropertyHistoryPostReply(c *Client, rawURI string, payload []
 
 	c.signalPending(Message{rsp.ID, nil, err})
 	pk, dn := uris[1], uris[2]
-	c.Log.Debugf("thing.event.property.history.post.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.event.property.history.post.reply", "requestID", rsp.ID, "topic", rawURI)
+	if h := c.replyHandler(infra.MethodEventPropertyHistoryPost); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingEventPropertyHistoryPostReply(c, err, pk, dn)
 }
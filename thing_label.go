@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/things-go/aliyun-iot/infra"
@@ -26,6 +27,11 @@ type DeviceInfoLabel struct {
 // request:  /sys/{productKey}/{deviceName}/thing/deviceinfo/update
 // response: /sys/{productKey}/{deviceName}/thing/deviceinfo/update_reply
 func (sf *Client) ThingDeviceInfoUpdate(pk, dn string, params []DeviceInfoLabel) (*Token, error) {
+	return sf.thingDeviceInfoUpdate(context.Background(), pk, dn, params)
+}
+
+// thingDeviceInfoUpdate 同 ThingDeviceInfoUpdate, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingDeviceInfoUpdate(ctx context.Context, pk, dn string, params []DeviceInfoLabel) (*Token, error) {
 	if len(params) == 0 {
 		return nil, ErrInvalidParameter
 	}
@@ -33,7 +39,7 @@ func (sf *Client) ThingDeviceInfoUpdate(pk, dn string, params []DeviceInfoLabel)
 		return nil, ErrNotActive
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingDeviceInfoUpdate, pk, dn)
-	return sf.SendRequest(_uri, infra.MethodDeviceInfoUpdate, params)
+	return sf.sendRequest(ctx, _uri, infra.MethodDeviceInfoUpdate, params)
 }
 
 // DeviceLabelKey 删除设备标答的键
@@ -45,6 +51,11 @@ type DeviceLabelKey struct {
 // request:  /sys/{productKey}/{deviceName}/thing/deviceinfo/delete
 // response: /sys/{productKey}/{deviceName}/thing/deviceinfo/delete_reply
 func (sf *Client) ThingDeviceInfoDelete(pk, dn string, params []DeviceLabelKey) (*Token, error) {
+	return sf.thingDeviceInfoDelete(context.Background(), pk, dn, params)
+}
+
+// thingDeviceInfoDelete 同 ThingDeviceInfoDelete, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingDeviceInfoDelete(ctx context.Context, pk, dn string, params []DeviceLabelKey) (*Token, error) {
 	if len(params) == 0 {
 		return nil, ErrInvalidParameter
 	}
@@ -52,7 +63,7 @@ func (sf *Client) ThingDeviceInfoDelete(pk, dn string, params []DeviceLabelKey)
 		return nil, ErrNotActive
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingDeviceInfoDelete, pk, dn)
-	return sf.SendRequest(_uri, infra.MethodDeviceInfoDelete, params)
+	return sf.sendRequest(ctx, _uri, infra.MethodDeviceInfoDelete, params)
 }
 
 // ProcThingDeviceInfoUpdateReply 处理设备信息更新应答
@@ -71,13 +82,16 @@ func ProcThingDeviceInfoUpdateReply(c *Client, rawURI string, payload []byte) er
 		return err
 	}
 
-	c.Log.Debugf("thing.deviceinfo.update.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.deviceinfo.update.reply", "requestID", rsp.ID, "topic", rawURI)
 	if rsp.Code != infra.CodeSuccess {
 		err = infra.NewCodeError(rsp.Code, rsp.Message)
 	}
 
 	c.signalPending(Message{rsp.ID, nil, err})
 	pk, dn := uris[1], uris[2]
+	if h := c.replyHandler(infra.MethodDeviceInfoUpdate); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingDeviceInfoUpdateReply(c, err, pk, dn)
 }
 
@@ -102,6 +116,9 @@ func ProcThingDeviceInfoDeleteReply(c *Client, rawURI string, payload []byte) er
 	}
 	c.signalPending(Message{rsp.ID, nil, err})
 	pk, dn := uris[1], uris[2]
-	c.Log.Debugf("thing.deviceinfo.delete.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.deviceinfo.delete.reply", "requestID", rsp.ID, "topic", rawURI)
+	if h := c.replyHandler(infra.MethodDeviceInfoDelete); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingDeviceInfoDeleteReply(c, err, pk, dn)
 }
@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/things-go/aliyun-iot/infra"
@@ -35,11 +36,16 @@ type ConfigLogParam struct {
 // request： /sys/${productKey}/${deviceName}/thing/config/Log/get
 // response：/sys/${productKey}/${deviceName}/thing/config/Log/get_reply
 func (sf *Client) ThingConfigLogGet(pk, dn string, _ ConfigLogParam) (*Token, error) {
+	return sf.thingConfigLogGet(context.Background(), pk, dn, ConfigLogParam{})
+}
+
+// thingConfigLogGet 同 ThingConfigLogGet, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingConfigLogGet(ctx context.Context, pk, dn string, _ ConfigLogParam) (*Token, error) {
 	if !sf.IsActive(pk, dn) {
 		return nil, ErrNotActive
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingConfigLogGet, pk, dn)
-	return sf.SendRequest(_uri, infra.MethodConfigLogGet, ConfigLogParam{
+	return sf.sendRequest(ctx, _uri, infra.MethodConfigLogGet, ConfigLogParam{
 		"device",
 		"content",
 	})
@@ -67,17 +73,20 @@ type LogParam struct {
 }
 
 // ThingLogPost 设备上报日志内容
+// 设置了离线队列时,设备不在线或发送失败将存入离线队列,并返回 ErrOfflineQueued
 // request： /sys/${productKey}/${deviceName}/thing/config/Log/post
 // response：/sys/${productKey}/${deviceName}/thing/config/Log/post_reply
 func (sf *Client) ThingLogPost(pk, dn string, lp []LogParam) (*Token, error) {
-	if !sf.IsActive(pk, dn) {
-		return nil, ErrNotActive
-	}
+	return sf.thingLogPost(context.Background(), pk, dn, lp)
+}
+
+// thingLogPost 同 ThingLogPost, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingLogPost(ctx context.Context, pk, dn string, lp []LogParam) (*Token, error) {
 	if len(lp) == 0 {
 		return nil, ErrInvalidParameter
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingLogPost, pk, dn)
-	return sf.SendRequest(_uri, infra.MethodLogPost, lp)
+	return sf.sendRequestOrStore(ctx, pk, dn, _uri, infra.MethodLogPost, lp)
 }
 
 // ConfigLogMode 日志配置的日志上报模式
@@ -118,8 +127,11 @@ func ProcThingConfigLogGetReply(c *Client, rawURI string, payload []byte) error
 		err = infra.NewCodeError(rsp.Code, rsp.Message)
 	}
 	c.signalPending(Message{rsp.ID, rsp.Data, err})
-	c.Log.Debugf("thing.config.log.get.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.config.log.get.reply", "requestID", rsp.ID, "topic", rawURI)
 	pk, dn := uris[1], uris[2]
+	if h := c.replyHandler(infra.MethodConfigLogGet); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingConfigLogGetReply(c, err, pk, dn, rsp.Data)
 }
 
@@ -140,8 +152,11 @@ func ProcThingLogPostReply(c *Client, rawURI string, payload []byte) error {
 		err = infra.NewCodeError(rsp.Code, rsp.Message)
 	}
 	c.signalPending(Message{rsp.ID, nil, err})
-	c.Log.Debugf("thing.log.post.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.log.post.reply", "requestID", rsp.ID, "topic", rawURI)
 	pk, dn := uris[1], uris[2]
+	if h := c.replyHandler(infra.MethodLogPost); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingLogPostReply(c, err, pk, dn)
 }
 
@@ -166,7 +181,10 @@ func ProcThingConfigLogPush(c *Client, rawURI string, payload []byte) error {
 		return err
 	}
 
-	c.Log.Debugf("thing.config.log.push @%d", req.ID)
+	c.StructuredLog().Debug("thing.config.log.push", "requestID", req.ID, "topic", rawURI)
 	pk, dn := uris[1], uris[2]
+	if h := c.handler(infra.MethodConfigLogPush); h != nil {
+		return h(c, pk, dn, payload)
+	}
 	return c.cb.ThingConfigLogPush(c, pk, dn, req.Params)
 }
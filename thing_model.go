@@ -0,0 +1,155 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/tsl"
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+// thingModelKey 物模型按产品及自定义模块区分, 默认模块的functionBlockID为空
+type thingModelKey struct {
+	productKey      string
+	functionBlockID string
+}
+
+// thingModels 按productKey及自定义模块保存的物模型,用于上行数据的本地校验
+type thingModels struct {
+	mu sync.RWMutex
+	m  map[thingModelKey]*tsl.Thing
+}
+
+// SetThingModel 设置产品的物模型, 按物模型的 FunctionBlockID 区分默认模块及自定义模块,
+// thing为nil时移除该产品的所有物模型.
+// 设置后 ThingEventPropertyPost, ThingEventPost, ThingServiceResponse 发送前
+// 将使用物模型在本地校验参数, 自定义模块的标识符 {functionBlockId}:{identifier} 使用对应模块的物模型校验,
+// 校验失败返回 *tsl.ValidationError
+func (sf *Client) SetThingModel(pk string, thing *tsl.Thing) {
+	sf.thingModels.mu.Lock()
+	defer sf.thingModels.mu.Unlock()
+	if thing == nil {
+		for key := range sf.thingModels.m {
+			if key.productKey == pk {
+				delete(sf.thingModels.m, key)
+			}
+		}
+		return
+	}
+	if sf.thingModels.m == nil {
+		sf.thingModels.m = make(map[thingModelKey]*tsl.Thing)
+	}
+	sf.thingModels.m[thingModelKey{pk, thing.FunctionBlockID}] = thing
+}
+
+// ThingModel 获取产品默认模块的物模型
+func (sf *Client) ThingModel(pk string) (*tsl.Thing, bool) {
+	return sf.FunctionBlockModel(pk, "")
+}
+
+// FunctionBlockModel 获取产品自定义模块的物模型, functionBlockID为空时为默认模块
+func (sf *Client) FunctionBlockModel(pk, functionBlockID string) (*tsl.Thing, bool) {
+	sf.thingModels.mu.RLock()
+	defer sf.thingModels.mu.RUnlock()
+	thing, ok := sf.thingModels.m[thingModelKey{pk, functionBlockID}]
+	return thing, ok
+}
+
+// identifierModel 获取Alink协议中标识符所属模块的物模型
+func (sf *Client) identifierModel(pk, id string) (*tsl.Thing, bool) {
+	fb, _ := tsl.SplitIdentifier(id)
+	return sf.FunctionBlockModel(pk, fb)
+}
+
+// validateProperties 设置了物模型时校验属性上报参数, 属性按所属模块分别校验
+func (sf *Client) validateProperties(pk string, params interface{}) error {
+	sf.thingModels.mu.RLock()
+	n := len(sf.thingModels.m)
+	sf.thingModels.mu.RUnlock()
+	if n == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+	blocks := make(map[string]map[string]json.RawMessage)
+	for id, v := range values {
+		fb, _ := tsl.SplitIdentifier(id)
+		if blocks[fb] == nil {
+			blocks[fb] = make(map[string]json.RawMessage)
+		}
+		blocks[fb][id] = v
+	}
+	fbs := make([]string, 0, len(blocks))
+	for fb := range blocks {
+		fbs = append(fbs, fb)
+	}
+	sort.Strings(fbs)
+	for _, fb := range fbs {
+		if thing, ok := sf.FunctionBlockModel(pk, fb); ok {
+			if err = thing.ValidateProperties(blocks[fb]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateEvent 设置了物模型时校验事件上报参数
+func (sf *Client) validateEvent(pk, eventID string, params interface{}) error {
+	if thing, ok := sf.identifierModel(pk, eventID); ok {
+		return thing.ValidateEvent(eventID, params)
+	}
+	return nil
+}
+
+// validateHistory 设置了物模型时校验历史数据的属性值及事件参数
+func (sf *Client) validateHistory(h *PropertyHistory) error {
+	for _, dev := range h.devices {
+		for _, e := range dev.entries {
+			var err error
+			if e.event {
+				err = sf.validateEvent(dev.identity.ProductKey, e.identifier, e.value)
+			} else {
+				err = sf.validateProperties(dev.identity.ProductKey, map[string]interface{}{e.identifier: e.value})
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateServiceOutput 设置了物模型时校验服务的输出参数
+func (sf *Client) validateServiceOutput(pk, serviceID string, data interface{}) error {
+	if thing, ok := sf.identifierModel(pk, serviceID); ok {
+		return thing.ValidateServiceOutput(serviceID, data)
+	}
+	return nil
+}
+
+// ThingServiceResponse 回复服务调用,设置了物模型且回复成功时校验服务的输出参数
+// request:  /sys/{productKey}/{deviceName}/thing/service/{tsl.service.identifier}
+// response: /sys/{productKey}/{deviceName}/thing/service/{tsl.service.identifier}_reply
+func (sf *Client) ThingServiceResponse(pk, dn, serviceID string, rsp Response) error {
+	if rsp.Code == infra.CodeSuccess {
+		if err := sf.validateServiceOutput(pk, serviceID, rsp.Data); err != nil {
+			return err
+		}
+	}
+	_uri := uri.URI(uri.SysPrefix, uri.ThingServiceResponse, pk, dn, serviceID)
+	return sf.Response(_uri, rsp)
+}
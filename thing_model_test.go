@@ -0,0 +1,50 @@
+package aiot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/tsl"
+)
+
+func TestClientThingModel(t *testing.T) {
+	thing, err := tsl.LoadFile("tsl/testdata/thing.json")
+	require.NoError(t, err)
+	thing.Profile.ProductKey = ""
+
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn, WithThingModel(thing))
+	_, ok := c.ThingModel("pk")
+	require.True(t, ok)
+
+	var verr *tsl.ValidationError
+	_, err = c.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temperature": 200})
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, "temperature", verr.Identifier)
+	_, err = c.ThingEventPost("pk", "dn", "overheat", map[string]interface{}{"value": "hot"})
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, "overheat.value", verr.Identifier)
+	err = c.ThingServiceResponse("pk", "dn", "reboot", Response{ID: 1, Code: infra.CodeSuccess, Data: map[string]int{"result": 1}})
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, "reboot.result", verr.Identifier)
+	require.Empty(t, conn.messages())
+
+	_, err = c.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"temperature": 20})
+	require.NoError(t, err)
+	_, err = c.ThingEventPost("pk", "dn", "overheat", map[string]interface{}{"value": 100})
+	require.NoError(t, err)
+	// 回复错误时不校验
+	err = c.ThingServiceResponse("pk", "dn", "reboot", Response{ID: 1, Code: infra.CodeRequestError, Data: "{}"})
+	require.NoError(t, err)
+	msgs := conn.messages()
+	require.Len(t, msgs, 3)
+	require.Equal(t, "/sys/pk/dn/thing/service/reboot_reply", msgs[2].topic)
+
+	// 移除物模型后不校验
+	c.SetThingModel("pk", nil)
+	_, err = c.ThingEventPropertyPost("pk", "dn", map[string]interface{}{"unknown": 1})
+	require.NoError(t, err)
+}
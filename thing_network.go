@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
@@ -28,7 +29,7 @@ type TopoAddParams struct {
 // 子设备身份注册后,需网关上报与子设备的关系,然后才进行子设备上线
 // request:   /sys/{productKey}/{deviceName}/thing/topo/add
 // response:  /sys/{productKey}/{deviceName}/thing/topo/add_reply
-func (sf *Client) thingTopoAdd(pk, dn string) (*Token, error) {
+func (sf *Client) thingTopoAdd(ctx context.Context, pk, dn string) (*Token, error) {
 	if !sf.isGateway {
 		return nil, ErrNotSupportFeature
 	}
@@ -45,7 +46,7 @@ func (sf *Client) thingTopoAdd(pk, dn string) (*Token, error) {
 			DeviceSecret: ds,
 		}, timestamp)
 	_uri := sf.URIGateway(uri.SysPrefix, uri.ThingTopoAdd)
-	return sf.SendRequest(_uri, infra.MethodTopoAdd, []TopoAddParams{
+	return sf.sendRequest(ctx, _uri, infra.MethodTopoAdd, []TopoAddParams{
 		{
 			pk,
 			dn,
@@ -60,12 +61,12 @@ func (sf *Client) thingTopoAdd(pk, dn string) (*Token, error) {
 // thingTopoDelete 删除网关与子设备的拓扑关系
 // request： /sys/{productKey}/{deviceName}/thing/topo/delete
 // response：/sys/{productKey}/{deviceName}/thing/topo/delete_reply
-func (sf *Client) thingTopoDelete(pk, dn string) (*Token, error) {
+func (sf *Client) thingTopoDelete(ctx context.Context, pk, dn string) (*Token, error) {
 	if !sf.isGateway {
 		return nil, ErrNotSupportFeature
 	}
 	_uri := sf.URIGateway(uri.SysPrefix, uri.ThingTopoDelete)
-	return sf.SendRequest(_uri, infra.MethodTopoDelete, []infra.MetaPair{
+	return sf.sendRequest(ctx, _uri, infra.MethodTopoDelete, []infra.MetaPair{
 		{ProductKey: pk, DeviceName: dn},
 	})
 }
@@ -74,11 +75,16 @@ func (sf *Client) thingTopoDelete(pk, dn string) (*Token, error) {
 // request:   /sys/{productKey}/{deviceName}/thing/topo/get
 // response:  /sys/{productKey}/{deviceName}/thing/topo/get_reply
 func (sf *Client) ThingTopoGet() (*Token, error) {
+	return sf.thingTopoGet(context.Background())
+}
+
+// thingTopoGet 同 ThingTopoGet, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingTopoGet(ctx context.Context) (*Token, error) {
 	if !sf.isGateway {
 		return nil, ErrNotSupportFeature
 	}
 	_uri := sf.URIGateway(uri.SysPrefix, uri.ThingTopoGet)
-	return sf.SendRequest(_uri, infra.MethodTopoGet, "{}")
+	return sf.sendRequest(ctx, _uri, infra.MethodTopoGet, "{}")
 }
 
 // ThingListFound 发现设备列表上报
@@ -87,6 +93,11 @@ func (sf *Client) ThingTopoGet() (*Token, error) {
 // request： /sys/{productKey}/{deviceName}/thing/list/found
 // response：/sys/{productKey}/{deviceName}/thing/list/found_reply
 func (sf *Client) ThingListFound(pairs []infra.MetaPair) (*Token, error) {
+	return sf.thingListFound(context.Background(), pairs)
+}
+
+// thingListFound 同 ThingListFound, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingListFound(ctx context.Context, pairs []infra.MetaPair) (*Token, error) {
 	if !sf.isGateway {
 		return nil, ErrNotSupportFeature
 	}
@@ -94,7 +105,7 @@ func (sf *Client) ThingListFound(pairs []infra.MetaPair) (*Token, error) {
 		return nil, ErrInvalidParameter
 	}
 	_uri := sf.URIGateway(uri.SysPrefix, uri.ThingListFound)
-	return sf.SendRequest(_uri, infra.MethodListFound, pairs)
+	return sf.sendRequest(ctx, _uri, infra.MethodListFound, pairs)
 }
 
 // TopoAddResponse 添加网络拓扑应答
@@ -126,7 +137,7 @@ func ProcThingTopoAddReply(c *Client, rawURI string, payload []byte) error {
 	}
 
 	c.signalPending(Message{rsp.ID, rsp.Data, err})
-	c.Log.Debugf("thing.topo.add.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.topo.add.reply", "requestID", rsp.ID, "topic", rawURI)
 	return nil
 }
 
@@ -158,7 +169,7 @@ func ProcThingTopoDeleteReply(c *Client, rawURI string, payload []byte) error {
 	}
 
 	c.signalPending(Message{rsp.ID, rsp.Data, err})
-	c.Log.Debugf("thing.topo.delete.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.topo.delete.reply", "requestID", rsp.ID, "topic", rawURI)
 	return nil
 }
 
@@ -189,7 +200,11 @@ func ProcThingTopoGetReply(c *Client, rawURI string, payload []byte) error {
 	}
 
 	c.signalPending(Message{rsp.ID, rsp.Data, err})
-	c.Log.Debugf("thing.topo.get.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.topo.get.reply", "requestID", rsp.ID, "topic", rawURI)
+	pk, dn := uris[1], uris[2]
+	if h := c.replyHandler(infra.MethodTopoGet); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.gwCb.ThingTopoGetReply(c, err, rsp.Data)
 }
 
@@ -214,7 +229,11 @@ func ProcThingListFoundReply(c *Client, rawURI string, payload []byte) error {
 	}
 
 	c.signalPending(Message{rsp.ID, nil, err})
-	c.Log.Debugf("thing.list.found.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.list.found.reply", "requestID", rsp.ID, "topic", rawURI)
+	pk, dn := uris[1], uris[2]
+	if h := c.replyHandler(infra.MethodListFound); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.gwCb.ThingListFoundReply(c, err)
 }
 
@@ -235,7 +254,7 @@ func ProcThingTopoAddNotify(c *Client, rawURI string, payload []byte) error {
 	if len(uris) < 7 {
 		return ErrInvalidURI
 	}
-	c.Log.Debugf("thing.topo.add.notify")
+	c.StructuredLog().Debug("thing.topo.add.notify")
 
 	req := &TopoAddNotifyRequest{}
 	if err := json.Unmarshal(payload, req); err != nil {
@@ -245,7 +264,11 @@ func ProcThingTopoAddNotify(c *Client, rawURI string, payload []byte) error {
 	_uri := uri.ReplyWithRequestURI(rawURI)
 	err := c.Response(_uri, Response{ID: req.ID, Code: infra.CodeSuccess, Data: "{}"})
 	if err != nil {
-		c.Log.Warnf("thing.topo.add.notify.response, %+v", err)
+		c.StructuredLog().Warn("thing.topo.add.notify.response", "error", err)
+	}
+	pk, dn := uris[1], uris[2]
+	if h := c.handler(infra.MethodTopoAddNotify); h != nil {
+		return h(c, pk, dn, payload)
 	}
 	return c.gwCb.ThingTopoAddNotify(c, req.Params)
 }
@@ -273,7 +296,7 @@ func ProcThingTopoChange(c *Client, rawURI string, payload []byte) error {
 	if len(uris) < 6 {
 		return ErrInvalidURI
 	}
-	c.Log.Debugf("thing.topo.change")
+	c.StructuredLog().Debug("thing.topo.change")
 
 	req := &TopoChangeRequest{}
 	if err := json.Unmarshal(payload, req); err != nil {
@@ -283,7 +306,11 @@ func ProcThingTopoChange(c *Client, rawURI string, payload []byte) error {
 	_uri := uri.ReplyWithRequestURI(rawURI)
 	err := c.Response(_uri, Response{ID: req.ID, Code: infra.CodeSuccess, Data: "{}"})
 	if err != nil {
-		c.Log.Warnf("thing.topo.change.response, %+v", err)
+		c.StructuredLog().Warn("thing.topo.change.response", "error", err)
+	}
+	pk, dn := uris[1], uris[2]
+	if h := c.handler(infra.MethodTopoChange); h != nil {
+		return h(c, pk, dn, payload)
 	}
 	return c.gwCb.ThingTopoChange(c, req.Params)
 }
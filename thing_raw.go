@@ -5,7 +5,10 @@
 package aiot
 
 import (
-	uri "github.com/things-go/aliyun-iot/uri"
+	"context"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/uri"
 )
 
 // @see https://help.aliyun.com/document_detail/89301.html?spm=a2c4g.11186623.6.706.570f3f69J3fW5z
@@ -17,12 +20,13 @@ func (sf *Client) ThingModelUpRaw(pk, dn string, payload interface{}) error {
 	if !sf.hasRawModel {
 		return ErrNotSupportFeature
 	}
-	sf.Log.Debugf("thing.model.up.raw")
+	sf.StructuredLog().Debug("thing.model.up.raw")
 	_uri := uri.URI(uri.SysPrefix, uri.ThingModelUpRaw, pk, dn)
 	return sf.Publish(_uri, 1, payload)
 }
 
 // ProcThingModelUpRawReply 处理透传上行的应答
+// 设置了 RawCodec 时解码后按Alink应答处理, 见 WithRawCodec
 // request: /sys/{productKey}/{deviceName}/thing/model/up_raw
 // response: /sys/{productKey}/{deviceName}/thing/model/up_raw_reply
 // subscribe: /sys/{productKey}/{deviceName}/thing/model/up_raw_reply
@@ -31,22 +35,40 @@ func ProcThingModelUpRawReply(c *Client, rawURI string, payload []byte) error {
 	if len(uris) < 6 {
 		return ErrInvalidURI
 	}
-	c.Log.Debugf("thing.model.up.raw.reply")
+	c.StructuredLog().Debug("thing.model.up.raw.reply")
 	pk, dn := uris[1], uris[2]
+	if codec := c.rawCodec(pk); codec != nil {
+		return c.procRawReply(codec, pk, dn, payload)
+	}
+	if h := c.replyHandler(infra.MethodModelUpRaw); h != nil {
+		return h(c, nil, pk, dn, payload)
+	}
 	return c.cb.ThingModelUpRawReply(c, pk, dn, payload)
 }
 
 // ProcThingModelDownRaw 处理透传下行数据
+// 设置了 RawCodec 时解码后按Alink下行请求处理, 见 WithRawCodec
 // 下行
 // request: /sys/{productKey}/{deviceName}/thing/model/down_raw
 // response: /sys/{productKey}/{deviceName}/thing/model/down_raw_reply
 // subscribe: /sys/{productKey}/{deviceName}/thing/model/down_raw
 func ProcThingModelDownRaw(c *Client, rawURI string, payload []byte) error {
+	return ProcThingModelDownRawContext(context.Background(), c, rawURI, payload)
+}
+
+// ProcThingModelDownRawContext 同 ProcThingModelDownRaw, ctx传递给服务调用的处理函数
+func ProcThingModelDownRawContext(ctx context.Context, c *Client, rawURI string, payload []byte) error {
 	uris := uri.Spilt(rawURI)
 	if len(uris) < 6 {
 		return ErrInvalidURI
 	}
-	c.Log.Debugf("thing.model.down.raw")
+	c.StructuredLog().Debug("thing.model.down.raw")
 	pk, dn := uris[1], uris[2]
+	if codec := c.rawCodec(pk); codec != nil {
+		return c.procRawRequest(ctx, codec, pk, dn, payload)
+	}
+	if h := c.handler(infra.MethodModelDownRaw); h != nil {
+		return h(c, pk, dn, payload)
+	}
 	return c.cb.ThingModelDownRaw(c, pk, dn, payload)
 }
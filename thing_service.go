@@ -4,14 +4,27 @@
 
 package aiot
 
-import "github.com/things-go/aliyun-iot/uri"
+import (
+	"context"
+	"fmt"
+
+	"github.com/things-go/aliyun-iot/infra"
+	"github.com/things-go/aliyun-iot/uri"
+)
 
 // ProcThingServiceRequest 处理设备服务调用(异步)
 // 下行
 // request:   /sys/{productKey}/{deviceName}/thing/service/[{tsl.service.identifier},property/set]
 // response:  /sys/{productKey}/{deviceName}/thing/service/[{tsl.service.identifier}_reply,property/set_reply
 // subscribe: /sys/{productKey}/{deviceName}/thing/service/[+,#]
+// 优先使用 HandlePropertySet 注册的属性设置函数或 ServeService 注册的类型化处理函数并自动回复,
+// 未注册处理函数且未设置 Callback 时,回复请求错误
 func ProcThingServiceRequest(c *Client, rawURI string, payload []byte) error {
+	return ProcThingServiceRequestContext(context.Background(), c, rawURI, payload)
+}
+
+// ProcThingServiceRequestContext 同 ProcThingServiceRequest, ctx传递给处理函数, 见 ServiceRequest.Context
+func ProcThingServiceRequestContext(ctx context.Context, c *Client, rawURI string, payload []byte) error {
 	uris := uri.Spilt(rawURI)
 	if len(uris) < 6 {
 		return ErrInvalidURI
@@ -19,10 +32,29 @@ func ProcThingServiceRequest(c *Client, rawURI string, payload []byte) error {
 
 	pk, dn := uris[1], uris[2]
 	serviceID := uris[5]
-	if serviceID == property && len(uris) >= 7 && uris[6] == "set" {
-		c.Log.Debugf("thing.service.property.set")
+	isPropertySet := serviceID == property && len(uris) >= 7 && uris[6] == "set"
+	method := fmt.Sprintf(infra.MethodServiceFormat, serviceID)
+	if isPropertySet {
+		method = infra.MethodServicePropertySet
+	}
+	c.StructuredLog().Debug(method, "topic", rawURI)
+	if isPropertySet {
+		// 属性设置可能来自期望值的修改, 处理完成后同步期望属性
+		defer c.triggerDesired(pk, dn)
+		if c.hasPropertySetter() {
+			return c.servePropertySet(ctx, pk, dn, payload)
+		}
+	} else if f := c.service(serviceID); f != nil {
+		return c.serve(f, ServiceRequest{ProductKey: pk, DeviceName: dn, ServiceID: serviceID, ctx: ctx}, payload)
+	}
+	if h := c.handler(method); h != nil {
+		return h(c, pk, dn, payload)
+	}
+	if _, ok := c.cb.(NopCb); ok {
+		return c.replyNotSupported(rawURI, method, payload)
+	}
+	if isPropertySet {
 		return c.cb.ThingServicePropertySet(c, pk, dn, payload)
 	}
-	c.Log.Debugf("thing.service.%s", serviceID)
 	return c.cb.ThingServiceRequest(c, serviceID, pk, dn, payload)
 }
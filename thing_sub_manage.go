@@ -22,7 +22,7 @@ func ProcThingDisable(c *Client, rawURI string, payload []byte) error {
 	}
 
 	pk, dn := uris[1], uris[2]
-	c.Log.Debugf("thing.disable -- %s.%s", pk, dn)
+	c.DeviceLog(pk, dn).Debug("thing.disable")
 
 	req := &Request{}
 	err := json.Unmarshal(payload, req)
@@ -31,13 +31,16 @@ func ProcThingDisable(c *Client, rawURI string, payload []byte) error {
 	}
 
 	if err = c.SetDeviceAvail(pk, dn, false); err != nil {
-		c.Log.Warnf("thing.disable failed, %+v", err)
+		c.StructuredLog().Warn("thing.disable failed", "error", err)
 	}
 
 	_uri := uri.ReplyWithRequestURI(rawURI)
 	err = c.Response(_uri, Response{ID: req.ID, Code: infra.CodeSuccess, Data: "{}"})
 	if err != nil {
-		c.Log.Warnf("thing.disable.reply failed, %+v", err)
+		c.StructuredLog().Warn("thing.disable.reply failed", "error", err)
+	}
+	if h := c.handler(infra.MethodDisable); h != nil {
+		return h(c, pk, dn, payload)
 	}
 	return c.gwCb.ThingDisable(c, pk, dn)
 }
@@ -53,7 +56,7 @@ func ProcThingEnable(c *Client, rawURI string, payload []byte) error {
 		return ErrInvalidURI
 	}
 	pk, dn := uris[1], uris[2]
-	c.Log.Debugf("thing.enable -- %s.%s", pk, dn)
+	c.DeviceLog(pk, dn).Debug("thing.enable")
 
 	req := &Request{}
 	err := json.Unmarshal(payload, req)
@@ -62,13 +65,16 @@ func ProcThingEnable(c *Client, rawURI string, payload []byte) error {
 	}
 
 	if err = c.SetDeviceAvail(pk, dn, true); err != nil {
-		c.Log.Warnf("thing.enable failed, %+v", err)
+		c.StructuredLog().Warn("thing.enable failed", "error", err)
 	}
 
 	_uri := uri.ReplyWithRequestURI(rawURI)
 	err = c.Response(_uri, Response{ID: req.ID, Code: infra.CodeSuccess, Data: "{}"})
 	if err != nil {
-		c.Log.Warnf("thing.enable.reply failed, %+v", err)
+		c.StructuredLog().Warn("thing.enable.reply failed", "error", err)
+	}
+	if h := c.handler(infra.MethodEnable); h != nil {
+		return h(c, pk, dn, payload)
 	}
 	return c.gwCb.ThingEnable(c, pk, dn)
 }
@@ -84,7 +90,7 @@ func ProcThingDelete(c *Client, rawURI string, payload []byte) error {
 		return ErrInvalidURI
 	}
 	pk, dn := uris[1], uris[2]
-	c.Log.Debugf("thing.delete -- %s.%s", pk, dn)
+	c.DeviceLog(pk, dn).Debug("thing.delete")
 
 	req := &Request{}
 	if err := json.Unmarshal(payload, req); err != nil {
@@ -95,7 +101,10 @@ func ProcThingDelete(c *Client, rawURI string, payload []byte) error {
 	_uri := uri.ReplyWithRequestURI(rawURI)
 	err := c.Response(_uri, Response{ID: req.ID, Code: infra.CodeSuccess, Data: "{}"})
 	if err != nil {
-		c.Log.Warnf("thing.delete.reply failed, %+v", err)
+		c.StructuredLog().Warn("thing.delete.reply failed", "error", err)
+	}
+	if h := c.handler(infra.MethodDelete); h != nil {
+		return h(c, pk, dn, payload)
 	}
 	return c.gwCb.ThingDelete(c, pk, dn)
 }
@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/things-go/aliyun-iot/infra"
@@ -33,12 +34,12 @@ type SubRegisterResponse struct {
 // 网关类型的设备,通过上行请求为子设备发起动态注册,返回成功注册的子设备的设备证书
 // request:   /sys/{productKey}/{deviceName}/thing/sub/register
 // response:  /sys/{productKey}/{deviceName}/thing/sub/register_reply
-func (sf *Client) thingSubRegister(pk, dn string) (*Token, error) {
+func (sf *Client) thingSubRegister(ctx context.Context, pk, dn string) (*Token, error) {
 	if !sf.isGateway {
 		return nil, ErrNotSupportFeature
 	}
 	_uri := sf.URIGateway(uri.SysPrefix, uri.ThingSubRegister)
-	return sf.SendRequest(_uri, infra.MethodSubDevRegister, []infra.MetaPair{
+	return sf.sendRequest(ctx, _uri, infra.MethodSubDevRegister, []infra.MetaPair{
 		{ProductKey: pk, DeviceName: dn},
 	})
 }
@@ -62,6 +63,6 @@ func ProcThingSubRegisterReply(c *Client, rawURI string, payload []byte) error {
 		err = infra.NewCodeError(rsp.Code, rsp.Message)
 	}
 	c.signalPending(Message{rsp.ID, rsp.Data, err})
-	c.Log.Debugf("thing.sub.register.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.sub.register.reply", "requestID", rsp.ID, "topic", rawURI)
 	return nil
 }
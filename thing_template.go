@@ -5,6 +5,7 @@
 package aiot
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/things-go/aliyun-iot/infra"
@@ -16,20 +17,30 @@ import (
 // request:   /sys/{productKey}/{deviceName}/thing/dsltemplate/get
 // response:  /sys/{productKey}/{deviceName}/thing/dsltemplate/get_reply
 func (sf *Client) ThingDsltemplateGet(pk, dn string) (*Token, error) {
+	return sf.thingDsltemplateGet(context.Background(), pk, dn)
+}
+
+// thingDsltemplateGet 同 ThingDsltemplateGet, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingDsltemplateGet(ctx context.Context, pk, dn string) (*Token, error) {
 	if !sf.IsActive(pk, dn) {
 		return nil, ErrNotActive
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingDslTemplateGet, pk, dn)
-	return sf.SendRequest(_uri, infra.MethodDslTemplateGet, "{}")
+	return sf.sendRequest(ctx, _uri, infra.MethodDslTemplateGet, "{}")
 }
 
 // ThingDynamictslGet 获取动态tsl
 func (sf *Client) ThingDynamictslGet(pk, dn string) (*Token, error) {
+	return sf.thingDynamictslGet(context.Background(), pk, dn)
+}
+
+// thingDynamictslGet 同 ThingDynamictslGet, 使能链路追踪时ctx为请求span的父span
+func (sf *Client) thingDynamictslGet(ctx context.Context, pk, dn string) (*Token, error) {
 	if !sf.IsActive(pk, dn) {
 		return nil, ErrNotActive
 	}
 	_uri := uri.URI(uri.SysPrefix, uri.ThingDynamicTslGet, pk, dn)
-	return sf.SendRequest(_uri, infra.MethodDynamicTslGet, map[string]interface{}{
+	return sf.sendRequest(ctx, _uri, infra.MethodDynamicTslGet, map[string]interface{}{
 		"nodes":      []string{"type", "identifier"},
 		"addDefault": false,
 	})
@@ -55,8 +66,11 @@ func ProcThingDsltemplateGetReply(c *Client, rawURI string, payload []byte) erro
 	}
 
 	c.signalPending(Message{rsp.ID, dupJSONRawMessage(rsp.Data), err})
-	c.Log.Debugf("thing.dsltemplate.get.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.dsltemplate.get.reply", "requestID", rsp.ID, "topic", rawURI)
 	pk, dn := uris[1], uris[2]
+	if h := c.replyHandler(infra.MethodDslTemplateGet); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingDsltemplateGetReply(c, err, pk, dn, rsp.Data)
 }
 
@@ -81,6 +95,9 @@ func ProcThingDynamictslGetReply(c *Client, rawURI string, payload []byte) error
 
 	c.signalPending(Message{rsp.ID, dupJSONRawMessage(rsp.Data), err})
 	pk, dn := uris[1], uris[2]
-	c.Log.Debugf("thing.dynamictsl.get.reply @%d", rsp.ID)
+	c.StructuredLog().Debug("thing.dynamictsl.get.reply", "requestID", rsp.ID, "topic", rawURI)
+	if h := c.replyHandler(infra.MethodDynamicTslGet); h != nil {
+		return h(c, err, pk, dn, payload)
+	}
 	return c.cb.ThingDynamictslGetReply(c, err, pk, dn, rsp.Data)
 }
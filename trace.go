@@ -0,0 +1,96 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+// TracerName OpenTelemetry tracer名称
+const TracerName = "github.com/things-go/aliyun-iot"
+
+// span 属性
+const (
+	AttrProductKey = attribute.Key("aiot.product_key")
+	AttrDeviceName = attribute.Key("aiot.device_name")
+	AttrMethod     = attribute.Key("aiot.method")
+	AttrRequestID  = attribute.Key("aiot.request_id")
+	AttrTopic      = attribute.Key("aiot.topic")
+)
+
+// startRequestSpan 开始请求的span, 未使能链路追踪时返回nil
+func (sf *Client) startRequestSpan(ctx context.Context, _uri, method string, id uint) trace.Span {
+	if sf.tracer == nil {
+		return nil
+	}
+	pk, dn := topicDevice(_uri)
+	_, span := sf.tracer.Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			AttrProductKey.String(pk),
+			AttrDeviceName.String(dn),
+			AttrMethod.String(method),
+			AttrRequestID.Int64(int64(id)),
+			AttrTopic.String(_uri),
+		))
+	return span
+}
+
+// endSpan 结束span, err不为nil时记录错误
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startDownStreamSpan 以ctx为父span开始下行数据处理的span, 返回包含该span的ctx
+// mqtt下行数据不携带链路信息, ctx通常为根上下文
+func (sf *Client) startDownStreamSpan(ctx context.Context, rawURI string, payload []byte) (context.Context, trace.Span) {
+	req := struct {
+		ID     uint   `json:"id,string"`
+		Method string `json:"method"`
+	}{}
+	json.Unmarshal(payload, &req) // nolint: errcheck
+	if req.Method == "" {
+		req.Method = rawURI
+	}
+
+	pk, dn := topicDevice(rawURI)
+	attrs := []attribute.KeyValue{
+		AttrProductKey.String(pk),
+		AttrDeviceName.String(dn),
+		AttrMethod.String(req.Method),
+		AttrTopic.String(rawURI),
+	}
+	if req.ID != 0 {
+		attrs = append(attrs, AttrRequestID.Int64(int64(req.ID)))
+	}
+	return sf.tracer.Start(ctx, req.Method,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...))
+}
+
+// topicDevice 获取topic所属设备, 无法识别时返回空
+func topicDevice(topic string) (pk, dn string) {
+	uris := uri.Spilt(topic)
+	switch {
+	case len(uris) >= 3 && uris[0] == "sys":
+		return uris[1], uris[2]
+	case len(uris) >= 4 && uris[0] == "ext" && uris[1] != "rrpc":
+		return uris[2], uris[3]
+	case len(uris) >= 5 && uris[0] == "ota":
+		return uris[3], uris[4]
+	}
+	return "", ""
+}
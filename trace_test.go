@@ -0,0 +1,118 @@
+package aiot
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+func spanAttrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestTraceRequest(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, newMockConn(), WithTracerProvider(tp))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	token, err := c.SendRequestContext(ctx, "/sys/pk/dn/thing/config/get", infra.MethodConfigGet, struct{}{})
+	require.NoError(t, err)
+	require.Empty(t, sr.Ended())
+	err = ProcThingConfigGetReply(c, "/sys/pk/dn/thing/config/get_reply",
+		[]byte(`{"id":"`+strconv.FormatUint(uint64(token.id), 10)+`","code":200,"data":{}}`))
+	require.NoError(t, err)
+	parent.End()
+
+	// 请求span先于父span结束
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	require.Equal(t, infra.MethodConfigGet, span.Name())
+	require.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	attrs := spanAttrs(span)
+	require.Equal(t, "pk", attrs[AttrProductKey].AsString())
+	require.Equal(t, "dn", attrs[AttrDeviceName].AsString())
+	require.Equal(t, int64(token.id), attrs[AttrRequestID].AsInt64())
+	require.Equal(t, codes.Unset, span.Status().Code)
+
+	// 超时
+	token, err = c.SendRequest("/sys/pk/dn/thing/config/get", infra.MethodConfigGet, struct{}{})
+	require.NoError(t, err)
+	_, err = token.Wait(time.Millisecond)
+	require.Equal(t, ErrWaitTimeout, err)
+	spans = sr.Ended()
+	require.Len(t, spans, 3)
+	require.Equal(t, codes.Error, spans[2].Status().Code)
+}
+
+func TestTraceDownStream(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, newMockConn(), WithTracerProvider(tp))
+	c.HandleService("reboot", func(*Client, string, string, []byte) error { return nil })
+
+	h := c.wrap(ProcThingServiceRequest)
+	req := []byte(`{"id":"42","version":"1.0","params":{},"method":"thing.service.reboot"}`)
+	require.NoError(t, h(c, "/sys/pk/sub/thing/service/reboot", req))
+
+	spans := sr.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "thing.service.reboot", spans[0].Name())
+	attrs := spanAttrs(spans[0])
+	require.Equal(t, "sub", attrs[AttrDeviceName].AsString())
+	require.Equal(t, int64(42), attrs[AttrRequestID].AsInt64())
+}
+
+func TestTraceLinkContext(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, newMockConn(), WithTracerProvider(tp))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := c.LinkThingConfigGetContext(ctx, "pk", "dn")
+	require.Error(t, err)
+	parent.End()
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, infra.MethodConfigGet, spans[0].Name())
+	require.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
+
+func TestTraceDownStreamContext(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, newMockConn(), WithTracerProvider(tp))
+	ServeService(c, "reboot", func(c *Client, req ServiceRequest, _ struct{}) (struct{}, error) {
+		_, err := c.SendRequestContext(req.Context(), "/sys/pk/dn/thing/event/property/post",
+			infra.MethodEventPropertyPost, map[string]int{"state": 1}, WithAck(false))
+		return struct{}{}, err
+	})
+
+	h := c.wrapContext(ProcThingServiceRequestContext)
+	req := []byte(`{"id":"42","version":"1.0","params":{},"method":"thing.service.reboot"}`)
+	require.NoError(t, h(c, "/sys/pk/dn/thing/service/reboot", req))
+
+	// 处理函数中的请求span以下行span为父span
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, infra.MethodEventPropertyPost, spans[0].Name())
+	require.Equal(t, "thing.service.reboot", spans[1].Name())
+	require.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package tsl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Type 数据类型
+type Type string
+
+// 数据类型
+const (
+	TypeInt    Type = "int"
+	TypeFloat  Type = "float"
+	TypeDouble Type = "double"
+	TypeText   Type = "text"
+	TypeDate   Type = "date" // UTC时间戳,单位ms,字符串格式
+	TypeBool   Type = "bool"
+	TypeEnum   Type = "enum"
+	TypeStruct Type = "struct"
+	TypeArray  Type = "array"
+)
+
+// IsNumber 是否为数值类型
+func (sf Type) IsNumber() bool {
+	return sf == TypeInt || sf == TypeFloat || sf == TypeDouble
+}
+
+// DataType 数据类型及规格,不同的类型仅使用对应的规格字段
+type DataType struct {
+	Type Type
+
+	// int, float, double 的取值范围,步长,单位. 未设置时为nil
+	Min      *float64
+	Max      *float64
+	Step     *float64
+	Unit     string
+	UnitName string
+
+	// text 的最大长度, 0表示未设置
+	Length int
+
+	// bool, enum 的取值及其描述, bool 的取值为0和1
+	Values map[int]string
+
+	// struct 的成员
+	Members []Param
+
+	// array 的元素个数及元素类型
+	Size int
+	Item *DataType
+}
+
+// dataType 物模型json中的数据类型
+type dataType struct {
+	Type  Type            `json:"type"`
+	Specs json.RawMessage `json:"specs,omitempty"`
+}
+
+type numberSpecs struct {
+	Min      json.RawMessage `json:"min,omitempty"`
+	Max      json.RawMessage `json:"max,omitempty"`
+	Step     json.RawMessage `json:"step,omitempty"`
+	Unit     string          `json:"unit,omitempty"`
+	UnitName string          `json:"unitName,omitempty"`
+}
+
+type textSpecs struct {
+	Length json.RawMessage `json:"length,omitempty"`
+}
+
+type arraySpecs struct {
+	Size json.RawMessage `json:"size,omitempty"`
+	Item *DataType       `json:"item,omitempty"`
+}
+
+// UnmarshalJSON implement json.Unmarshaler
+func (sf *DataType) UnmarshalJSON(data []byte) error {
+	dt := dataType{}
+	if err := json.Unmarshal(data, &dt); err != nil {
+		return err
+	}
+	*sf = DataType{Type: dt.Type}
+	specs := bytes.TrimSpace(dt.Specs)
+	if len(specs) == 0 || bytes.Equal(specs, []byte("null")) {
+		return nil
+	}
+
+	var err error
+	switch dt.Type {
+	case TypeInt, TypeFloat, TypeDouble:
+		s := numberSpecs{}
+		if err = json.Unmarshal(specs, &s); err != nil {
+			break
+		}
+		sf.Unit, sf.UnitName = s.Unit, s.UnitName
+		if sf.Min, err = parseFloat(s.Min); err != nil {
+			break
+		}
+		if sf.Max, err = parseFloat(s.Max); err != nil {
+			break
+		}
+		sf.Step, err = parseFloat(s.Step)
+	case TypeText:
+		s := textSpecs{}
+		if err = json.Unmarshal(specs, &s); err != nil {
+			break
+		}
+		sf.Length, err = parseInt(s.Length)
+	case TypeBool, TypeEnum:
+		m := make(map[string]string)
+		if err = json.Unmarshal(specs, &m); err != nil {
+			break
+		}
+		sf.Values = make(map[int]string, len(m))
+		for k, v := range m {
+			var key int
+			if key, err = strconv.Atoi(k); err != nil {
+				break
+			}
+			sf.Values[key] = v
+		}
+	case TypeStruct:
+		err = json.Unmarshal(specs, &sf.Members)
+	case TypeArray:
+		s := arraySpecs{}
+		if err = json.Unmarshal(specs, &s); err != nil {
+			break
+		}
+		sf.Item = s.Item
+		sf.Size, err = parseInt(s.Size)
+	}
+	if err != nil {
+		return fmt.Errorf("tsl: invalid %s specs, %w", dt.Type, err)
+	}
+	return nil
+}
+
+// MarshalJSON implement json.Marshaler, 与物模型json格式一致,数值均为字符串
+func (sf DataType) MarshalJSON() ([]byte, error) {
+	var specs interface{}
+
+	switch sf.Type {
+	case TypeInt, TypeFloat, TypeDouble:
+		specs = numberSpecs{
+			Min:      formatFloat(sf.Min),
+			Max:      formatFloat(sf.Max),
+			Step:     formatFloat(sf.Step),
+			Unit:     sf.Unit,
+			UnitName: sf.UnitName,
+		}
+	case TypeText:
+		specs = textSpecs{formatInt(sf.Length)}
+	case TypeBool, TypeEnum:
+		m := make(map[string]string, len(sf.Values))
+		for k, v := range sf.Values {
+			m[strconv.Itoa(k)] = v
+		}
+		specs = m
+	case TypeStruct:
+		members := sf.Members
+		if members == nil {
+			members = []Param{}
+		}
+		specs = members
+	case TypeArray:
+		specs = arraySpecs{formatInt(sf.Size), sf.Item}
+	default:
+		specs = struct{}{}
+	}
+	raw, err := json.Marshal(specs)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(dataType{sf.Type, raw})
+}
+
+// parseFloat 解析字符串或数值格式的数值, 空值返回nil
+func parseFloat(raw json.RawMessage) (*float64, error) {
+	raw = bytes.Trim(bytes.TrimSpace(raw), `"`)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// parseInt 解析字符串或数值格式的整数, 空值返回0
+func parseInt(raw json.RawMessage) (int, error) {
+	v, err := parseFloat(raw)
+	if err != nil || v == nil {
+		return 0, err
+	}
+	return int(*v), nil
+}
+
+func formatFloat(v *float64) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	return json.RawMessage(strconv.Quote(strconv.FormatFloat(*v, 'f', -1, 64)))
+}
+
+func formatInt(v int) json.RawMessage {
+	if v == 0 {
+		return nil
+	}
+	return json.RawMessage(strconv.Quote(strconv.Itoa(v)))
+}
@@ -0,0 +1,283 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package tsl 物模型(TSL)解析,支持合并动态物模型(dynamicTsl)及从文件加载
+// @see https://help.aliyun.com/document_detail/73727.html
+package tsl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+// ErrInvalidTSL 无效的物模型
+var ErrInvalidTSL = errors.New("tsl: invalid thing model")
+
+// 读写类型
+const (
+	AccessReadWrite = "rw"
+	AccessRead      = "r"
+)
+
+// 服务调用方式
+const (
+	CallTypeAsync = "async"
+	CallTypeSync  = "sync"
+)
+
+// 事件类型
+const (
+	EventTypeInfo  = "info"
+	EventTypeAlert = "alert"
+	EventTypeError = "error"
+)
+
+// Profile 物模型所属产品信息
+type Profile struct {
+	Version    string `json:"version,omitempty"`
+	ProductKey string `json:"productKey"`
+}
+
+// Param 事件输出参数,服务输入输出参数,结构体成员
+type Param struct {
+	Identifier string   `json:"identifier"`
+	Name       string   `json:"name"`
+	DataType   DataType `json:"dataType"`
+}
+
+// UnmarshalJSON implement json.Unmarshaler
+// 属性获取服务(get)的输入参数仅为属性标识符列表, 此时仅有 Identifier
+func (sf *Param) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		*sf = Param{}
+		return json.Unmarshal(data, &sf.Identifier)
+	}
+	type param Param
+	return json.Unmarshal(data, (*param)(sf))
+}
+
+// Property 属性
+type Property struct {
+	Identifier string   `json:"identifier"`
+	Name       string   `json:"name"`
+	AccessMode string   `json:"accessMode"` // 读写类型, rw: 读写, r: 只读
+	Required   bool     `json:"required"`
+	Desc       string   `json:"desc,omitempty"`
+	DataType   DataType `json:"dataType"`
+}
+
+// Writable 属性是否可写
+func (sf *Property) Writable() bool { return sf.AccessMode == AccessReadWrite }
+
+// Event 事件
+type Event struct {
+	Identifier string  `json:"identifier"`
+	Name       string  `json:"name"`
+	Type       string  `json:"type"` // 事件类型, info: 信息, alert: 告警, error: 故障
+	Required   bool    `json:"required"`
+	Desc       string  `json:"desc,omitempty"`
+	Method     string  `json:"method"`
+	OutputData []Param `json:"outputData"`
+}
+
+// Service 服务
+type Service struct {
+	Identifier string  `json:"identifier"`
+	Name       string  `json:"name"`
+	CallType   string  `json:"callType"` // 调用方式, async: 异步, sync: 同步
+	Required   bool    `json:"required"`
+	Desc       string  `json:"desc,omitempty"`
+	Method     string  `json:"method"`
+	InputData  []Param `json:"inputData"`
+	OutputData []Param `json:"outputData"`
+}
+
+// Thing 物模型
+type Thing struct {
+	Schema  string  `json:"schema,omitempty"`
+	Profile Profile `json:"profile"`
+	// 自定义模块(功能块)的标识符及名称, 默认模块为空.
+	// 自定义模块的属性,事件,服务在Alink协议中的标识符为 {functionBlockId}:{identifier}
+	FunctionBlockID   string     `json:"functionBlockId,omitempty"`
+	FunctionBlockName string     `json:"functionBlockName,omitempty"`
+	Properties        []Property `json:"properties"`
+	Events            []Event    `json:"events"`
+	Services          []Service  `json:"services"`
+}
+
+// Identifier 属性,事件,服务在Alink协议中的标识符, 自定义模块为 {functionBlockId}:{identifier}
+func (sf *Thing) Identifier(identifier string) string {
+	if sf.FunctionBlockID == "" {
+		return identifier
+	}
+	return sf.FunctionBlockID + ":" + identifier
+}
+
+// SplitIdentifier 拆分Alink协议中的标识符 {functionBlockId}:{identifier}, 默认模块的functionBlockID为空
+func SplitIdentifier(id string) (functionBlockID, identifier string) {
+	if i := strings.IndexByte(id, ':'); i >= 0 {
+		return id[:i], id[i+1:]
+	}
+	return "", id
+}
+
+// localIdentifier 去除Alink协议中标识符的模块前缀, 模块与物模型不一致时返回false
+func (sf *Thing) localIdentifier(id string) (string, bool) {
+	fb, identifier := SplitIdentifier(id)
+	return identifier, fb == sf.FunctionBlockID
+}
+
+// Parse 解析物模型, data可以是物模型json对象, 也可以是json对象序列化后的字符串
+func Parse(data []byte) (*Thing, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, err
+		}
+		data = []byte(s)
+	}
+	if len(data) == 0 || data[0] != '{' {
+		return nil, ErrInvalidTSL
+	}
+	t := &Thing{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ParseWithDynamic 解析物模型模板(dsltemplate),并合并动态物模型(dynamicTsl)
+func ParseWithDynamic(template, dynamic []byte) (*Thing, error) {
+	t, err := Parse(template)
+	if err != nil {
+		return nil, err
+	}
+	d, err := Parse(dynamic)
+	if err != nil {
+		return nil, err
+	}
+	return t.Merge(d), nil
+}
+
+// LoadFile 从文件加载物模型, dynamics为动态物模型文件,按顺序合并
+func LoadFile(name string, dynamics ...string) (*Thing, error) {
+	t, err := loadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, dynamic := range dynamics {
+		d, err := loadFile(dynamic)
+		if err != nil {
+			return nil, err
+		}
+		t = t.Merge(d)
+	}
+	return t, nil
+}
+
+func loadFile(name string) (*Thing, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Merge 合并动态物模型, 返回新的物模型, 原物模型不变.
+// 标识符相同的属性,事件,服务使用动态物模型的定义替换, 其余追加到末尾
+func (sf *Thing) Merge(dynamic *Thing) *Thing {
+	t := &Thing{
+		Schema:            sf.Schema,
+		Profile:           sf.Profile,
+		FunctionBlockID:   sf.FunctionBlockID,
+		FunctionBlockName: sf.FunctionBlockName,
+		Properties:        append([]Property{}, sf.Properties...),
+		Events:            append([]Event{}, sf.Events...),
+		Services:          append([]Service{}, sf.Services...),
+	}
+	if dynamic == nil {
+		return t
+	}
+	if t.Profile.ProductKey == "" {
+		t.Profile.ProductKey = dynamic.Profile.ProductKey
+	}
+	for _, p := range dynamic.Properties {
+		if i := t.propertyIndex(p.Identifier); i >= 0 {
+			t.Properties[i] = p
+		} else {
+			t.Properties = append(t.Properties, p)
+		}
+	}
+	for _, e := range dynamic.Events {
+		if i := t.eventIndex(e.Identifier); i >= 0 {
+			t.Events[i] = e
+		} else {
+			t.Events = append(t.Events, e)
+		}
+	}
+	for _, s := range dynamic.Services {
+		if i := t.serviceIndex(s.Identifier); i >= 0 {
+			t.Services[i] = s
+		} else {
+			t.Services = append(t.Services, s)
+		}
+	}
+	return t
+}
+
+// Property 根据标识符查找属性
+func (sf *Thing) Property(identifier string) (*Property, bool) {
+	if i := sf.propertyIndex(identifier); i >= 0 {
+		return &sf.Properties[i], true
+	}
+	return nil, false
+}
+
+// Event 根据标识符查找事件
+func (sf *Thing) Event(identifier string) (*Event, bool) {
+	if i := sf.eventIndex(identifier); i >= 0 {
+		return &sf.Events[i], true
+	}
+	return nil, false
+}
+
+// Service 根据标识符查找服务
+func (sf *Thing) Service(identifier string) (*Service, bool) {
+	if i := sf.serviceIndex(identifier); i >= 0 {
+		return &sf.Services[i], true
+	}
+	return nil, false
+}
+
+func (sf *Thing) propertyIndex(identifier string) int {
+	for i := range sf.Properties {
+		if sf.Properties[i].Identifier == identifier {
+			return i
+		}
+	}
+	return -1
+}
+
+func (sf *Thing) eventIndex(identifier string) int {
+	for i := range sf.Events {
+		if sf.Events[i].Identifier == identifier {
+			return i
+		}
+	}
+	return -1
+}
+
+func (sf *Thing) serviceIndex(identifier string) int {
+	for i := range sf.Services {
+		if sf.Services[i].Identifier == identifier {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,108 @@
+package tsl
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	thing, err := LoadFile("testdata/thing.json")
+	require.NoError(t, err)
+	require.Equal(t, "a1B2c3D4e5F", thing.Profile.ProductKey)
+	require.Len(t, thing.Properties, 7)
+	require.Len(t, thing.Events, 2)
+	require.Len(t, thing.Services, 3)
+
+	p, ok := thing.Property("temperature")
+	require.True(t, ok)
+	require.False(t, p.Writable())
+	require.Equal(t, TypeFloat, p.DataType.Type)
+	require.Equal(t, -40.0, *p.DataType.Min)
+	require.Equal(t, 120.0, *p.DataType.Max)
+	require.Equal(t, 0.1, *p.DataType.Step)
+	require.Equal(t, "°C", p.DataType.Unit)
+
+	p, _ = thing.Property("mode")
+	require.Equal(t, map[int]string{0: "自动", 1: "制冷", 2: "制热"}, p.DataType.Values)
+
+	p, _ = thing.Property("location")
+	require.Equal(t, TypeStruct, p.DataType.Type)
+	require.Len(t, p.DataType.Members, 2)
+	require.Equal(t, "latitude", p.DataType.Members[1].Identifier)
+	require.Equal(t, TypeDouble, p.DataType.Members[1].DataType.Type)
+
+	p, _ = thing.Property("history")
+	require.Equal(t, 10, p.DataType.Size)
+	require.Equal(t, TypeInt, p.DataType.Item.Type)
+	require.Equal(t, 100.0, *p.DataType.Item.Max)
+
+	p, _ = thing.Property("label")
+	require.Equal(t, 64, p.DataType.Length)
+
+	e, ok := thing.Event("overheat")
+	require.True(t, ok)
+	require.Equal(t, EventTypeAlert, e.Type)
+	require.Equal(t, "value", e.OutputData[0].Identifier)
+
+	s, ok := thing.Service("get")
+	require.True(t, ok)
+	require.Equal(t, []Param{{Identifier: "temperature"}, {Identifier: "switch"}}, s.InputData)
+	s, _ = thing.Service("reboot")
+	require.Equal(t, CallTypeSync, s.CallType)
+	require.Equal(t, "s", s.InputData[0].DataType.Unit)
+
+	_, ok = thing.Property("none")
+	require.False(t, ok)
+}
+
+func TestParseString(t *testing.T) {
+	data, err := os.ReadFile("testdata/thing.json")
+	require.NoError(t, err)
+	quoted, err := json.Marshal(string(data))
+	require.NoError(t, err)
+
+	thing, err := Parse(quoted)
+	require.NoError(t, err)
+	require.Len(t, thing.Properties, 7)
+
+	_, err = Parse([]byte(`[]`))
+	require.Equal(t, ErrInvalidTSL, err)
+	_, err = Parse([]byte(`{"properties":[{"identifier":"a","dataType":{"type":"int","specs":{"min":"x"}}}]}`))
+	require.Error(t, err)
+}
+
+func TestMerge(t *testing.T) {
+	base, err := LoadFile("testdata/thing.json")
+	require.NoError(t, err)
+	thing, err := LoadFile("testdata/thing.json", "testdata/dynamic.json")
+	require.NoError(t, err)
+
+	// 原物模型不变
+	p, _ := base.Property("temperature")
+	require.Equal(t, TypeFloat, p.DataType.Type)
+
+	require.Len(t, thing.Properties, 8)
+	p, _ = thing.Property("temperature")
+	require.Equal(t, TypeDouble, p.DataType.Type)
+	require.Equal(t, 150.0, *p.DataType.Max)
+	require.Equal(t, "temperature", thing.Properties[0].Identifier)
+	require.Equal(t, "humidity", thing.Properties[7].Identifier)
+	require.Len(t, thing.Events, 2)
+	_, ok := thing.Service("calibrate")
+	require.True(t, ok)
+	require.Equal(t, "a1B2c3D4e5F", thing.Profile.ProductKey)
+}
+
+func TestDataTypeMarshal(t *testing.T) {
+	thing, err := LoadFile("testdata/thing.json")
+	require.NoError(t, err)
+	data, err := json.Marshal(thing)
+	require.NoError(t, err)
+
+	got, err := Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, thing, got)
+}
@@ -0,0 +1,300 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package tsl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// ValidationError 校验错误
+type ValidationError struct {
+	// Identifier 出错的标识符, 结构体成员以.连接, 数组元素为[index], 如 location.latitude, history[1]
+	Identifier string
+	Reason     string
+}
+
+// Error implement error
+func (sf *ValidationError) Error() string {
+	return "tsl: " + sf.Identifier + ": " + sf.Reason
+}
+
+func invalid(identifier, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{identifier, fmt.Sprintf(format, args...)}
+}
+
+// ValidateProperties 校验属性上报的params
+// 属性值可以为值本身, 也可以为 {"value": v, "time": ms} 格式.
+// 自定义模块的属性标识符为 {functionBlockId}:{identifier}, 见 Thing.Identifier
+func (sf *Thing) ValidateProperties(params interface{}) error {
+	m, err := toObject(params)
+	if err != nil {
+		return err
+	}
+	for _, id := range sortedKeys(m) {
+		v := m[id]
+		pid, ok := sf.localIdentifier(id)
+		if !ok {
+			return invalid(id, "function block mismatch")
+		}
+		p, ok := sf.Property(pid)
+		if !ok {
+			return invalid(id, "property not found")
+		}
+		if err = p.DataType.validate(id, unwrapTimeValue(p.DataType, v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateEvent 校验事件上报的params,校验事件的输出参数
+// 事件参数可以为 {"value": {...}, "time": ms} 格式
+func (sf *Thing) ValidateEvent(eventID string, params interface{}) error {
+	id, ok := sf.localIdentifier(eventID)
+	if !ok {
+		return invalid(eventID, "function block mismatch")
+	}
+	e, ok := sf.Event(id)
+	if !ok {
+		return invalid(eventID, "event not found")
+	}
+	m, err := toObject(params)
+	if err != nil {
+		return err
+	}
+	// 输出参数value为结构体时无法区分,按参数处理
+	if v, ok := m["value"].(map[string]interface{}); ok && isTimeValue(m) {
+		if i := paramIndex(e.OutputData, "value"); i < 0 || e.OutputData[i].DataType.Type != TypeStruct {
+			m = v
+		}
+	}
+	return validateParams(eventID, e.OutputData, m)
+}
+
+// ValidateServiceOutput 校验服务回复的data,校验服务的输出参数
+func (sf *Thing) ValidateServiceOutput(serviceID string, data interface{}) error {
+	id, ok := sf.localIdentifier(serviceID)
+	if !ok {
+		return invalid(serviceID, "function block mismatch")
+	}
+	s, ok := sf.Service(id)
+	if !ok {
+		return invalid(serviceID, "service not found")
+	}
+	m, err := toObject(data)
+	if err != nil {
+		return err
+	}
+	return validateParams(serviceID, s.OutputData, m)
+}
+
+// Validate 校验值是否符合数据类型,v为json反序列化(使用json.Number)后的值
+func (sf *DataType) Validate(identifier string, v interface{}) error {
+	return sf.validate(identifier, v)
+}
+
+func validateParams(prefix string, params []Param, m map[string]interface{}) error {
+	for _, id := range sortedKeys(m) {
+		v := m[id]
+		i := paramIndex(params, id)
+		if i < 0 {
+			return invalid(prefix+"."+id, "param not found")
+		}
+		if err := params[i].DataType.validate(prefix+"."+id, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sf *DataType) validate(identifier string, v interface{}) error {
+	switch sf.Type {
+	case TypeInt, TypeFloat, TypeDouble:
+		n, ok := v.(json.Number)
+		if !ok {
+			return invalid(identifier, "expect %s, got %s", sf.Type, typeOf(v))
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return invalid(identifier, "invalid number %s", n)
+		}
+		if sf.Type == TypeInt && f != math.Trunc(f) {
+			return invalid(identifier, "expect int, got %s", n)
+		}
+		if sf.Min != nil && f < *sf.Min {
+			return invalid(identifier, "%s less than min %v", n, *sf.Min)
+		}
+		if sf.Max != nil && f > *sf.Max {
+			return invalid(identifier, "%s greater than max %v", n, *sf.Max)
+		}
+		if sf.Step != nil && *sf.Step > 0 {
+			base := 0.0
+			if sf.Min != nil {
+				base = *sf.Min
+			}
+			steps := (f - base) / *sf.Step
+			if math.Abs(steps-math.Round(steps)) > 1e-6 {
+				return invalid(identifier, "%s not a multiple of step %v", n, *sf.Step)
+			}
+		}
+	case TypeText:
+		s, ok := v.(string)
+		if !ok {
+			return invalid(identifier, "expect text, got %s", typeOf(v))
+		}
+		if sf.Length > 0 && len(s) > sf.Length {
+			return invalid(identifier, "text length %d exceeds %d", len(s), sf.Length)
+		}
+	case TypeDate:
+		var s string
+		switch vv := v.(type) {
+		case string:
+			s = vv
+		case json.Number:
+			s = vv.String()
+		default:
+			return invalid(identifier, "expect date, got %s", typeOf(v))
+		}
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return invalid(identifier, "invalid date %q, expect UTC timestamp in ms", s)
+		}
+	case TypeBool, TypeEnum:
+		n, ok := v.(json.Number)
+		if !ok {
+			return invalid(identifier, "expect %s, got %s", sf.Type, typeOf(v))
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return invalid(identifier, "expect %s, got %s", sf.Type, n)
+		}
+		if sf.Type == TypeBool && sf.Values == nil {
+			if i != 0 && i != 1 {
+				return invalid(identifier, "expect bool 0 or 1, got %d", i)
+			}
+		} else if _, ok := sf.Values[int(i)]; !ok {
+			return invalid(identifier, "%d not in %s values", i, sf.Type)
+		}
+	case TypeStruct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return invalid(identifier, "expect struct, got %s", typeOf(v))
+		}
+		return validateParams(identifier, sf.Members, m)
+	case TypeArray:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return invalid(identifier, "expect array, got %s", typeOf(v))
+		}
+		if sf.Size > 0 && len(arr) > sf.Size {
+			return invalid(identifier, "array size %d exceeds %d", len(arr), sf.Size)
+		}
+		if sf.Item != nil {
+			for i, item := range arr {
+				if err := sf.Item.validate(fmt.Sprintf("%s[%d]", identifier, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// toObject 将params转换为json对象, 数值使用json.Number
+func toObject(params interface{}) (map[string]interface{}, error) {
+	var data []byte
+	switch v := params.(type) {
+	case []byte:
+		data = v
+	case json.RawMessage:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		var err error
+		if data, err = json.Marshal(params); err != nil {
+			return nil, err
+		}
+	}
+	m := make(map[string]interface{})
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// unwrapTimeValue 属性值为 {"value": v, "time": ms} 格式时返回v
+func unwrapTimeValue(dt DataType, v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok || !isTimeValue(m) {
+		return v
+	}
+	if dt.Type == TypeStruct && hasParam(dt.Members, "value") {
+		return v
+	}
+	if vv, ok := m["value"]; ok {
+		return vv
+	}
+	return v
+}
+
+func isTimeValue(m map[string]interface{}) bool {
+	if _, ok := m["value"]; !ok {
+		return false
+	}
+	for k := range m {
+		if k != "value" && k != "time" {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedKeys 按标识符排序, 保证多处错误时返回的错误确定
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func hasParam(params []Param, identifier string) bool {
+	return paramIndex(params, identifier) >= 0
+}
+
+func paramIndex(params []Param, identifier string) int {
+	for i := range params {
+		if params[i].Identifier == identifier {
+			return i
+		}
+	}
+	return -1
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,90 @@
+package tsl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateProperties(t *testing.T) {
+	thing, err := LoadFile("testdata/thing.json")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		params     interface{}
+		identifier string
+	}{
+		{"valid", map[string]interface{}{"temperature": 25.3, "switch": 1, "mode": 2}, ""},
+		{"time value", map[string]interface{}{"temperature": map[string]interface{}{"value": 25.3, "time": 1524448722000}}, ""},
+		{"struct", `{"location":{"longitude":120.12,"latitude":30.28}}`, ""},
+		{"array", `{"history":[1,2,3]}`, ""},
+		{"date", `{"bootTime":"1524448722000"}`, ""},
+		{"not found", map[string]interface{}{"unknown": 1}, "unknown"},
+		{"type mismatch", map[string]interface{}{"temperature": "25"}, "temperature"},
+		{"less than min", map[string]interface{}{"temperature": -41}, "temperature"},
+		{"greater than max", map[string]interface{}{"temperature": 121}, "temperature"},
+		{"step", map[string]interface{}{"temperature": 25.37}, "temperature"},
+		{"bool", map[string]interface{}{"switch": 2}, "switch"},
+		{"enum", map[string]interface{}{"mode": 3}, "mode"},
+		{"text length", map[string]interface{}{"label": string(make([]byte, 65))}, "label"},
+		{"struct member", `{"location":{"longitude":120.12,"latitude":91}}`, "location.latitude"},
+		{"struct unknown member", `{"location":{"altitude":1}}`, "location.altitude"},
+		{"array size", `{"history":[1,2,3,4,5,6,7,8,9,10,11]}`, "history"},
+		{"array item", `{"history":[1,2.5]}`, "history[1]"},
+		{"invalid date", `{"bootTime":"today"}`, "bootTime"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := thing.ValidateProperties(tt.params)
+			if tt.identifier == "" {
+				require.NoError(t, err)
+				return
+			}
+			var verr *ValidationError
+			require.True(t, errors.As(err, &verr), "%v", err)
+			require.Equal(t, tt.identifier, verr.Identifier)
+		})
+	}
+}
+
+func TestValidateEventAndService(t *testing.T) {
+	thing, err := LoadFile("testdata/thing.json")
+	require.NoError(t, err)
+
+	require.NoError(t, thing.ValidateEvent("overheat", map[string]interface{}{"value": 100}))
+	require.NoError(t, thing.ValidateEvent("overheat", map[string]interface{}{
+		"value": map[string]interface{}{"value": 100},
+		"time":  1524448722000,
+	}))
+	var verr *ValidationError
+	require.True(t, errors.As(thing.ValidateEvent("overheat", map[string]interface{}{"value": 200}), &verr))
+	require.Equal(t, "overheat.value", verr.Identifier)
+	require.True(t, errors.As(thing.ValidateEvent("none", nil), &verr))
+	require.Equal(t, "none", verr.Identifier)
+
+	require.NoError(t, thing.ValidateServiceOutput("reboot", map[string]interface{}{"result": "ok"}))
+	require.NoError(t, thing.ValidateServiceOutput("reboot", "{}"))
+	require.True(t, errors.As(thing.ValidateServiceOutput("reboot", map[string]interface{}{"result": 1}), &verr))
+	require.Equal(t, "reboot.result", verr.Identifier)
+}
+
+func TestValidateFunctionBlock(t *testing.T) {
+	thing, err := LoadFile("testdata/thing.json")
+	require.NoError(t, err)
+	thing.FunctionBlockID = "fb"
+
+	require.NoError(t, thing.ValidateProperties(map[string]interface{}{"fb:temperature": 25.3}))
+	require.NoError(t, thing.ValidateEvent("fb:overheat", map[string]interface{}{"value": 100}))
+	require.NoError(t, thing.ValidateServiceOutput("fb:reboot", map[string]interface{}{"result": "ok"}))
+
+	var verr *ValidationError
+	require.True(t, errors.As(thing.ValidateProperties(map[string]interface{}{"fb:temperature": 121}), &verr))
+	require.Equal(t, "fb:temperature", verr.Identifier)
+	// 其它模块或默认模块的标识符
+	require.True(t, errors.As(thing.ValidateProperties(map[string]interface{}{"temperature": 25.3}), &verr))
+	require.Equal(t, "temperature", verr.Identifier)
+	require.True(t, errors.As(thing.ValidateEvent("other:overheat", nil), &verr))
+	require.Equal(t, "other:overheat", verr.Identifier)
+}
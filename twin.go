@@ -0,0 +1,352 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TwinValue 设备影子中属性的值
+type TwinValue struct {
+	Value   json.RawMessage // 属性值, 紧凑的json
+	Time    time.Time       // 上报值为上报时间, 期望值为获取时间
+	Version int64           // 期望值版本, 上报值为0
+}
+
+// TwinEvent 设备影子变化类型
+type TwinEvent byte
+
+// 设备影子变化类型
+const (
+	TwinReported       TwinEvent = iota // 上报值变化
+	TwinDesired                         // 期望值或其版本变化
+	TwinDesiredDeleted                  // 期望值被删除
+)
+
+// TwinChange 设备影子变化通知
+type TwinChange struct {
+	ProductKey string
+	DeviceName string
+	Identifier string
+	Event      TwinEvent
+	Old        TwinValue // 之前的值,之前不存在时为零值
+	New        TwinValue // 当前的值,删除时为零值
+}
+
+// TwinWatcher 设备影子变化通知函数, 不可在通知函数中阻塞
+type TwinWatcher func(change TwinChange)
+
+// TwinDelta 期望值与上报值的差异
+type TwinDelta struct {
+	Identifier  string
+	Desired     TwinValue
+	Reported    TwinValue
+	HasReported bool // 是否已有上报值
+}
+
+// Twin 设备影子, 记录设备最后上报的属性值及从平台获取的期望属性值, 协程安全
+type Twin struct {
+	productKey string
+	deviceName string
+
+	mu       sync.RWMutex
+	reported map[string]TwinValue
+	desired  map[string]TwinValue
+	watchers []TwinWatcher
+	notify   func(change TwinChange) // 设备管理的全局通知
+}
+
+func newTwin(pk, dn string, notify func(change TwinChange)) *Twin {
+	return &Twin{
+		productKey: pk,
+		deviceName: dn,
+		reported:   make(map[string]TwinValue),
+		desired:    make(map[string]TwinValue),
+		notify:     notify,
+	}
+}
+
+// Watch 添加变化通知函数
+func (sf *Twin) Watch(w TwinWatcher) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.watchers = append(sf.watchers, w)
+}
+
+// Reported 获取属性的上报值
+func (sf *Twin) Reported(identifier string) (TwinValue, bool) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	v, ok := sf.reported[identifier]
+	return v, ok
+}
+
+// Desired 获取属性的期望值
+func (sf *Twin) Desired(identifier string) (TwinValue, bool) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	v, ok := sf.desired[identifier]
+	return v, ok
+}
+
+// ReportedAll 获取所有属性的上报值
+func (sf *Twin) ReportedAll() map[string]TwinValue {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return copyTwinValues(sf.reported)
+}
+
+// DesiredAll 获取所有属性的期望值
+func (sf *Twin) DesiredAll() map[string]TwinValue {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return copyTwinValues(sf.desired)
+}
+
+// SetReported 记录属性上报的params, 属性值可为 {"value": v, "time": ms} 格式,
+// 此时使用其中的时间, 否则使用t
+func (sf *Twin) SetReported(params interface{}, t time.Time) error {
+	values, err := toRawObject(params)
+	if err != nil {
+		return err
+	}
+
+	var changes []TwinChange
+	sf.mu.Lock()
+	for id, raw := range values {
+		v := TwinValue{Time: t}
+		tv := struct {
+			Value json.RawMessage `json:"value"`
+			Time  int64           `json:"time"`
+		}{}
+		if isTimeValueJSON(raw) && json.Unmarshal(raw, &tv) == nil {
+			v.Value, v.Time = compactJSON(tv.Value), time.Unix(0, tv.Time*int64(time.Millisecond))
+		} else {
+			v.Value = compactJSON(raw)
+		}
+		old, ok := sf.reported[id]
+		sf.reported[id] = v
+		if !ok || !bytes.Equal(old.Value, v.Value) {
+			changes = append(changes, sf.change(id, TwinReported, old, v))
+		}
+	}
+	sf.mu.Unlock()
+	sf.fire(changes)
+	return nil
+}
+
+// SetDesired 记录从平台获取的期望属性值, data为 thing.property.desired.get 回复的data域,
+// 格式为 {"identifier": {"value": v, "version": n}}, value为null表示无期望值
+func (sf *Twin) SetDesired(data json.RawMessage, t time.Time) error {
+	values := make(map[string]struct {
+		Value   json.RawMessage `json:"value"`
+		Version int64           `json:"version"`
+	})
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	var changes []TwinChange
+	sf.mu.Lock()
+	for id, dv := range values {
+		old, ok := sf.desired[id]
+		value := compactJSON(dv.Value)
+		if len(value) == 0 || bytes.Equal(value, []byte("null")) {
+			if ok {
+				delete(sf.desired, id)
+				changes = append(changes, sf.change(id, TwinDesiredDeleted, old, TwinValue{}))
+			}
+			continue
+		}
+		v := TwinValue{value, t, dv.Version}
+		sf.desired[id] = v
+		if !ok || old.Version != v.Version || !bytes.Equal(old.Value, v.Value) {
+			changes = append(changes, sf.change(id, TwinDesired, old, v))
+		}
+	}
+	sf.mu.Unlock()
+	sf.fire(changes)
+	return nil
+}
+
+// DeleteDesired 删除属性的期望值, version为0时无条件删除,
+// 否则仅当记录的版本不大于version时删除, 返回是否删除
+func (sf *Twin) DeleteDesired(identifier string, version int64) bool {
+	sf.mu.Lock()
+	old, ok := sf.desired[identifier]
+	if !ok || (version != 0 && old.Version > version) {
+		sf.mu.Unlock()
+		return false
+	}
+	delete(sf.desired, identifier)
+	change := sf.change(identifier, TwinDesiredDeleted, old, TwinValue{})
+	sf.mu.Unlock()
+	sf.fire([]TwinChange{change})
+	return true
+}
+
+// Diff 期望值与上报值不一致的属性, 按标识符排序
+func (sf *Twin) Diff() []TwinDelta {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+
+	deltas := make([]TwinDelta, 0, len(sf.desired))
+	for id, desired := range sf.desired {
+		reported, ok := sf.reported[id]
+		if ok && bytes.Equal(reported.Value, desired.Value) {
+			continue
+		}
+		deltas = append(deltas, TwinDelta{id, desired, reported, ok})
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].Identifier < deltas[j].Identifier })
+	return deltas
+}
+
+func (sf *Twin) change(identifier string, event TwinEvent, old, v TwinValue) TwinChange {
+	return TwinChange{sf.productKey, sf.deviceName, identifier, event, old, v}
+}
+
+// fire 在锁外通知变化
+func (sf *Twin) fire(changes []TwinChange) {
+	if len(changes) == 0 {
+		return
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Identifier < changes[j].Identifier })
+	sf.mu.RLock()
+	watchers := sf.watchers
+	sf.mu.RUnlock()
+	for _, change := range changes {
+		if sf.notify != nil {
+			sf.notify(change)
+		}
+		for _, w := range watchers {
+			w(change)
+		}
+	}
+}
+
+// Twin 获取设备的设备影子
+func (sf *DevMgr) Twin(pk, dn string) (*Twin, error) {
+	sf.rw.RLock()
+	defer sf.rw.RUnlock()
+	node, err := sf.searchLocked(pk, dn)
+	if err != nil {
+		return nil, err
+	}
+	return node.twin, nil
+}
+
+// WatchTwin 添加所有设备的设备影子变化通知函数
+func (sf *DevMgr) WatchTwin(w TwinWatcher) {
+	sf.twinMu.Lock()
+	defer sf.twinMu.Unlock()
+	sf.twinWatchers = append(sf.twinWatchers, w)
+}
+
+// notifyTwin 通知所有设备的设备影子变化
+func (sf *DevMgr) notifyTwin(change TwinChange) {
+	sf.twinMu.RLock()
+	watchers := sf.twinWatchers
+	sf.twinMu.RUnlock()
+	for _, w := range watchers {
+		w(change)
+	}
+}
+
+// recordReported 记录属性上报到设备影子
+func (sf *Client) recordReported(pk, dn string, params interface{}) {
+	twin, err := sf.Twin(pk, dn)
+	if err != nil {
+		return
+	}
+	if err = twin.SetReported(params, time.Now()); err != nil {
+		sf.StructuredLog().Warn("twin record reported failed", "productKey", pk, "deviceName", dn, "error", err)
+	}
+}
+
+// recordDesired 记录获取的期望属性值到设备影子
+func (sf *Client) recordDesired(pk, dn string, data json.RawMessage) {
+	twin, err := sf.Twin(pk, dn)
+	if err != nil {
+		return
+	}
+	if err = twin.SetDesired(data, time.Now()); err != nil {
+		sf.StructuredLog().Warn("twin record desired failed", "productKey", pk, "deviceName", dn, "error", err)
+	}
+}
+
+// recordDesiredDeleted 记录期望属性值已删除到设备影子
+// params为 thing.property.desired.delete 的params, 格式为 {"identifier": {"version": n}}
+func (sf *Client) recordDesiredDeleted(pk, dn string, params interface{}) {
+	twin, err := sf.Twin(pk, dn)
+	if err != nil {
+		return
+	}
+	values, err := toRawObject(params)
+	if err != nil {
+		return
+	}
+	for id, raw := range values {
+		v := struct {
+			Version int64 `json:"version"`
+		}{}
+		_ = json.Unmarshal(raw, &v)
+		twin.DeleteDesired(id, v.Version)
+	}
+}
+
+// toRawObject 将params转换为json对象
+func toRawObject(params interface{}) (map[string]json.RawMessage, error) {
+	var data []byte
+	switch v := params.(type) {
+	case []byte:
+		data = v
+	case json.RawMessage:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		var err error
+		if data, err = json.Marshal(params); err != nil {
+			return nil, err
+		}
+	}
+	values := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// isTimeValueJSON 是否为 {"value": v, "time": ms} 格式
+func isTimeValueJSON(raw json.RawMessage) bool {
+	m := make(map[string]json.RawMessage)
+	if json.Unmarshal(raw, &m) != nil || len(m) != 2 {
+		return false
+	}
+	_, hasValue := m["value"]
+	_, hasTime := m["time"]
+	return hasValue && hasTime
+}
+
+func compactJSON(raw json.RawMessage) json.RawMessage {
+	buf := bytes.Buffer{}
+	if err := json.Compact(&buf, raw); err != nil {
+		return append(json.RawMessage{}, raw...)
+	}
+	return buf.Bytes()
+}
+
+func copyTwinValues(m map[string]TwinValue) map[string]TwinValue {
+	values := make(map[string]TwinValue, len(m))
+	for k, v := range m {
+		values[k] = v
+	}
+	return values
+}
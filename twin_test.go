@@ -0,0 +1,150 @@
+package aiot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+func TestTwin(t *testing.T) {
+	var changes []TwinChange
+	twin := newTwin("pk", "dn", nil)
+	twin.Watch(func(change TwinChange) { changes = append(changes, change) })
+
+	now := time.Now()
+	require.NoError(t, twin.SetReported(map[string]interface{}{
+		"temp":  25,
+		"power": map[string]interface{}{"value": 1, "time": 1600000000000},
+		"color": map[string]interface{}{"value": "red"},
+	}, now))
+	require.Len(t, changes, 3)
+	require.Equal(t, "color", changes[0].Identifier)
+	require.Equal(t, TwinReported, changes[0].Event)
+
+	v, ok := twin.Reported("power")
+	require.True(t, ok)
+	require.Equal(t, json.RawMessage("1"), v.Value)
+	require.Equal(t, int64(1600000000000), v.Time.UnixNano()/int64(time.Millisecond))
+	// 非 {value, time} 格式的结构体原样记录
+	v, _ = twin.Reported("color")
+	require.Equal(t, json.RawMessage(`{"value":"red"}`), v.Value)
+
+	// 值未变化不通知
+	changes = nil
+	require.NoError(t, twin.SetReported(`{"temp": 25}`, now))
+	require.Empty(t, changes)
+
+	require.NoError(t, twin.SetDesired(json.RawMessage(`{"temp":{"value":26,"version":2},"power":{"value":1,"version":1},"mode":{"value":null,"version":0}}`), now))
+	require.Len(t, changes, 2)
+	require.Equal(t, TwinDesired, changes[0].Event)
+	_, ok = twin.Desired("mode")
+	require.False(t, ok)
+
+	diff := twin.Diff()
+	require.Len(t, diff, 1)
+	require.Equal(t, "temp", diff[0].Identifier)
+	require.Equal(t, json.RawMessage("26"), diff[0].Desired.Value)
+	require.Equal(t, int64(2), diff[0].Desired.Version)
+	require.True(t, diff[0].HasReported)
+
+	// 版本较新的期望值不删除
+	require.False(t, twin.DeleteDesired("temp", 1))
+	changes = nil
+	require.True(t, twin.DeleteDesired("temp", 2))
+	require.Equal(t, []TwinChange{{"pk", "dn", "temp", TwinDesiredDeleted, TwinValue{json.RawMessage("26"), now, 2}, TwinValue{}}}, changes)
+	require.True(t, twin.DeleteDesired("power", 0))
+	require.Empty(t, twin.DesiredAll())
+	require.Len(t, twin.ReportedAll(), 3)
+
+	// 期望值被平台清空
+	require.NoError(t, twin.SetDesired(json.RawMessage(`{"temp":{"value":26,"version":3}}`), now))
+	changes = nil
+	require.NoError(t, twin.SetDesired(json.RawMessage(`{"temp":{"value":null,"version":0}}`), now))
+	require.Len(t, changes, 1)
+	require.Equal(t, TwinDesiredDeleted, changes[0].Event)
+
+	require.Error(t, twin.SetReported("[1]", now))
+	require.Error(t, twin.SetDesired(json.RawMessage(`[1]`), now))
+}
+
+func TestClientTwin(t *testing.T) {
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn, WithEnableGateway(), WithEnableDesired())
+	require.NoError(t, c.Add(infra.MetaTriad{ProductKey: "subPk", DeviceName: "subDn"}))
+	require.NoError(t, c.SetDeviceStatus("subPk", "subDn", DevStatusOnline))
+
+	var changes []TwinChange
+	c.WatchTwin(func(change TwinChange) { changes = append(changes, change) })
+
+	// 网关及子设备各自记录上报值
+	_, err := c.ThingEventPropertyPost("pk", "dn", map[string]int{"temp": 25})
+	require.NoError(t, err)
+	_, err = c.ThingEventPropertyPost("subPk", "subDn", map[string]int{"temp": 30})
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	require.Equal(t, "subPk", changes[1].ProductKey)
+
+	twin, err := c.Twin("pk", "dn")
+	require.NoError(t, err)
+	v, ok := twin.Reported("temp")
+	require.True(t, ok)
+	require.Equal(t, json.RawMessage("25"), v.Value)
+	subTwin, err := c.Twin("subPk", "subDn")
+	require.NoError(t, err)
+	v, _ = subTwin.Reported("temp")
+	require.Equal(t, json.RawMessage("30"), v.Value)
+	_, err = c.Twin("pk", "unknown")
+	require.Error(t, err)
+
+	// 获取期望值的回复记录期望值
+	require.NoError(t, ProcThingDesiredPropertyGetReply(c, "/sys/subPk/subDn/thing/property/desired/get_reply",
+		[]byte(`{"id":"1","code":200,"data":{"temp":{"value":26,"version":3}}}`)))
+	require.Len(t, subTwin.Diff(), 1)
+	require.Empty(t, twin.Diff())
+
+	// 清空期望值成功后删除期望值
+	conn.onPublish = func(topic string, payload []byte) {
+		req := &Request{}
+		if json.Unmarshal(payload, req) != nil {
+			return
+		}
+		ProcThingDesiredPropertyDeleteReply(c, topic+"_reply", []byte(fmt.Sprintf(`{"id":"%d","code":200}`, req.ID))) // nolint: errcheck
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, c.LinkThingDesiredPropertyDeleteContext(ctx, "subPk", "subDn", map[string]interface{}{
+		"temp": map[string]int64{"version": 3},
+	}))
+	require.Empty(t, subTwin.Diff())
+	require.Equal(t, TwinDesiredDeleted, changes[len(changes)-1].Event)
+
+	// 异步清空期望值, 回复成功后同样删除期望值, 失败时保留
+	desired := []byte(`{"id":"2","code":200,"data":{"temp":{"value":27,"version":4}}}`)
+	require.NoError(t, ProcThingDesiredPropertyGetReply(c, "/sys/subPk/subDn/thing/property/desired/get_reply", desired))
+	code := infra.CodeRequestError
+	conn.onPublish = func(topic string, payload []byte) {
+		req := &Request{}
+		if json.Unmarshal(payload, req) != nil {
+			return
+		}
+		ProcThingDesiredPropertyDeleteReply(c, topic+"_reply", []byte(fmt.Sprintf(`{"id":"%d","code":%d}`, req.ID, code))) // nolint: errcheck
+	}
+	params := map[string]interface{}{"temp": map[string]int64{"version": 4}}
+	token, err := c.ThingDesiredPropertyDelete("subPk", "subDn", params)
+	require.NoError(t, err)
+	_, err = token.Wait(time.Second)
+	require.Error(t, err)
+	require.Len(t, subTwin.Diff(), 1)
+	code = infra.CodeSuccess
+	token, err = c.ThingDesiredPropertyDelete("subPk", "subDn", params)
+	require.NoError(t, err)
+	_, err = token.Wait(time.Second)
+	require.NoError(t, err)
+	require.Empty(t, subTwin.Diff())
+}
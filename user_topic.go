@@ -0,0 +1,256 @@
+// Copyright 2020 thinkgos (thinkgo@aliyun.com).  All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package aiot
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/things-go/aliyun-iot/uri"
+)
+
+// @see https://help.aliyun.com/document_detail/85539.html
+
+// 自定义topic类中的占位符及通配符
+const (
+	TopicProductKey   = "${productKey}"
+	TopicDeviceName   = "${deviceName}"
+	TopicWildcardOne  = "+"
+	TopicWildcardSome = "#"
+)
+
+// UserTopicParams 自定义topic的参数
+type UserTopicParams struct {
+	ProductKey string
+	DeviceName string
+	// Wildcards 依次为topic类中 + 及 # 匹配的值, # 匹配的多级以/连接,匹配零级时为空字符串
+	Wildcards []string
+}
+
+// UserTopicHandler 自定义topic下行数据处理函数
+// topic: 实际收到的topic, params: 从topic中提取的参数, payload: 原始报文
+type UserTopicHandler func(c *Client, topic string, params UserTopicParams, payload []byte) error
+
+// userTopic 已声明的自定义topic类
+type userTopic struct {
+	class   string
+	segs    []string
+	handler UserTopicHandler
+}
+
+// parseUserTopic 解析topic类, 如 /${productKey}/${deviceName}/user/+/get
+// 必须包含 ${productKey} 和 ${deviceName}, 通配符必须独占一级, # 只能位于最后一级
+func parseUserTopic(class string) ([]string, error) {
+	if !strings.HasPrefix(class, uri.Sep) {
+		return nil, ErrInvalidURI
+	}
+	segs := uri.Spilt(class)
+	var hasPk, hasDn bool
+	for i, seg := range segs {
+		switch seg {
+		case "":
+			return nil, ErrInvalidURI
+		case TopicProductKey:
+			hasPk = true
+		case TopicDeviceName:
+			hasDn = true
+		case TopicWildcardOne:
+		case TopicWildcardSome:
+			if i != len(segs)-1 {
+				return nil, ErrInvalidURI
+			}
+		default:
+			if strings.ContainsAny(seg, "+#$") {
+				return nil, ErrInvalidURI
+			}
+		}
+	}
+	if !hasPk || !hasDn {
+		return nil, ErrInvalidURI
+	}
+	return segs, nil
+}
+
+// match 匹配实际收到的topic,并提取参数
+func (sf *userTopic) match(topic string) (UserTopicParams, bool) {
+	params := UserTopicParams{}
+	segs := uri.Spilt(topic)
+	for i, seg := range sf.segs {
+		if seg == TopicWildcardSome { // # 可匹配零级
+			rest := ""
+			if i < len(segs) {
+				rest = strings.Join(segs[i:], uri.Sep)
+			}
+			params.Wildcards = append(params.Wildcards, rest)
+			return params, true
+		}
+		if i >= len(segs) || segs[i] == "" {
+			return params, false
+		}
+		switch seg {
+		case TopicProductKey:
+			params.ProductKey = segs[i]
+		case TopicDeviceName:
+			params.DeviceName = segs[i]
+		case TopicWildcardOne:
+			params.Wildcards = append(params.Wildcards, segs[i])
+		default:
+			if seg != segs[i] {
+				return params, false
+			}
+		}
+	}
+	return params, len(segs) == len(sf.segs)
+}
+
+// UserTopicURI 使用设备及通配符的值生成自定义topic类的实际topic
+// values: 依次替换topic类中的 + 及 #, 个数必须与通配符个数一致
+func UserTopicURI(class, pk, dn string, values ...string) (string, error) {
+	segs, err := parseUserTopic(class)
+	if err != nil {
+		return "", err
+	}
+	n := 0
+	for i, seg := range segs {
+		switch seg {
+		case TopicProductKey:
+			segs[i] = pk
+		case TopicDeviceName:
+			segs[i] = dn
+		case TopicWildcardOne, TopicWildcardSome:
+			if n >= len(values) || values[n] == "" ||
+				(seg == TopicWildcardOne && strings.Contains(values[n], uri.Sep)) {
+				return "", ErrInvalidParameter
+			}
+			segs[i] = values[n]
+			n++
+		}
+	}
+	if n != len(values) {
+		return "", ErrInvalidParameter
+	}
+	return uri.Sep + strings.Join(segs, uri.Sep), nil
+}
+
+// subscribeTopic 自定义topic类对应设备的订阅topic
+func (sf *userTopic) subscribeTopic(pk, dn string) string {
+	r := strings.NewReplacer(TopicProductKey, pk, TopicDeviceName, dn)
+	return r.Replace(sf.class)
+}
+
+// HandleUserTopic 声明自定义topic类及其处理函数, 已声明的topic类将替换处理函数.
+// 声明后 SubscribeAllTopic 将为设备订阅该topic类,之前已订阅的设备需调用 SubscribeUserTopic
+// class: topic类, 如 /${productKey}/${deviceName}/user/get, 支持 + 及 # 通配符
+func (sf *Client) HandleUserTopic(class string, h UserTopicHandler) error {
+	if h == nil {
+		return ErrInvalidParameter
+	}
+	segs, err := parseUserTopic(class)
+	if err != nil {
+		return err
+	}
+	sf.router.mu.Lock()
+	defer sf.router.mu.Unlock()
+	for i, t := range sf.router.userTopics {
+		if t.class == class {
+			sf.router.userTopics[i] = &userTopic{class, segs, h}
+			return nil
+		}
+	}
+	sf.router.userTopics = append(sf.router.userTopics, &userTopic{class, segs, h})
+	return nil
+}
+
+// userTopicList 获取已声明的自定义topic类
+func (sf *Client) userTopicList() []*userTopic {
+	sf.router.mu.RLock()
+	defer sf.router.mu.RUnlock()
+	return append([]*userTopic{}, sf.router.userTopics...)
+}
+
+// SubscribeUserTopic 为设备订阅已声明的自定义topic类, class为空时订阅所有已声明的topic类
+func (sf *Client) SubscribeUserTopic(pk, dn string, class ...string) error {
+	topics, err := sf.userTopicSubscribeList(pk, dn, class...)
+	if err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		if err = sf.subscribe(topic, ProcUserTopic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnSubscribeUserTopic 为设备取消订阅已声明的自定义topic类, class为空时取消订阅所有已声明的topic类
+func (sf *Client) UnSubscribeUserTopic(pk, dn string, class ...string) error {
+	topics, err := sf.userTopicSubscribeList(pk, dn, class...)
+	if err != nil || len(topics) == 0 {
+		return err
+	}
+	return sf.UnSubscribe(topics...)
+}
+
+func (sf *Client) userTopicSubscribeList(pk, dn string, class ...string) ([]string, error) {
+	declared := sf.userTopicList()
+	if len(class) == 0 {
+		topics := make([]string, 0, len(declared))
+		for _, t := range declared {
+			topics = append(topics, t.subscribeTopic(pk, dn))
+		}
+		return topics, nil
+	}
+
+	topics := make([]string, 0, len(class))
+	for _, cls := range class {
+		found := false
+		for _, t := range declared {
+			if t.class == cls {
+				topics = append(topics, t.subscribeTopic(pk, dn))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrNotFound
+		}
+	}
+	return topics, nil
+}
+
+// PublishUserTopic 向自定义topic类发布数据,网关可为已上线的子设备发布
+// values: 依次替换topic类中的 + 及 #
+// payload: string及[]byte原样发送,其它类型使用json序列化
+// opts: 单次请求选项,仅 WithQoS 有效
+func (sf *Client) PublishUserTopic(pk, dn, class string, values []string, payload interface{}, opts ...RequestOption) error {
+	if !sf.IsActive(pk, dn) {
+		return ErrNotActive
+	}
+	_uri, err := UserTopicURI(class, pk, dn, values...)
+	if err != nil {
+		return err
+	}
+	switch payload.(type) {
+	case string, []byte:
+	default:
+		if payload, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	o := newRequestOptions(opts...)
+	sf.StructuredLog().Debug("user.topic.publish", "topic", _uri)
+	return sf.Publish(_uri, o.qos, payload)
+}
+
+// ProcUserTopic 处理自定义topic下行数据,按声明顺序匹配第一个自定义topic类
+func ProcUserTopic(c *Client, rawURI string, payload []byte) error {
+	for _, t := range c.userTopicList() {
+		if params, ok := t.match(rawURI); ok {
+			c.StructuredLog().Debug("user.topic", "topic", rawURI)
+			return t.handler(c, rawURI, params, payload)
+		}
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,104 @@
+package aiot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/aliyun-iot/infra"
+)
+
+func TestUserTopicURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		class   string
+		values  []string
+		want    string
+		wantErr bool
+	}{
+		{"plain", "/${productKey}/${deviceName}/user/get", nil, "/pk/dn/user/get", false},
+		{"wildcard", "/${productKey}/${deviceName}/user/+/data/#", []string{"a", "b/c"}, "/pk/dn/user/a/data/b/c", false},
+		{"missing value", "/${productKey}/${deviceName}/user/+", nil, "", true},
+		{"too many values", "/${productKey}/${deviceName}/user/get", []string{"a"}, "", true},
+		{"one level", "/${productKey}/${deviceName}/user/+", []string{"a/b"}, "", true},
+		{"no device", "/${productKey}/user/get", nil, "", true},
+		{"some not last", "/${productKey}/${deviceName}/user/#/get", []string{"a"}, "", true},
+		{"wildcard in level", "/${productKey}/${deviceName}/user/a+", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UserTopicURI(tt.class, "pk", "dn", tt.values...)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUserTopicMatch(t *testing.T) {
+	segs, err := parseUserTopic("/${productKey}/${deviceName}/user/+/data/#")
+	require.NoError(t, err)
+	ut := &userTopic{segs: segs}
+
+	params, ok := ut.match("/pk/dn/user/a/data/b/c")
+	require.True(t, ok)
+	require.Equal(t, UserTopicParams{"pk", "dn", []string{"a", "b/c"}}, params)
+
+	params, ok = ut.match("/pk/dn/user/a/data")
+	require.True(t, ok)
+	require.Equal(t, []string{"a", ""}, params.Wildcards)
+
+	_, ok = ut.match("/pk/dn/user/a/other/b")
+	require.False(t, ok)
+	_, ok = ut.match("/pk/dn/user")
+	require.False(t, ok)
+}
+
+func TestClientUserTopic(t *testing.T) {
+	conn := newMockConn()
+	c := New(infra.MetaTriad{ProductKey: "pk", DeviceName: "dn"}, conn, WithEnableGateway())
+
+	var got []UserTopicParams
+	h := func(c *Client, topic string, params UserTopicParams, payload []byte) error {
+		got = append(got, params)
+		return nil
+	}
+	require.Equal(t, ErrInvalidURI, c.HandleUserTopic("/user/get", h))
+	require.NoError(t, c.HandleUserTopic("/${productKey}/${deviceName}/user/get", h))
+	require.NoError(t, c.HandleUserTopic("/${productKey}/${deviceName}/user/cmd/+", h))
+	require.Equal(t, ErrNotFound, c.SubscribeUserTopic("pk", "dn", "/${productKey}/${deviceName}/user/set"))
+
+	// 网关及子设备均订阅已声明的topic类
+	require.NoError(t, c.SubscribeAllTopic("pk", "dn", false))
+	require.NoError(t, c.Add(infra.MetaTriad{ProductKey: "subPk", DeviceName: "subDn"}))
+	require.NoError(t, c.SubscribeAllTopic("subPk", "subDn", true))
+	require.Contains(t, conn.subscribe, "/pk/dn/user/get")
+	require.Contains(t, conn.subscribe, "/subPk/subDn/user/cmd/+")
+
+	require.NoError(t, conn.subscribe["/subPk/subDn/user/cmd/+"](c, "/subPk/subDn/user/cmd/reboot", []byte("{}")))
+	require.NoError(t, conn.subscribe["/pk/dn/user/get"](c, "/pk/dn/user/get", []byte("{}")))
+	require.Equal(t, []UserTopicParams{
+		{"subPk", "subDn", []string{"reboot"}},
+		{"pk", "dn", nil},
+	}, got)
+
+	// 子设备未上线不能发布
+	err := c.PublishUserTopic("subPk", "subDn", "/${productKey}/${deviceName}/user/update", nil, "raw")
+	require.Equal(t, ErrNotActive, err)
+	require.NoError(t, c.SetDeviceStatus("subPk", "subDn", DevStatusOnline))
+	require.NoError(t, c.SetDeviceAvail("subPk", "subDn", true))
+	err = c.PublishUserTopic("subPk", "subDn", "/${productKey}/${deviceName}/user/+/update",
+		[]string{"temp"}, map[string]int{"value": 1}, WithQoS(0))
+	require.NoError(t, err)
+	msgs := conn.messages()
+	require.Len(t, msgs, 1)
+	require.Equal(t, "/subPk/subDn/user/temp/update", msgs[0].topic)
+	require.Equal(t, byte(0), msgs[0].qos)
+	require.Equal(t, `{"value":1}`, string(msgs[0].payload))
+
+	require.NoError(t, c.UnSubscribeAllTopic("subPk", "subDn", true))
+	require.NotContains(t, conn.subscribe, "/subPk/subDn/user/cmd/+")
+}